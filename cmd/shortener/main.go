@@ -1,21 +1,86 @@
 package main
 
 import (
+	"context"
 	"github.com/MaximMNsk/go-url-shortener/internal/models/database"
 	"github.com/MaximMNsk/go-url-shortener/internal/storage/db"
 	"github.com/MaximMNsk/go-url-shortener/internal/util/extlogger"
 	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/metadata"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/probe"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
 	"github.com/MaximMNsk/go-url-shortener/server/compress"
 	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
+	"github.com/MaximMNsk/go-url-shortener/server/grpcserver"
+	"github.com/MaximMNsk/go-url-shortener/server/openapi"
 	"github.com/MaximMNsk/go-url-shortener/server/server"
 	"github.com/go-chi/chi/v5"
+	"net"
 	"net/http"
+	"time"
 )
 
 /**
  * Request type handlers
  */
 
+func newRouter(newServ *server.Server) chi.Router {
+	router := chi.NewRouter()
+	router.Use(extlogger.Log,
+		compress.GzipHandler,
+		server.CORS(router),
+		auth.Handler,
+		openapi.Validator(server.MaxBatchBytes))
+	router.MethodNotAllowed(server.HandleMethodNotAllowed(router))
+	router.NotFound(newServ.HandleNotFound)
+	router.Route("/", func(r chi.Router) {
+		r.With(newServ.Idempotent).Post(`/`, newServ.HandlePOST)
+		r.With(newServ.Idempotent).Post(`/api/shorten`, newServ.HandleAPIShorten)
+		r.With(newServ.Idempotent).Post(`/api/shorten/batch`, newServ.HandleAPIBatch)
+		r.Get(`/api/openapi.json`, openapi.Handler)
+		r.Get(`/ping`, newServ.HandlePing)
+		r.Get(`/api/user/urls`, newServ.HandleUserURLs)
+		r.Delete(`/api/user/urls`, newServ.HandleDeleteUserURLs)
+		r.Get(`/api/user/urls/{id}/variants`, newServ.HandleVariants)
+		r.Put(`/api/user/urls/{id}/variants`, newServ.HandleSetVariants)
+		r.Patch(`/api/links/{id}`, newServ.HandlePatchLink)
+		r.Get(`/api/links/{id}/history`, newServ.HandleLinkHistory)
+		r.Post(`/api/links/{id}/rollback`, newServ.HandleRollback)
+		r.Get(`/api/qr/{id}`, newServ.HandleQR)
+		r.Post(`/api/import`, newServ.HandleImport)
+		r.Get(`/api/export`, newServ.HandleExport)
+		r.Get(`/api/templates`, newServ.HandleTemplates)
+		r.Post(`/api/workspaces`, newServ.HandleCreateWorkspace)
+		r.Get(`/api/workspaces`, newServ.HandleWorkspaces)
+		r.Get(`/api/workspaces/{id}`, newServ.HandleWorkspace)
+		r.Patch(`/api/workspaces/{id}`, newServ.HandlePatchWorkspace)
+		r.Delete(`/api/workspaces/{id}`, newServ.HandleDeleteWorkspace)
+		r.Get(`/api/workspaces/{id}/stats`, newServ.HandleWorkspaceStats)
+		r.Put(`/api/workspaces/{id}/members/{user}`, newServ.HandleSetMember)
+		r.Delete(`/api/workspaces/{id}/members/{user}`, newServ.HandleDeleteMember)
+		r.With(server.TrustedOnly).Put(`/api/templates/{name}`, newServ.HandleSetTemplate)
+		r.With(server.TrustedOnly).Delete(`/api/templates/{name}`, newServ.HandleDeleteTemplate)
+		r.Get(`/{query}`, newServ.HandleGET)
+		r.Head(`/{query}`, newServ.HandleGET)
+		r.Post(`/{query}`, newServ.HandleUnlock)
+		r.Route(`/api/internal`, func(r chi.Router) {
+			r.Use(server.TrustedOnly)
+			r.Get(`/stats`, newServ.HandleStats)
+			r.Get(`/health`, newServ.HandleHealthReport)
+			r.Get(`/webhooks`, newServ.HandleWebhooks)
+			r.Put(`/webhooks/{name}`, newServ.HandleSetWebhook)
+			r.Delete(`/webhooks/{name}`, newServ.HandleDeleteWebhook)
+			r.Get(`/deliveries`, newServ.HandleDeliveries)
+			r.Post(`/deliveries/{id}/retry`, newServ.HandleRetryDelivery)
+			r.Get(`/links/{id}`, newServ.HandleAdminLink)
+			r.Post(`/links/{id}/disable`, newServ.HandleAdminDisable)
+			r.Delete(`/links/{id}`, newServ.HandleAdminPurge)
+		})
+	})
+	return router
+}
+
 func main() {
 
 	logger.PrintLog(logger.INFO, "Start newServ")
@@ -25,6 +90,10 @@ func main() {
 	if err != nil {
 		logger.PrintLog(logger.FATAL, "Can't handle config. "+err.Error())
 	}
+	_, err = domains.Parse(conf.Final.Domains)
+	if err != nil {
+		logger.PrintLog(logger.FATAL, "Can't parse domains. "+err.Error())
+	}
 
 	if confModule.Config.Env.DB != `` || confModule.Config.Flag.DB != `` {
 		err := db.Connect()
@@ -43,19 +112,46 @@ func main() {
 	storage := server.InitStorage()
 	newServ := server.NewServ(conf, storage)
 
+	if confModule.Config.Final.FetchMetadata != "off" {
+		logger.PrintLog(logger.INFO, "Starting metadata fetcher")
+		newServ.Metadata = server.NewEnricher(storage, metadata.NewFetcher(nil))
+		newServ.Metadata.Run(context.Background(), server.MetadataWorkers)
+	}
+
+	logger.PrintLog(logger.INFO, "Starting webhook dispatcher")
+	newServ.Webhooks, err = server.NewDispatcher(storage, &http.Client{Timeout: 2 * server.WebhookTimeout})
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't load webhooks. "+err.Error())
+	}
+	newServ.Webhooks.Run(context.Background())
+
+	interval, err := time.ParseDuration(confModule.Config.Final.HealthCheck)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't parse health check interval. "+err.Error())
+	} else if interval > 0 {
+		logger.PrintLog(logger.INFO, "Starting link health checker")
+		checker := server.NewHealthChecker(storage, probe.NewProber(nil), interval, server.HealthWorkers)
+		checker.Run(context.Background())
+	}
+
 	logger.PrintLog(logger.INFO, "Declaring router")
 
-	newServ.Routers = chi.NewRouter().
-		With(extlogger.Log).
-		With(compress.GzipHandler).
-		With(server.HandleOther)
-	newServ.Routers.Route("/", func(r chi.Router) {
-		r.Post(`/`, newServ.HandlePOST)
-		r.Post(`/api/{query}`, newServ.HandleAPI)
-		r.Post(`/api/shorten/{query}`, newServ.HandleAPI)
-		r.Get(`/ping`, newServ.HandlePing)
-		r.Get(`/{query}`, newServ.HandleGET)
-	})
+	newServ.Routers = newRouter(&newServ)
+
+	logger.PrintLog(logger.INFO, "Starting gRPC server")
+
+	grpcServ := grpcserver.NewGRPCServer(&newServ)
+	listener, err := net.Listen("tcp", confModule.Config.Final.GRPCAddr)
+	if err != nil {
+		logger.PrintLog(logger.FATAL, "Can't listen gRPC address. "+err.Error())
+	}
+	go func() {
+		err := grpcServ.Serve(listener)
+		if err != nil {
+			logger.PrintLog(logger.ERROR, "gRPC server stopped. "+err.Error())
+		}
+	}()
+	defer grpcServ.GracefulStop()
 
 	logger.PrintLog(logger.INFO, "Starting newServ")
 
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/MaximMNsk/go-url-shortener/server/openapi"
 	"github.com/MaximMNsk/go-url-shortener/server/server"
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"io"
@@ -98,3 +101,315 @@ func Test_handleMainPage(t *testing.T) {
 		})
 	}
 }
+
+func Test_routesDocumented(t *testing.T) {
+	doc, err := openapi.Spec()
+	require.NoError(t, err)
+
+	serve := server.NewServ(confModule.Config, server.InitStorage())
+	err = chi.Walk(newRouter(&serve), func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		_, ok := doc.FindOperation(method, route)
+		assert.True(t, ok, "%s %s is not described in openapi.json", method, route)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func Test_routerSemantics(t *testing.T) {
+	confModule.Config.Final.CORSOrigins = "https://allowed.example"
+	serve := server.NewServ(confModule.Config, server.InitStorage())
+	router := newRouter(&serve)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://semantics.example")))
+	result := w.Result()
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	_ = result.Body.Close()
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+	id := string(body[strings.LastIndex(string(body), "/")+1:])
+
+	type want struct {
+		status    int
+		headers   map[string]string
+		emptyBody bool
+	}
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		want    want
+	}{
+		{
+			name:   "Unknown id",
+			method: http.MethodGet,
+			path:   "/unknownid",
+			want:   want{status: http.StatusNotFound},
+		},
+		{
+			name:   "Head on short link",
+			method: http.MethodHead,
+			path:   "/" + id,
+			want: want{
+				status:    http.StatusTemporaryRedirect,
+				headers:   map[string]string{"Location": "https://semantics.example"},
+				emptyBody: true,
+			},
+		},
+		{
+			name:   "Wrong method",
+			method: http.MethodPut,
+			path:   "/api/shorten",
+			want: want{
+				status:  http.StatusMethodNotAllowed,
+				headers: map[string]string{"Allow": "POST, OPTIONS"},
+			},
+		},
+		{
+			name:   "Preflight from allowed origin",
+			method: http.MethodOptions,
+			path:   "/api/shorten",
+			headers: map[string]string{
+				"Origin":                         "https://allowed.example",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "Content-Type",
+			},
+			want: want{
+				status: http.StatusNoContent,
+				headers: map[string]string{
+					"Access-Control-Allow-Origin":  "https://allowed.example",
+					"Access-Control-Allow-Methods": "POST, OPTIONS",
+					"Access-Control-Allow-Headers": "Content-Type",
+				},
+			},
+		},
+		{
+			name:   "Preflight from other origin",
+			method: http.MethodOptions,
+			path:   "/api/shorten",
+			headers: map[string]string{
+				"Origin":                        "https://other.example",
+				"Access-Control-Request-Method": "POST",
+			},
+			want: want{status: http.StatusForbidden},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.headers {
+				request.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.want.status, result.StatusCode)
+			for k, v := range tt.want.headers {
+				assert.Equal(t, v, result.Header.Get(k), k)
+			}
+			if tt.want.emptyBody {
+				resBody, err := io.ReadAll(result.Body)
+				require.NoError(t, err)
+				assert.Empty(t, resBody)
+			}
+		})
+	}
+}
+
+func Test_corsOrigins(t *testing.T) {
+	origins := confModule.Config.Final.CORSOrigins
+	confModule.Config.Final.CORSOrigins = "*, https://allowed.example"
+	defer func() { confModule.Config.Final.CORSOrigins = origins }()
+	serve := server.NewServ(confModule.Config, server.InitStorage())
+	router := newRouter(&serve)
+
+	tests := []struct {
+		name        string
+		origin      string
+		allow       string
+		credentials string
+	}{
+		{name: "Listed origin", origin: "https://allowed.example", allow: "https://allowed.example", credentials: "true"},
+		{name: "Any origin", origin: "https://other.example", allow: "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodOptions, "/api/shorten", nil)
+			request.Header.Set("Origin", tt.origin)
+			request.Header.Set("Access-Control-Request-Method", "POST")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, http.StatusNoContent, result.StatusCode)
+			assert.Equal(t, tt.allow, result.Header.Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.credentials, result.Header.Get("Access-Control-Allow-Credentials"))
+		})
+	}
+}
+
+func Test_redirectTypes(t *testing.T) {
+	serve := server.NewServ(confModule.Config, server.InitStorage())
+	router := newRouter(&serve)
+
+	tests := []struct {
+		name         string
+		body         string
+		status       int
+		cacheControl string
+	}{
+		{
+			name:         "Default redirect",
+			body:         `{"url":"https://redirect-default.example"}`,
+			status:       http.StatusTemporaryRedirect,
+			cacheControl: "private, no-cache",
+		},
+		{
+			name:         "Permanent redirect",
+			body:         `{"url":"https://redirect-permanent.example","redirect_type":301}`,
+			status:       http.StatusMovedPermanently,
+			cacheControl: "public, max-age=86400",
+		},
+		{
+			name:         "Permanent redirect with rules",
+			body:         `{"url":"https://redirect-rules.example","redirect_type":301,"rules":[{"device":"ios","target":"https://ios.example"}]}`,
+			status:       http.StatusMovedPermanently,
+			cacheControl: "private, no-cache",
+		},
+		{
+			name:         "Permanent redirect with variants",
+			body:         `{"url":"https://redirect-variants.example","redirect_type":308,"variants":[{"name":"a","target":"https://a.example","weight":1}]}`,
+			status:       http.StatusPermanentRedirect,
+			cacheControl: "private, no-cache",
+		},
+		{
+			name:         "Permanent redirect with expiry",
+			body:         `{"url":"https://redirect-expiry.example","redirect_type":301,"expires_at":"2100-01-01T00:00:00Z"}`,
+			status:       http.StatusMovedPermanently,
+			cacheControl: "private, no-cache",
+		},
+		{
+			name:         "Found redirect",
+			body:         `{"url":"https://redirect-found.example","redirect_type":302}`,
+			status:       http.StatusFound,
+			cacheControl: "private, no-cache",
+		},
+		{
+			name:   "Unsupported redirect",
+			body:   `{"url":"https://redirect-other.example","redirect_type":303}`,
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.body)))
+			result := w.Result()
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			_ = result.Body.Close()
+			if tt.status == http.StatusBadRequest {
+				assert.Equal(t, tt.status, result.StatusCode)
+				return
+			}
+			require.Equal(t, http.StatusCreated, result.StatusCode)
+
+			var resp struct {
+				Result string `json:"result"`
+			}
+			require.NoError(t, json.Unmarshal(body, &resp))
+			id := resp.Result[strings.LastIndex(resp.Result, "/")+1:]
+
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+id, nil))
+			result = w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.status, result.StatusCode)
+			assert.Equal(t, tt.cacheControl, result.Header.Get("Cache-Control"))
+		})
+	}
+}
+
+func Test_passthrough(t *testing.T) {
+	serve := server.NewServ(confModule.Config, server.InitStorage())
+	router := newRouter(&serve)
+
+	shorten := func(body string) string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body)))
+		result := w.Result()
+		defer result.Body.Close()
+		require.Equal(t, http.StatusCreated, result.StatusCode)
+		var resp struct {
+			Result string `json:"result"`
+		}
+		require.NoError(t, json.NewDecoder(result.Body).Decode(&resp))
+		return resp.Result[strings.LastIndex(resp.Result, "/"):]
+	}
+	passID := shorten(`{"url":"https://pass.example/base?a=1","passthrough":"override","pass_path":true}`)
+	plainID := shorten(`{"url":"https://plain.example/base"}`)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{
+			name:     "Query and sub-path",
+			method:   http.MethodGet,
+			path:     passID + "/extra/path?a=2",
+			status:   http.StatusTemporaryRedirect,
+			location: "https://pass.example/base/extra/path?a=2",
+		},
+		{
+			name:     "Head with sub-path",
+			method:   http.MethodHead,
+			path:     passID + "/extra",
+			status:   http.StatusTemporaryRedirect,
+			location: "https://pass.example/base/extra?a=1",
+		},
+		{
+			name:     "Query ignored without passthrough",
+			method:   http.MethodGet,
+			path:     plainID + "?a=2",
+			status:   http.StatusTemporaryRedirect,
+			location: "https://plain.example/base",
+		},
+		{
+			name:   "Sub-path without pass_path",
+			method: http.MethodGet,
+			path:   plainID + "/extra",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "Unknown api route",
+			method: http.MethodGet,
+			path:   "/api/unknown",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "Sub-path with other method",
+			method: http.MethodPost,
+			path:   passID + "/extra",
+			status: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.status, result.StatusCode)
+			assert.Equal(t, tt.location, result.Header.Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package model
+
+import "errors"
+
+type ErrorCode string
+
+const (
+	CodeInvalid       ErrorCode = "invalid_request"
+	CodeForbidden     ErrorCode = "forbidden"
+	CodeNotFound      ErrorCode = "not_found"
+	CodeConflict      ErrorCode = "conflict"
+	CodeGone          ErrorCode = "gone"
+	CodeTooLarge      ErrorCode = "too_large"
+	CodeUnprocessable ErrorCode = "unprocessable" // запрос противоречит ранее сохраненному
+	CodeUnavailable   ErrorCode = "unavailable"
+	CodeInternal      ErrorCode = "internal"
+)
+
+// Error ошибка хранилища или запроса с типизированным кодом. errors.Is сравнивает
+// ошибки по идентичности, класс ошибки проверяется через CodeOf
+type Error struct {
+	Code    ErrorCode
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func NewError(code ErrorCode, message string, err error) error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+var ErrNotFound = &Error{Code: CodeNotFound, Message: "link not found"}
+var ErrDisabled = &Error{Code: CodeGone, Message: "link disabled"}
+var ErrConflict = &Error{Code: CodeConflict, Message: "link already exists"}
+var ErrUnavailable = &Error{Code: CodeUnavailable, Message: "storage unavailable"}
+var ErrWorkspaceNotFound = &Error{Code: CodeNotFound, Message: "workspace not found"}
+
+// ErrIDTaken ид уже занят ссылкой с другим адресом
+var ErrIDTaken = &Error{Code: CodeInvalid, Message: "link id is already taken"}
+
+// ErrQuotaExceeded в пространстве ссылки уже столько активных ссылок, сколько разрешает квота
+var ErrQuotaExceeded = &Error{Code: CodeForbidden, Message: "workspace link quota exceeded"}
+
+// CodeOf возвращает код ошибки, для нетипизированных ошибок - CodeInternal
+func CodeOf(err error) ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeInternal
+}
@@ -1,10 +1,384 @@
 package model
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
 
 type Storable interface {
+	// Init задает ссылку, которую ищет Get. Остальные методы получают ид и пользователя
+	// аргументами и не зависят от Init, поэтому их можно звать из конкурентных запросов
 	Init(link, shortLink, id string, ctx context.Context)
 	Get() (string, error)
-	Set() error
-	BatchSet() ([]byte, error)
+	// Set сохраняет ссылку info.ID с адресом info.OriginalURL, настройками и владельцем info.UserID.
+	// Квота пространства ссылки проверяется вместе со вставкой, сверх нее - ErrQuotaExceeded
+	Set(info LinkInfo) error
+	// BatchSet сохраняет пачку batch ссылок пользователя userID и отдает статус каждого элемента.
+	// Уже сокращенный адрес не сохраняется повторно и вместе с ошибкой конфликта получает статус BatchExists.
+	// Элемент, чей ид занят ссылкой с другим адресом или который не входит в квоту пространства,
+	// получает статус BatchInvalid. С atomic при любом конфликте не сохраняется ничего, а ошибка
+	// пачки - ErrIDTaken или ErrQuotaExceeded
+	BatchSet(userID string, batch []byte, atomic bool) ([]byte, error)
+	Stats() (Stats, error)
+	Disable(id string) error
+	Purge(id string) error
+	UserLinks(userID string) ([]LinkInfo, error)
+	// ScanUserLinks по одной передает ссылки пользователя userID в fn, не собирая их в память.
+	// Ошибка fn прерывает обход и возвращается
+	ScanUserLinks(userID string, fn func(info LinkInfo) error) error
+	// SearchUserLinks возвращает страницу ссылок пользователя userID, подходящих под query
+	SearchUserLinks(userID string, query LinkQuery) (LinkPage, error)
+	// DeleteUserLinks помечает удаленными ссылки ids, которыми владеет userID, остальные пропускает
+	DeleteUserLinks(userID string, ids []string) error
+	Templates() ([]Template, error)
+	GetTemplate(name string) (Template, error)
+	SetTemplate(template Template) error
+	DeleteTemplate(name string) error
+	// UpdateOptions заменяет настройки ссылки id на options
+	UpdateOptions(id string, options LinkOptions) error
+	VariantHits(id string) (map[string]int, error)
+	// Edit меняет адрес ссылки id на link и ее настройки на options, прежняя версия уходит в историю
+	Edit(id, link string, options LinkOptions) error
+	History(id string) ([]LinkVersion, error)
+	Lookup(id string) (LinkInfo, error)
+	// Consume засчитывает переход по ссылке id, если лимит переходов не исчерпан
+	Consume(id string) error
+	RecordVariant(id, variant string) error
+	SetMetadata(id string, metadata Metadata) error
+	SetHealth(id string, health Health) error
+	ActiveLinks() ([]LinkInfo, error)
+	Webhooks() ([]Webhook, error)
+	SetWebhook(webhook Webhook) error
+	DeleteWebhook(name string) error
+	// SaveDelivery добавляет доставку или заменяет доставку с тем же ID
+	SaveDelivery(delivery Delivery) error
+	// Deliveries возвращает доставки в статусе status, пустой - все, от старых к новым
+	Deliveries(status string) ([]Delivery, error)
+	// PruneDeliveries удаляет доставки, доставленные раньше before
+	PruneDeliveries(before time.Time) error
+	// ReserveIdempotency сохраняет ключ, если у пользователя нет действующего ключа с тем же
+	// Key. Иначе возвращает сохраненный ключ вместе с ErrConflict
+	ReserveIdempotency(record Idempotency) (Idempotency, error)
+	// SaveIdempotency сохраняет ответ на запрос с ключом
+	SaveIdempotency(record Idempotency) error
+	// DeleteIdempotency освобождает ключ, запрос с ним выполнится заново
+	DeleteIdempotency(userID, key string) error
+	// Workspaces возвращает пространства, где участвует пользователь userID, по имени
+	Workspaces(userID string) ([]Workspace, error)
+	GetWorkspace(id string) (Workspace, error)
+	// SetWorkspace добавляет пространство или заменяет пространство с тем же ID
+	SetWorkspace(workspace Workspace) error
+	DeleteWorkspace(id string) error
+	// WorkspaceStats считает активные ссылки пространства и переходы по ним
+	WorkspaceStats(id string) (WorkspaceStats, error)
+}
+
+type Stats struct {
+	URLs  int `json:"urls"`
+	Users int `json:"users"`
+}
+
+// Статусы элементов пачки
+const (
+	BatchCreated = "created"
+	BatchExists  = "exists" // адрес уже сокращен, отдается короткий url сохраненной ссылки
+	BatchInvalid = "invalid"
+	BatchSkipped = "skipped" // элемент не сохранен, потому что не сохранилась вся пачка
+)
+
+// Режимы передачи параметров запроса в оригинальный url
+const (
+	PassthroughNone     = ""
+	PassthroughKeep     = "keep"     // при совпадении остается параметр оригинального url
+	PassthroughOverride = "override" // при совпадении побеждает параметр запроса
+	PassthroughAppend   = "append"   // сохраняются оба значения
+)
+
+// LinkOptions настройки ссылки, задаваемые при создании
+type LinkOptions struct {
+	RedirectType int    `json:"redirect_type,omitempty"`
+	Passthrough  string `json:"passthrough,omitempty"`
+	PassPath     bool   `json:"pass_path,omitempty"`
+	Template     string `json:"template,omitempty"`
+	// RawURL исходный url, если к нему применен шаблон, задается сервером
+	RawURL string `json:"raw_url,omitempty"`
+	Rules  []Rule `json:"rules,omitempty"`
+	// Variants варианты A/B теста, Sticky - как закрепить вариант за посетителем
+	Variants []Variant `json:"variants,omitempty"`
+	Sticky   string    `json:"sticky,omitempty"`
+	// Password приходит в запросе и заменяется сервером на PasswordHash (bcrypt)
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"`
+	// MaxClicks число редиректов, после которых ссылка перестает работать, 0 - без ограничения
+	MaxClicks int `json:"max_clicks,omitempty"`
+	// ExpiresAt время, после которого ссылка перестает работать
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Interstitial показывает страницу с предупреждением вместо редиректа
+	Interstitial bool `json:"interstitial,omitempty"`
+	// Tags метки ссылки для группировки и поиска
+	Tags []string `json:"tags,omitempty"`
+	// Folder папка ссылки, пустая - ссылка вне папок
+	Folder string `json:"folder,omitempty"`
+	// Domain короткий домен ссылки, пустой - домен по умолчанию. Ид уникальны в пределах
+	// домена, поэтому в хранилище ид ссылки другого домена идет вместе с доменом
+	Domain string `json:"domain,omitempty"`
+	// Workspace пространство, участники которого работают со ссылкой, пустое - ссылка личная
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// Способы закрепить вариант за посетителем
+const (
+	StickyNone   = "" // вариант выбирается на каждый запрос
+	StickyCookie = "cookie"
+	StickyIP     = "ip"
+)
+
+// Variant вариант редиректа с весом
+type Variant struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	Weight int    `json:"weight"`
+}
+
+// Классы устройств для правил редиректа
+const (
+	DeviceIOS     = "ios"
+	DeviceAndroid = "android"
+	DeviceMobile  = "mobile" // любое мобильное, в том числе ios и android
+	DeviceDesktop = "desktop"
+	DeviceBot     = "bot"
+)
+
+// Rule правило редиректа: если запрос подходит под все заданные условия,
+// редирект идет на Target. Правила проверяются по порядку
+type Rule struct {
+	Device   string `json:"device,omitempty"`
+	Language string `json:"language,omitempty"`
+	Country  string `json:"country,omitempty"`
+	// From и To задают окно времени по UTC в формате 15:04
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Target string `json:"target"`
+}
+
+// Template именованный набор параметров (utm-меток), дописываемых к url
+type Template struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params"`
+}
+
+type LinkInfo struct {
+	ID          string `json:"id"`
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	UserID      string `json:"user_id"`
+	Disabled    bool   `json:"is_disabled"`
+	Clicks      int    `json:"clicks"`
+	// CreatedAt может отсутствовать у ссылок, сохраненных до появления поля
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Metadata  *Metadata  `json:"metadata,omitempty"`
+	Health    *Health    `json:"health,omitempty"`
+	LinkOptions
+}
+
+// Metadata заголовок, описание и картинка страницы назначения, заполняются в фоне
+type Metadata struct {
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Image       string     `json:"image,omitempty"`
+	FetchedAt   *time.Time `json:"fetched_at,omitempty"`
+}
+
+// Health результат последней проверки адреса назначения. Status - код ответа,
+// 0 если ответа не было, Failures - число неудачных проверок подряд
+type Health struct {
+	Status    int        `json:"status,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	Failures  int        `json:"failures"`
+	Broken    bool       `json:"broken"`
+}
+
+// Сортировки ссылок пользователя, минус - по убыванию
+const (
+	SortNewest = "-created_at"
+	SortOldest = "created_at"
+	SortClicks = "-clicks"
+	SortFewest = "clicks"
+	SortURL    = "url"
+	SortURLRev = "-url"
+)
+
+// LinkQuery отбор ссылок пользователя, с Workspace - ссылок пространства. Пустые поля не
+// ограничивают выборку. Q - слова, каждое из которых должно встретиться в адресе, ид или
+// заголовке страницы без учета регистра. Cursor - продолжение предыдущей страницы из LinkPage.NextCursor
+type LinkQuery struct {
+	Workspace string
+	Tag       string
+	Folder    string
+	Q         string
+	Sort      string
+	Cursor    string
+	Limit     int
+}
+
+// LinkPage страница ссылок, пустой NextCursor - страница последняя
+type LinkPage struct {
+	Links      []LinkInfo
+	NextCursor string
+}
+
+// IsExpired сообщает, что срок действия ссылки истек
+func (info LinkInfo) IsExpired(now time.Time) bool {
+	return info.ExpiresAt != nil && !now.Before(*info.ExpiresAt)
+}
+
+// LinkVersion версия адреса ссылки. Edit сохраняет прежнюю версию в историю,
+// ReplacedAt - время, когда версию заменили
+type LinkVersion struct {
+	Version      int        `json:"version"`
+	URL          string     `json:"url"`
+	RawURL       string     `json:"raw_url,omitempty"`
+	RedirectType int        `json:"redirect_type,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	ReplacedAt   *time.Time `json:"replaced_at,omitempty"`
+}
+
+// Version возвращает текущую версию ссылки с номером number
+func (info LinkInfo) Version(number int) LinkVersion {
+	return LinkVersion{
+		Version:      number,
+		URL:          info.OriginalURL,
+		RawURL:       info.RawURL,
+		RedirectType: info.RedirectType,
+		ExpiresAt:    info.ExpiresAt,
+	}
+}
+
+// IsExhausted сообщает, что ссылка израсходовала лимит переходов
+func (info LinkInfo) IsExhausted() bool {
+	return info.MaxClicks > 0 && info.Clicks >= info.MaxClicks
+}
+
+// События жизненного цикла ссылки для вебхуков
+const (
+	EventLinkCreated = "link.created"
+	EventLinkDeleted = "link.deleted"
+	EventLinkExpired = "link.expired"
+	EventLinkClicked = "link.clicked"
+)
+
+// Webhook подписка на события. Пустой Events - подписка на все события,
+// Secret - ключ HMAC подписи тела запроса
+type Webhook struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events,omitempty"`
+}
+
+// Wants сообщает, что подписка ждет событие event
+func (w Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, v := range w.Events {
+		if v == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Статусы доставки вебхука
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead" // попытки кончились, доставка осталась в списке недоставленных
+)
+
+// Delivery доставка события одной подписке
+type Delivery struct {
+	ID          string          `json:"id"`
+	Webhook     string          `json:"webhook"`
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	NextAt      *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatus  int             `json:"last_status,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   *time.Time      `json:"created_at,omitempty"`
+	DeliveredAt *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// Idempotency ключ Idempotency-Key запроса пользователя. Hash - хэш запроса,
+// Status, ContentType и Body - сохраненный ответ, пока запрос выполняется, Status равен 0
+type Idempotency struct {
+	Key         string    `json:"key"`
+	UserID      string    `json:"user_id"`
+	Hash        string    `json:"hash"`
+	Status      int       `json:"status,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// IsExpired сообщает, что ключ больше не действует
+func (i Idempotency) IsExpired(now time.Time) bool {
+	return !now.Before(i.ExpiresAt)
+}
+
+// Роли участников пространства, от старшей к младшей
+const (
+	RoleOwner  = "owner"  // управляет участниками и настройками пространства
+	RoleEditor = "editor" // создает, меняет и удаляет ссылки
+	RoleViewer = "viewer" // видит ссылки и статистику
+)
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// IsRole сообщает, что role - одна из ролей участника
+func IsRole(role string) bool {
+	return roleRanks[role] > 0
+}
+
+// HasRole сообщает, что роль role дает права роли required
+func HasRole(role, required string) bool {
+	return IsRole(role) && roleRanks[role] >= roleRanks[required]
+}
+
+// Workspace пространство команды. Quota - предел активных ссылок, 0 - без ограничения.
+// RedirectType и Domain достаются новым ссылкам, для которых они не заданы в запросе
+type Workspace struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Quota        int        `json:"quota,omitempty"`
+	RedirectType int        `json:"redirect_type,omitempty"`
+	Domain       string     `json:"domain,omitempty"`
+	Members      []Member   `json:"members"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+}
+
+// Member участник пространства
+type Member struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// Role возвращает роль пользователя в пространстве, пустую, если он не участник
+func (w Workspace) Role(userID string) string {
+	for _, v := range w.Members {
+		if v.UserID == userID {
+			return v.Role
+		}
+	}
+	return ""
+}
+
+// WorkspaceStats активные ссылки пространства и переходы по ним
+type WorkspaceStats struct {
+	Links  int `json:"links"`
+	Clicks int `json:"clicks"`
 }
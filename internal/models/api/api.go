@@ -0,0 +1,179 @@
+package api
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"time"
+)
+
+/**
+ * Типы JSON API, описанные в server/openapi/openapi.json
+ */
+
+type ShortenRequest struct {
+	URL string `json:"url"`
+	model.LinkOptions
+}
+
+type ShortenResponse struct {
+	Result string `json:"result"`
+}
+
+type BatchRequestItem struct {
+	CorrelationID string `json:"correlation_id"`
+	OriginalURL   string `json:"original_url"`
+	model.LinkOptions
+}
+
+// BatchResponseItem результат элемента пачки, Status - один из model.Batch*
+type BatchResponseItem struct {
+	CorrelationID string `json:"correlation_id"`
+	ShortURL      string `json:"short_url"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+}
+
+// BatchError помечает элементы, отклоненные хранилищем с ошибкой из rejected, и возвращает
+// ошибку пачки: конфликт, если в ней есть уже сокращенные адреса, и ошибку отклоненного
+// элемента, если он есть в atomic пачке. Если atomic пачка не сохранена, элементы со статусом
+// created помечаются пропущенными
+func BatchError(items []BatchResponseItem, rejected []error, atomic bool) error {
+	var err error
+	for i, v := range items {
+		if rejected[i] != nil {
+			items[i] = BatchResponseItem{CorrelationID: v.CorrelationID, Status: model.BatchInvalid, Error: rejected[i].Error()}
+			if atomic {
+				err = rejected[i]
+			}
+			continue
+		}
+		if v.Status == model.BatchExists && err == nil {
+			err = model.ErrConflict
+		}
+	}
+	if err != nil && atomic {
+		for i := range items {
+			if items[i].Status == model.BatchCreated {
+				items[i].Status = model.BatchSkipped
+			}
+		}
+	}
+	return err
+}
+
+type UserURL struct {
+	ShortURL    string          `json:"short_url"`
+	OriginalURL string          `json:"original_url"`
+	Metadata    *model.Metadata `json:"metadata,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+	Folder      string          `json:"folder,omitempty"`
+}
+
+type VariantsRequest struct {
+	Sticky   string          `json:"sticky,omitempty"`
+	Variants []model.Variant `json:"variants"`
+}
+
+// LinkPatchRequest меняет только переданные поля
+type LinkPatchRequest struct {
+	URL          *string    `json:"url,omitempty"`
+	RedirectType *int       `json:"redirect_type,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	// NoExpiry снимает срок действия ссылки
+	NoExpiry bool `json:"no_expiry,omitempty"`
+	// Tags заменяет метки, пустой список их снимает
+	Tags   *[]string `json:"tags,omitempty"`
+	Folder *string   `json:"folder,omitempty"`
+}
+
+type RollbackRequest struct {
+	Version int `json:"version"`
+}
+
+type VariantsResponse struct {
+	Sticky   string          `json:"sticky,omitempty"`
+	Variants []model.Variant `json:"variants"`
+	Hits     map[string]int  `json:"hits"`
+}
+
+// HealthReportItem результат проверки адреса назначения, Health нет у непроверенных ссылок
+type HealthReportItem struct {
+	ID          string        `json:"id"`
+	ShortURL    string        `json:"short_url"`
+	OriginalURL string        `json:"original_url"`
+	Health      *model.Health `json:"health,omitempty"`
+}
+
+// WebhookEvent тело запроса вебхука
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Link      WebhookLink `json:"link"`
+}
+
+// WebhookLink ссылка в событии, Destination - адрес редиректа для link.clicked
+type WebhookLink struct {
+	ID          string `json:"id"`
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	Destination string `json:"destination,omitempty"`
+}
+
+// ImportItem строка импорта. ID принимается вместо Alias, чтобы можно было загрузить экспорт
+type ImportItem struct {
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias,omitempty"`
+	ID        string     `json:"id,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+	Folder    string     `json:"folder,omitempty"`
+	Domain    string     `json:"domain,omitempty"`
+}
+
+// ImportRow результат импорта строки, Row - номер записи без заголовка, с 1
+type ImportRow struct {
+	Row      int    `json:"row"`
+	Status   string `json:"status"`
+	ShortURL string `json:"short_url,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type ImportResponse struct {
+	Created int         `json:"created"`
+	Exists  int         `json:"exists"`
+	Failed  int         `json:"failed"`
+	Rows    []ImportRow `json:"rows"`
+}
+
+// ExportItem строка экспорта ссылок пользователя
+type ExportItem struct {
+	ID        string     `json:"id"`
+	ShortURL  string     `json:"short_url"`
+	URL       string     `json:"url"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+	Clicks    int        `json:"clicks"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Folder    string     `json:"folder,omitempty"`
+	Domain    string     `json:"domain,omitempty"`
+}
+
+// WorkspaceRequest создает пространство или меняет переданные поля
+type WorkspaceRequest struct {
+	Name         *string `json:"name,omitempty"`
+	Quota        *int    `json:"quota,omitempty"`
+	RedirectType *int    `json:"redirect_type,omitempty"`
+	Domain       *string `json:"domain,omitempty"`
+}
+
+type MemberRequest struct {
+	Role string `json:"role"`
+}
+
+// WorkspaceStatsResponse статистика пространства, Quota 0 - без ограничения
+type WorkspaceStatsResponse struct {
+	Links   int `json:"links"`
+	Clicks  int `json:"clicks"`
+	Members int `json:"members"`
+	Quota   int `json:"quota"`
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/storage/db"
+)
+
+const updateHealth = `
+update shortener.short_links set health = $2 where uid = $1`
+
+var selectActiveRows = `
+select uid, short_url, original_url, user_id, clicks, created_at, metadata, health, ` + optionColumns + ` from shortener.short_links
+where not is_disabled`
+
+func (jsonData *DBStorage) SetHealth(id string, health model.Health) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	tag, err := connection.Exec(context.Background(), updateHealth, id, health)
+	if err != nil {
+		return wrapPgError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+	return nil
+}
+
+func (jsonData *DBStorage) ActiveLinks() ([]model.LinkInfo, error) {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return nil, model.ErrUnavailable
+	}
+	rows, err := connection.Query(context.Background(), selectActiveRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []model.LinkInfo
+	for rows.Next() {
+		var info model.LinkInfo
+		err = rows.Scan(append([]any{&info.ID, &info.ShortURL, &info.OriginalURL, &info.UserID, &info.Clicks, &info.CreatedAt, &info.Metadata, &info.Health},
+			optionDest(&info.LinkOptions)...)...)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, info)
+	}
+	return links, rows.Err()
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/storage/db"
+)
+
+const createLinkHistoryTableQuery = `
+CREATE TABLE IF NOT EXISTS shortener.link_history
+	(
+	    uid text NOT NULL,
+	    version integer NOT NULL,
+	    original_url text NOT NULL,
+	    raw_url text NOT NULL DEFAULT '',
+	    redirect_type integer NOT NULL DEFAULT 0,
+	    expires_at timestamptz,
+	    replaced_at timestamptz NOT NULL DEFAULT now(),
+	    primary key (uid, version)
+	)`
+
+// Первичный ключ не даст двум конкурентным правкам записать одну версию
+const insertLinkHistory = `
+insert into shortener.link_history (uid, version, original_url, raw_url, redirect_type, expires_at)
+select uid, (select count(*) + 1 from shortener.link_history where uid = $1), original_url, raw_url, redirect_type, expires_at
+from shortener.short_links where uid = $1`
+
+// Метаданные и проверка прежнего адреса сбрасываются, новые появятся в фоне
+var editLink = `
+update shortener.short_links set (original_url, ` + optionColumns + `) = (` + placeholders(2, 1+optionCount) + `),
+	metadata = case when original_url = $2 then metadata end,
+	health = case when original_url = $2 then health end
+where uid = $1`
+
+const selectLinkHistory = `
+select version, original_url, raw_url, redirect_type, expires_at, replaced_at from shortener.link_history
+where uid = $1 order by version`
+
+func (jsonData *DBStorage) Edit(id, link string, options model.LinkOptions) error {
+
+	ctx := context.Background()
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	tx, err := connection.Begin(ctx)
+	if err != nil {
+		return wrapPgError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, insertLinkHistory, id)
+	if err != nil {
+		return wrapPgError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+	args := append([]any{id, link}, optionArgs(options)...)
+	_, err = tx.Exec(ctx, editLink, args...)
+	if err != nil {
+		return wrapPgError(err)
+	}
+	return tx.Commit(ctx)
+}
+
+func (jsonData *DBStorage) History(id string) ([]model.LinkVersion, error) {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return nil, model.ErrUnavailable
+	}
+	rows, err := connection.Query(context.Background(), selectLinkHistory, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []model.LinkVersion
+	for rows.Next() {
+		var v model.LinkVersion
+		err = rows.Scan(&v.Version, &v.URL, &v.RawURL, &v.RedirectType, &v.ExpiresAt, &v.ReplacedAt)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/storage/db"
+	"github.com/jackc/pgx/v5"
+)
+
+const createIdempotencyTableQuery = `
+CREATE TABLE IF NOT EXISTS shortener.idempotency_keys
+	(
+	    user_id text NOT NULL,
+	    key text NOT NULL,
+	    hash text NOT NULL,
+	    status integer NOT NULL DEFAULT 0,
+	    content_type text NOT NULL DEFAULT '',
+	    body bytea,
+	    expires_at timestamptz NOT NULL,
+	    primary key (user_id, key)
+	)`
+
+const createIdempotencyIndexQuery = `
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at
+ON shortener.idempotency_keys(expires_at)`
+
+const deleteExpiredIdempotency = `
+delete from shortener.idempotency_keys where expires_at <= now()`
+
+const insertIdempotency = `
+insert into shortener.idempotency_keys (user_id, key, hash, expires_at) values ($1, $2, $3, $4)
+on conflict (user_id, key) do nothing`
+
+const selectIdempotency = `
+select user_id, key, hash, status, content_type, body, expires_at
+from shortener.idempotency_keys where user_id = $1 and key = $2`
+
+const upsertIdempotency = `
+insert into shortener.idempotency_keys (user_id, key, hash, status, content_type, body, expires_at)
+values ($1, $2, $3, $4, $5, $6, $7)
+on conflict (user_id, key) do update set hash = excluded.hash, status = excluded.status,
+	content_type = excluded.content_type, body = excluded.body, expires_at = excluded.expires_at`
+
+const deleteIdempotency = `
+delete from shortener.idempotency_keys where user_id = $1 and key = $2`
+
+func (jsonData *DBStorage) ReserveIdempotency(record model.Idempotency) (model.Idempotency, error) {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return record, model.ErrUnavailable
+	}
+	ctx := context.Background()
+	_, err := connection.Exec(ctx, deleteExpiredIdempotency)
+	if err != nil {
+		return record, wrapPgError(err)
+	}
+	tag, err := connection.Exec(ctx, insertIdempotency, record.UserID, record.Key, record.Hash, record.ExpiresAt)
+	if err != nil {
+		return record, wrapPgError(err)
+	}
+	if tag.RowsAffected() > 0 {
+		return record, nil
+	}
+
+	var saved model.Idempotency
+	err = connection.QueryRow(ctx, selectIdempotency, record.UserID, record.Key).Scan(&saved.UserID, &saved.Key,
+		&saved.Hash, &saved.Status, &saved.ContentType, &saved.Body, &saved.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Ключ истек между вставкой и чтением
+		return jsonData.ReserveIdempotency(record)
+	}
+	if err != nil {
+		return record, wrapPgError(err)
+	}
+	return saved, model.ErrConflict
+}
+
+func (jsonData *DBStorage) SaveIdempotency(record model.Idempotency) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	_, err := connection.Exec(context.Background(), upsertIdempotency, record.UserID, record.Key, record.Hash,
+		record.Status, record.ContentType, record.Body, record.ExpiresAt)
+	return wrapPgError(err)
+}
+
+func (jsonData *DBStorage) DeleteIdempotency(userID, key string) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	_, err := connection.Exec(context.Background(), deleteIdempotency, userID, key)
+	return wrapPgError(err)
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/storage/db"
+)
+
+const updateMetadata = `
+update shortener.short_links set metadata = $2 where uid = $1`
+
+func (jsonData *DBStorage) SetMetadata(id string, metadata model.Metadata) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	tag, err := connection.Exec(context.Background(), updateMetadata, id, metadata)
+	if err != nil {
+		return wrapPgError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+	return nil
+}
@@ -4,19 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
 	"github.com/MaximMNsk/go-url-shortener/internal/storage/db"
 	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
-	"github.com/MaximMNsk/go-url-shortener/internal/util/shorter"
-	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type DBStorage struct {
 	Link      string `json:"original_url"`
 	ShortLink string `json:"short_url"`
 	ID        string `json:"correlation_id"`
+	Disabled  bool   `json:"-"`
 	Ctx       context.Context
 }
 
@@ -40,21 +46,138 @@ CREATE TABLE IF NOT EXISTS shortener.short_links
 	    uid text
 	)`
 
+// createIndexQuery адрес уникален в пределах домена
 const createIndexQuery = `
-CREATE UNIQUE INDEX IF NOT EXISTS unique_original_url
-ON shortener.short_links(original_url)`
+CREATE UNIQUE INDEX IF NOT EXISTS unique_domain_original_url
+ON shortener.short_links(domain, original_url)`
+
+// renameDuplicateIDsQuery до индекса по ид пачки могли сохранить ссылки с одинаковым ид на одном
+// домене. Первая ссылка сохраняет ид, остальные получают ид и короткий url с номером строки
+const renameDuplicateIDsQuery = `
+UPDATE shortener.short_links AS l
+SET uid = l.uid || '-' || l.id, short_url = l.short_url || '-' || l.id
+WHERE EXISTS (
+	SELECT 1 FROM shortener.short_links AS d
+	WHERE d.domain = l.domain AND d.uid = l.uid AND d.id < l.id
+)`
+
+// createIDIndexQuery ид уникален в пределах домена, в том числе ид из correlation_id пачки
+const createIDIndexQuery = `
+CREATE UNIQUE INDEX IF NOT EXISTS unique_domain_uid
+ON shortener.short_links(domain, uid)`
+
+// dropGlobalIndexQuery убирает индекс, по которому адрес был уникален среди всех доменов
+const dropGlobalIndexQuery = `
+DROP INDEX IF EXISTS shortener.unique_original_url`
+
+const alterTableQuery = `
+ALTER TABLE shortener.short_links
+	ADD COLUMN IF NOT EXISTS user_id text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS is_disabled boolean NOT NULL DEFAULT false,
+	ADD COLUMN IF NOT EXISTS redirect_type integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS passthrough text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS pass_path boolean NOT NULL DEFAULT false,
+	ADD COLUMN IF NOT EXISTS template text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS raw_url text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS rules jsonb NOT NULL DEFAULT '[]',
+	ADD COLUMN IF NOT EXISTS variants jsonb NOT NULL DEFAULT '[]',
+	ADD COLUMN IF NOT EXISTS sticky text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS password_hash text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS max_clicks integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS clicks integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS expires_at timestamptz,
+	ADD COLUMN IF NOT EXISTS created_at timestamptz,
+	ALTER COLUMN created_at SET DEFAULT now(),
+	ADD COLUMN IF NOT EXISTS interstitial boolean NOT NULL DEFAULT false,
+	ADD COLUMN IF NOT EXISTS metadata jsonb,
+	ADD COLUMN IF NOT EXISTS health jsonb,
+	ADD COLUMN IF NOT EXISTS tags jsonb NOT NULL DEFAULT '[]',
+	ADD COLUMN IF NOT EXISTS folder text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS domain text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS workspace text NOT NULL DEFAULT ''`
+
+// optionColumns колонки настроек ссылки, порядок совпадает с optionArgs и optionDest
+const optionColumns = `redirect_type, passthrough, pass_path, template, raw_url, rules, variants, sticky, password_hash, max_clicks, expires_at, interstitial, tags, folder, domain, workspace`
+
+var optionCount = len(optionArgs(model.LinkOptions{}))
+
+var insertLinkRow = `
+insert into shortener.short_links (original_url, short_url, uid, user_id, ` + optionColumns + `)
+values (` + placeholders(1, 4+optionCount) + `)
+on conflict do nothing`
+
+// createBatchTable временная таблица, куда пачка загружается через COPY
+const createBatchTable = `
+create temp table batch_links on commit drop as
+select original_url, short_url, uid, user_id, ` + optionColumns + ` from shortener.short_links with no data`
+
+var insertFromBatchTable = `
+insert into shortener.short_links (original_url, short_url, uid, user_id, ` + optionColumns + `)
+select original_url, short_url, uid, user_id, ` + optionColumns + ` from batch_links
+on conflict do nothing
+returning domain, original_url`
+
+const selectShortURLs = `
+select domain, original_url, short_url from shortener.short_links where original_url = any($1)`
+
+const selectTakenIDs = `
+select uid from shortener.short_links where uid = any($1)`
+
+// lockWorkspaceQuotas блокирует пространства до конца транзакции, поэтому параллельные
+// вставки в одно пространство считают его активные ссылки по очереди
+const lockWorkspaceQuotas = `
+select id, quota, (select count(*) from shortener.short_links where workspace = w.id and not is_disabled)
+from shortener.workspaces w where id = any($1) order by id for update`
+
+const selectURLExists = `
+select exists(select 1 from shortener.short_links where domain = $1 and original_url = $2)`
+
+// copyColumns колонки для COPY, порядок совпадает с insertLinkRow
+var copyColumns = func() []string {
+	columns := []string{"original_url", "short_url", "uid", "user_id"}
+	for _, column := range strings.Split(optionColumns, ",") {
+		columns = append(columns, strings.TrimSpace(column))
+	}
+	return columns
+}()
+
+const selectRow = `
+select uid, original_url, short_url, is_disabled from shortener.short_links where uid = $1 or original_url = $2`
 
-const insertLinkRow = `
-insert into shortener.short_links (original_url, short_url, uid) values ($1, $2, $3)`
+const selectStats = `
+select count(*), count(distinct nullif(user_id, '')) from shortener.short_links`
 
-const insertLinkRowBatch = `
+var selectLinkInfo = `
+select uid, short_url, original_url, user_id, is_disabled, clicks, created_at, metadata, health, ` + optionColumns + ` from shortener.short_links where uid = $1`
 
-insert into shortener.short_links (original_url, short_url, uid) values ($1, $2, $3)`
+const disableRow = `
+update shortener.short_links set is_disabled = true where uid = $1`
 
-const selectRow = `
-select uid, original_url, short_url from shortener.short_links where uid = $1 or original_url = $2`
+var selectLinkRows = `
+select uid, short_url, original_url, user_id, clicks, created_at, metadata, health, ` + optionColumns + ` from shortener.short_links`
+
+var selectUserRows = selectLinkRows + `
+where user_id = $1 and not is_disabled`
+
+// selectUserRowsPage страница ссылок пользователя после ссылки с временем создания $3 и ид $2,
+// первая страница выбирается с пустым $2
+var selectUserRowsPage = selectUserRows + `
+and ($2::text is null or (` + createdAtKey + `, uid) > ($3::timestamptz, $2))
+order by ` + createdAtKey + `, uid limit $4`
+
+// scanPageSize сколько ссылок ScanUserLinks читает за один запрос
+const scanPageSize = 500
 
-func PrepareDB(connect *pgx.Conn) {
+var selectWorkspaceRows = selectLinkRows + `
+where workspace = $1 and not is_disabled`
+
+const disableUserRows = `
+update shortener.short_links set is_disabled = true where user_id = $1 and uid = any($2)`
+
+const deleteRow = `
+delete from shortener.short_links where uid = $1`
+
+func PrepareDB(connect *pgxpool.Pool) {
 	_, err := connect.Exec(db.GetCtx(), createSchemaQuery)
 	if err != nil {
 		logger.PrintLog(logger.ERROR, "Can't create schema: "+err.Error())
@@ -67,17 +190,107 @@ func PrepareDB(connect *pgx.Conn) {
 		return
 	}
 
+	_, err = connect.Exec(db.GetCtx(), alterTableQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't alter table: "+err.Error())
+		return
+	}
+
 	_, err = connect.Exec(db.GetCtx(), createIndexQuery)
 	if err != nil {
 		logger.PrintLog(logger.ERROR, "Can't create index: "+err.Error())
 		return
 	}
+
+	tag, err := connect.Exec(db.GetCtx(), renameDuplicateIDsQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't rename duplicate ids: "+err.Error())
+	} else if tag.RowsAffected() > 0 {
+		logger.PrintLog(logger.WARN, "Renamed links with duplicate ids: "+strconv.FormatInt(tag.RowsAffected(), 10))
+	}
+
+	// Без индекса по ид остальные таблицы все равно нужны, поэтому ошибка не прерывает подготовку
+	_, err = connect.Exec(db.GetCtx(), createIDIndexQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't create id index: "+err.Error())
+	}
+
+	_, err = connect.Exec(db.GetCtx(), dropGlobalIndexQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't drop index: "+err.Error())
+		return
+	}
+
+	_, err = connect.Exec(db.GetCtx(), createTemplatesTableQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't create templates table: "+err.Error())
+		return
+	}
+
+	_, err = connect.Exec(db.GetCtx(), createVariantHitsTableQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't create variant hits table: "+err.Error())
+		return
+	}
+
+	_, err = connect.Exec(db.GetCtx(), createLinkHistoryTableQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't create link history table: "+err.Error())
+		return
+	}
+
+	_, err = connect.Exec(db.GetCtx(), createWebhooksTableQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't create webhooks table: "+err.Error())
+		return
+	}
+
+	_, err = connect.Exec(db.GetCtx(), createDeliveriesTableQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't create webhook deliveries table: "+err.Error())
+		return
+	}
+
+	_, err = connect.Exec(db.GetCtx(), createDeliveriesIndexQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't create webhook deliveries index: "+err.Error())
+		return
+	}
+
+	_, err = connect.Exec(db.GetCtx(), createIdempotencyTableQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't create idempotency keys table: "+err.Error())
+		return
+	}
+
+	_, err = connect.Exec(db.GetCtx(), createIdempotencyIndexQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't create idempotency keys index: "+err.Error())
+		return
+	}
+
+	_, err = connect.Exec(db.GetCtx(), createWorkspacesTableQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't create workspaces table: "+err.Error())
+		return
+	}
+
+	_, err = connect.Exec(db.GetCtx(), createWorkspaceLinksIndexQuery)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't create workspace links index: "+err.Error())
+		return
+	}
+
+	prepareSearch(connect)
 }
 
 func (jsonData *DBStorage) Get() (string, error) {
 
 	logger.PrintLog(logger.INFO, "Get from database")
 	row, err := getData(*jsonData)
+	if err == nil && row.Disabled {
+		return "", model.ErrDisabled
+	}
 	return row.Link, err
 
 }
@@ -92,106 +305,492 @@ func getData(data DBStorage) (DBStorage, error) {
 	connection := db.GetDB()
 	selected := DBStorage{}
 	if connection == nil {
-		return selected, errors.New("connection to DB not found")
+		return selected, model.ErrUnavailable
 	}
 	row := connection.QueryRow(ctx, selectRow, data.ID, data.Link)
-	err := row.Scan(&selected.ID, &selected.Link, &selected.ShortLink)
+	err := row.Scan(&selected.ID, &selected.Link, &selected.ShortLink, &selected.Disabled)
 	if err != nil {
 		logger.PrintLog(logger.WARN, "Select attention: "+err.Error())
 	}
 	return selected, nil
 }
 
-func (jsonData *DBStorage) Set() error {
+func (jsonData *DBStorage) Set(info model.LinkInfo) error {
 
 	logger.PrintLog(logger.INFO, "Set to database")
 
-	var err error
-	*jsonData, err = saveData(*jsonData)
+	err := saveData(info)
 	if err != nil {
 		logger.PrintLog(logger.ERROR, "Setter. Can't save. Error: "+err.Error())
 	}
 	return err
 }
 
-func saveData(data DBStorage) (DBStorage, error) {
-
-	var mx sync.Mutex
-	mx.Lock()
-	defer mx.Unlock()
+func saveData(info model.LinkInfo) error {
 
-	ctx := data.Ctx
+	ctx := context.Background()
 	connection := db.GetDB()
 	if connection == nil {
-		return DBStorage{}, errors.New("connection to DB not found")
+		return model.ErrUnavailable
+	}
+
+	args := append([]any{info.OriginalURL, info.ShortURL, info.ID, info.UserID}, optionArgs(info.LinkOptions)...)
+	if info.Workspace != "" {
+		// Квота пространства проверяется в транзакции вставки
+		existing, rejected, err := insertLinks(ctx, connection, [][]any{args}, true)
+		if err != nil {
+			return wrapPgError(err)
+		}
+		if existing[0] != "" {
+			return model.ErrConflict
+		}
+		return rejected[0]
+	}
+	tag, err := connection.Exec(ctx, insertLinkRow, args...)
+	if err != nil {
+		logger.PrintLog(logger.WARN, "Insert attention: "+err.Error())
+		return wrapPgError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		// Строку не вставил либо сохраненный адрес, либо занятый ид
+		var exists bool
+		err = connection.QueryRow(ctx, selectURLExists, info.Domain, info.OriginalURL).Scan(&exists)
+		if err != nil {
+			return wrapPgError(err)
+		}
+		if !exists {
+			return model.ErrIDTaken
+		}
+		return model.ErrConflict
 	}
+	return nil
+}
+
+const uniqueViolation = `23505`
 
-	_, err := connection.Exec(ctx, insertLinkRow, data.Link, data.ShortLink, data.ID)
+// wrapPgError переводит ошибки postgres в типизированные ошибки хранилища
+func wrapPgError(err error) error {
 	var pgErr *pgconn.PgError
-	errors.As(err, &pgErr)
+	if errors.As(err, &pgErr) && pgErr.SQLState() == uniqueViolation {
+		return model.NewError(model.CodeConflict, "link already exists", err)
+	}
+	if pgconn.Timeout(err) || pgconn.SafeToRetry(err) {
+		return model.NewError(model.CodeUnavailable, "storage unavailable", err)
+	}
+	return err
+}
 
-	if pgErr != nil {
-		logger.PrintLog(logger.WARN, "Insert attention: "+err.Error())
-		return data, pgErr
+func (jsonData *DBStorage) BatchSet(userID string, batch []byte, atomic bool) ([]byte, error) {
+
+	var batchData []api.BatchRequestItem
+	err := json.Unmarshal(batch, &batchData)
+	if err != nil {
+		return nil, model.NewError(model.CodeInvalid, "invalid batch", err)
+	}
+
+	///////// Current logic
+	connection := db.GetDB()
+	if connection == nil {
+		return nil, model.ErrUnavailable
+	}
+
+	outputData := make([]api.BatchResponseItem, 0, len(batchData))
+	rows := make([][]any, 0, len(batchData))
+	for _, v := range batchData {
+		key := domains.Key(v.Domain, v.CorrelationID)
+		shortLink := domains.ShortURL(key)
+		outputData = append(outputData, api.BatchResponseItem{ShortURL: shortLink, CorrelationID: v.CorrelationID, Status: model.BatchCreated})
+		rows = append(rows, append([]any{v.OriginalURL, shortLink, key, userID}, optionArgs(v.LinkOptions)...))
+	}
+
+	existing, rejected, err := insertLinks(context.Background(), connection, rows, atomic)
+	if err != nil {
+		return nil, wrapPgError(err)
+	}
+	//////// End logic
+
+	for i := range outputData {
+		if existing[i] != "" {
+			outputData[i].ShortURL = existing[i]
+			outputData[i].Status = model.BatchExists
+		}
+	}
+	batchErr := api.BatchError(outputData, rejected, atomic)
+
+	JSONResp, err := json.Marshal(outputData)
+	if err != nil {
+		logger.PrintLog(logger.WARN, err.Error())
+		return nil, err
 	}
-	return data, nil
+	return JSONResp, batchErr
 }
 
-type outputBatch struct {
-	CorrelationID string `json:"correlation_id"`
-	ShortURL      string `json:"short_url"`
+// insertLinks сохраняет строки insertLinkRow с еще не сохраненными адресами. Для каждой
+// строки возвращается короткий url ссылки, уже сохраненной с тем же адресом на том же домене, в том числе
+// раньше в этой же пачке, или пустая строка, если строка добавлена. rejected - ошибка строки, чей ид
+// уже занят ссылкой с другим адресом или чье пространство исчерпало квоту. Квота считается в той же
+// транзакции под блокировкой пространства. Пачка грузится через COPY во временную таблицу и переносится
+// одним insert с on conflict, так что ссылки, сохраненные параллельно, тоже не дают ошибку.
+// С atomic при любом совпадении транзакция откатывается
+func insertLinks(ctx context.Context, connection *pgxpool.Pool, rows [][]any, atomic bool) (existing []string, rejected []error, err error) {
+	tx, err := connection.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	links := make([]string, 0, len(rows))
+	urls := make([]string, 0, len(rows))
+	keys := make([]string, 0, len(rows))
+	for _, row := range rows {
+		links = append(links, rowURLKey(row))
+		urls = append(urls, row[0].(string))
+		keys = append(keys, row[2].(string))
+	}
+	quotas, err := workspaceQuotas(ctx, tx, rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	saved, err := shortURLs(ctx, tx, urls)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids, err := takenIDs(ctx, tx, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	existing = make([]string, len(rows))
+	rejected = make([]error, len(rows))
+	toCopy := make([][]any, 0, len(rows))
+	for i, row := range rows {
+		if shortLink, ok := saved[links[i]]; ok {
+			existing[i] = shortLink
+			continue
+		}
+		if ids[keys[i]] {
+			rejected[i] = model.ErrIDTaken
+			continue
+		}
+		if quota, ok := quotas[rowWorkspace(row)]; ok {
+			if quota.limit > 0 && quota.links >= quota.limit {
+				rejected[i] = model.ErrQuotaExceeded
+				continue
+			}
+			quota.links++
+			quotas[rowWorkspace(row)] = quota
+		}
+		saved[links[i]] = row[1].(string)
+		ids[keys[i]] = true
+		toCopy = append(toCopy, row)
+	}
+	if len(toCopy) == 0 || atomic && len(toCopy) < len(rows) {
+		return existing, rejected, nil
+	}
+
+	_, err = tx.Exec(ctx, createBatchTable)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"batch_links"}, copyColumns, pgx.CopyFromRows(toCopy))
+	if err != nil {
+		return nil, nil, err
+	}
+	inserted, err := tx.Query(ctx, insertFromBatchTable)
+	if err != nil {
+		return nil, nil, err
+	}
+	added := make(map[string]bool, len(toCopy))
+	for inserted.Next() {
+		var domain, link string
+		err = inserted.Scan(&domain, &link)
+		if err != nil {
+			inserted.Close()
+			return nil, nil, err
+		}
+		added[urlKey(domain, link)] = true
+	}
+	inserted.Close()
+	if inserted.Err() != nil {
+		return nil, nil, inserted.Err()
+	}
+
+	// Ссылки, которые успели сохранить параллельно. Строка без сохраненного адреса
+	// не вставлена из-за ид, занятого параллельно
+	if len(added) < len(toCopy) {
+		var raced []string
+		for _, row := range toCopy {
+			if !added[rowURLKey(row)] {
+				raced = append(raced, row[0].(string))
+			}
+		}
+		saved, err = shortURLs(ctx, tx, raced)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, link := range links {
+			if existing[i] != "" || rejected[i] != nil || added[link] {
+				continue
+			}
+			existing[i] = saved[link]
+			if existing[i] == "" {
+				rejected[i] = model.ErrIDTaken
+			}
+		}
+		if atomic {
+			return existing, rejected, nil
+		}
+	}
+	return existing, rejected, tx.Commit(ctx)
 }
 
-func (jsonData *DBStorage) BatchSet() ([]byte, error) {
+// workspaceQuota квота пространства и число его активных ссылок
+type workspaceQuota struct {
+	limit int
+	links int
+}
 
-	var mx sync.Mutex
-	mx.Lock()
-	defer mx.Unlock()
+// workspaceQuotas блокирует пространства строк rows и возвращает их квоты
+func workspaceQuotas(ctx context.Context, tx pgx.Tx, rows [][]any) (map[string]workspaceQuota, error) {
+	var workspaces []string
+	for _, row := range rows {
+		if rowWorkspace(row) != "" {
+			workspaces = append(workspaces, rowWorkspace(row))
+		}
+	}
+	quotas := make(map[string]workspaceQuota, len(workspaces))
+	if len(workspaces) == 0 {
+		return quotas, nil
+	}
+	locked, err := tx.Query(ctx, lockWorkspaceQuotas, workspaces)
+	if err != nil {
+		return nil, err
+	}
+	defer locked.Close()
+	for locked.Next() {
+		var id string
+		var quota workspaceQuota
+		err = locked.Scan(&id, &quota.limit, &quota.links)
+		if err != nil {
+			return nil, err
+		}
+		quotas[id] = quota
+	}
+	return quotas, locked.Err()
+}
 
-	var savingData []DBStorage
-	var outputData []outputBatch
+// shortURLs возвращает короткие url сохраненных ссылок по адресам с доменом из urlKey
+func shortURLs(ctx context.Context, tx pgx.Tx, links []string) (map[string]string, error) {
+	rows, err := tx.Query(ctx, selectShortURLs, links)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	saved := make(map[string]string, len(links))
+	for rows.Next() {
+		var domain, link, shortLink string
+		err = rows.Scan(&domain, &link, &shortLink)
+		if err != nil {
+			return nil, err
+		}
+		saved[urlKey(domain, link)] = shortLink
+	}
+	return saved, rows.Err()
+}
 
-	err := json.Unmarshal([]byte(jsonData.Link), &savingData)
+// takenIDs возвращает ид из ids, которые уже заняты
+func takenIDs(ctx context.Context, tx pgx.Tx, ids []string) (map[string]bool, error) {
+	rows, err := tx.Query(ctx, selectTakenIDs, ids)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	taken := make(map[string]bool, len(ids))
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		taken[id] = true
+	}
+	return taken, rows.Err()
+}
+
+// urlKey адрес вместе с доменом, адрес уникален в пределах домена
+func urlKey(domain, link string) string {
+	return domain + "\n" + link
+}
+
+// rowURLKey urlKey строки insertLinkRow, домен - предпоследняя из колонок настроек
+func rowURLKey(row []any) string {
+	return urlKey(row[len(row)-2].(string), row[0].(string))
+}
 
-	for i, v := range savingData {
-		shortLink := shorter.GetShortURL(confModule.Config.Final.ShortURLAddr, v.ID)
+// rowWorkspace пространство строки insertLinkRow, последняя из колонок настроек
+func rowWorkspace(row []any) string {
+	return row[len(row)-1].(string)
+}
 
-		savingData[i].ID = v.ID
-		savingData[i].ShortLink = shortLink
-		savingData[i].Link = v.Link
+func (jsonData *DBStorage) Stats() (model.Stats, error) {
 
-		outputData = append(outputData, outputBatch{ShortURL: shortLink, CorrelationID: v.ID})
+	var stats model.Stats
+	connection := db.GetDB()
+	if connection == nil {
+		return stats, model.ErrUnavailable
 	}
+	err := connection.QueryRow(context.Background(), selectStats).Scan(&stats.URLs, &stats.Users)
+	return stats, err
+}
 
-	///////// Current logic
+func (jsonData *DBStorage) Lookup(id string) (model.LinkInfo, error) {
+
+	var info model.LinkInfo
 	connection := db.GetDB()
 	if connection == nil {
-		return nil, errors.New("connection to DB not found")
+		return info, model.ErrUnavailable
+	}
+	dest := append([]any{&info.ID, &info.ShortURL, &info.OriginalURL, &info.UserID, &info.Disabled, &info.Clicks, &info.CreatedAt, &info.Metadata, &info.Health},
+		optionDest(&info.LinkOptions)...)
+	err := connection.QueryRow(context.Background(), selectLinkInfo, id).Scan(dest...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return info, model.ErrNotFound
 	}
+	return info, err
+}
+
+func (jsonData *DBStorage) Disable(id string) error {
+	return execByID(context.Background(), disableRow, id)
+}
+
+func (jsonData *DBStorage) Purge(id string) error {
+	return execByID(context.Background(), deleteRow, id)
+}
+
+func execByID(ctx context.Context, query, id string) error {
 
-	batch := pgx.Batch{}
-	for _, v := range savingData {
-		batch.Queue(insertLinkRowBatch, v.Link, v.ShortLink, v.ID)
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	tag, err := connection.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return model.ErrNotFound
 	}
-	br := connection.SendBatch(jsonData.Ctx, &batch)
-	defer br.Close()
-	_, err = br.Exec()
+	return nil
+}
 
-	var pgErr *pgconn.PgError
-	errors.As(err, &pgErr)
-	//////// End logic
+func (jsonData *DBStorage) UserLinks(userID string) ([]model.LinkInfo, error) {
 
-	JSONResp, err := json.Marshal(outputData)
+	var links []model.LinkInfo
+	err := jsonData.ScanUserLinks(userID, func(info model.LinkInfo) error {
+		links = append(links, info)
+		return nil
+	})
+	return links, err
+}
+
+// ScanUserLinks читает ссылки страницами по времени создания и ид, так что соединение из пула
+// не остается занятым, пока fn передает ссылки медленному клиенту
+func (jsonData *DBStorage) ScanUserLinks(userID string, fn func(info model.LinkInfo) error) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	var lastID *string
+	lastCreatedAt := time.Unix(0, 0).UTC()
+	for {
+		page, err := userLinksPage(context.Background(), connection, userID, lastID, lastCreatedAt)
+		if err != nil {
+			return err
+		}
+		for _, info := range page {
+			err = fn(info)
+			if err != nil {
+				return err
+			}
+		}
+		if len(page) < scanPageSize {
+			return nil
+		}
+		last := page[len(page)-1]
+		lastID = &last.ID
+		lastCreatedAt = time.Unix(0, 0).UTC()
+		if last.CreatedAt != nil {
+			lastCreatedAt = *last.CreatedAt
+		}
+	}
+}
+
+// userLinksPage читает страницу selectUserRowsPage и сразу отдает соединение в пул
+func userLinksPage(ctx context.Context, connection *pgxpool.Pool, userID string, lastID *string, lastCreatedAt time.Time) ([]model.LinkInfo, error) {
+	rows, err := connection.Query(ctx, selectUserRowsPage, userID, lastID, lastCreatedAt, scanPageSize)
 	if err != nil {
-		logger.PrintLog(logger.WARN, err.Error())
 		return nil, err
 	}
-	if pgErr != nil {
-		return JSONResp, pgErr
+	defer rows.Close()
+
+	page := make([]model.LinkInfo, 0, scanPageSize)
+	for rows.Next() {
+		info, err := scanUserRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, info)
 	}
+	return page, rows.Err()
+}
+
+// scanUserRow читает ссылку, выбранную запросом selectUserRows
+func scanUserRow(rows pgx.Rows) (model.LinkInfo, error) {
+	var info model.LinkInfo
+	err := rows.Scan(append([]any{&info.ID, &info.ShortURL, &info.OriginalURL, &info.UserID, &info.Clicks, &info.CreatedAt, &info.Metadata, &info.Health},
+		optionDest(&info.LinkOptions)...)...)
+	return info, err
+}
 
-	return JSONResp, nil
+func (jsonData *DBStorage) DeleteUserLinks(userID string, ids []string) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	_, err := connection.Exec(context.Background(), disableUserRows, userID, ids)
+	return err
+}
+
+func optionArgs(options model.LinkOptions) []any {
+	return []any{options.RedirectType, options.Passthrough, options.PassPath, options.Template, options.RawURL,
+		jsonValue(options.Rules), jsonValue(options.Variants), options.Sticky, options.PasswordHash, options.MaxClicks, options.ExpiresAt,
+		options.Interstitial, jsonValue(options.Tags), options.Folder, options.Domain, options.Workspace}
+}
+
+func optionDest(options *model.LinkOptions) []any {
+	return []any{&options.RedirectType, &options.Passthrough, &options.PassPath, &options.Template, &options.RawURL,
+		&options.Rules, &options.Variants, &options.Sticky, &options.PasswordHash, &options.MaxClicks, &options.ExpiresAt,
+		&options.Interstitial, &options.Tags, &options.Folder, &options.Domain, &options.Workspace}
+}
+
+// jsonValue готовит список для jsonb колонки, пустой список сохраняется как []
+func jsonValue(value any) []byte {
+	data, err := json.Marshal(value)
+	if err != nil || string(data) == "null" {
+		return []byte("[]")
+	}
+	return data
+}
+
+// placeholders возвращает параметры запроса $from, ..., $(from+count-1)
+func placeholders(from, count int) string {
+	params := make([]string, 0, count)
+	for i := from; i < from+count; i++ {
+		params = append(params, "$"+strconv.Itoa(i))
+	}
+	return strings.Join(params, ", ")
 }
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/storage/db"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/search"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strconv"
+	"strings"
+)
+
+// searchText текст, в котором ищутся слова запроса: адрес, ид и заголовок страницы
+const searchText = `lower(original_url || ' ' || coalesce(uid, '') || ' ' || coalesce(metadata->>'title', ''))`
+
+// createdAtKey время создания для сортировки, ссылки без него идут как созданные в начале эпохи
+const createdAtKey = `coalesce(created_at, 'epoch'::timestamptz)`
+
+const createTrigramExtensionQuery = `
+CREATE EXTENSION IF NOT EXISTS pg_trgm`
+
+// createSearchIndexQuery позволяет искать подстроку через like без перебора таблицы
+const createSearchIndexQuery = `
+CREATE INDEX IF NOT EXISTS short_links_search
+ON shortener.short_links USING gin ((` + searchText + `) gin_trgm_ops)`
+
+const createTagsIndexQuery = `
+CREATE INDEX IF NOT EXISTS short_links_tags
+ON shortener.short_links USING gin (tags)`
+
+const createUserCreatedIndexQuery = `
+CREATE INDEX IF NOT EXISTS short_links_user_created
+ON shortener.short_links (user_id, (` + createdAtKey + `), uid)`
+
+const createUserFolderIndexQuery = `
+CREATE INDEX IF NOT EXISTS short_links_user_folder
+ON shortener.short_links (user_id, folder)`
+
+// sortKeys выражения полей сортировки
+var sortKeys = map[string]string{
+	search.FieldCreatedAt: createdAtKey,
+	search.FieldClicks:    `clicks`,
+	search.FieldURL:       `original_url`,
+}
+
+// prepareSearch создает индексы поиска. Без расширения pg_trgm поиск работает
+// перебором, поэтому его ошибка не прерывает подготовку базы
+func prepareSearch(connect *pgxpool.Pool) {
+	for _, query := range []string{createTagsIndexQuery, createUserCreatedIndexQuery, createUserFolderIndexQuery} {
+		_, err := connect.Exec(db.GetCtx(), query)
+		if err != nil {
+			logger.PrintLog(logger.ERROR, "Can't create link search index: "+err.Error())
+			return
+		}
+	}
+
+	_, err := connect.Exec(db.GetCtx(), createTrigramExtensionQuery)
+	if err == nil {
+		_, err = connect.Exec(db.GetCtx(), createSearchIndexQuery)
+	}
+	if err != nil {
+		logger.PrintLog(logger.WARN, "Can't create trigram index, search will scan links: "+err.Error())
+	}
+}
+
+// likePattern шаблон like для поиска подстроки word
+func likePattern(word string) string {
+	word = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(word)
+	return "%" + word + "%"
+}
+
+// searchQuery собирает запрос страницы ссылок пользователя и его параметры,
+// а если в query задано пространство - страницы ссылок пространства
+func searchQuery(userID string, query model.LinkQuery) (string, []any, error) {
+	field, desc, err := search.ParseSort(query.Sort)
+	if err != nil {
+		return "", nil, err
+	}
+	sql := new(strings.Builder)
+	args := []any{userID}
+	if query.Workspace == "" {
+		sql.WriteString(selectUserRows + ` and workspace = ''`)
+	} else {
+		sql.WriteString(selectWorkspaceRows)
+		args = []any{query.Workspace}
+	}
+	param := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if query.Tag != "" {
+		sql.WriteString(` and tags ? ` + param(query.Tag))
+	}
+	if query.Folder != "" {
+		sql.WriteString(` and folder = ` + param(query.Folder))
+	}
+	if terms := search.Terms(query.Q); len(terms) > 0 {
+		patterns := make([]string, 0, len(terms))
+		for _, term := range terms {
+			patterns = append(patterns, likePattern(term))
+		}
+		sql.WriteString(` and ` + searchText + ` like all(` + param(patterns) + `)`)
+	}
+
+	direction, compare := ` asc`, ` > `
+	if desc {
+		direction, compare = ` desc`, ` < `
+	}
+	key := sortKeys[field]
+	if query.Cursor != "" {
+		sort := query.Sort
+		if sort == "" {
+			sort = model.SortNewest
+		}
+		cursor, err := search.DecodeCursor(query.Cursor, sort)
+		if err != nil {
+			return "", nil, err
+		}
+		value, err := cursor.Arg(field)
+		if err != nil {
+			return "", nil, err
+		}
+		sql.WriteString(` and (` + key + `, uid)` + compare + `(` + param(value) + `, ` + param(cursor.ID) + `)`)
+	}
+
+	sql.WriteString(`
+order by ` + key + direction + `, uid` + direction)
+	if query.Limit > 0 {
+		// Лишняя ссылка показывает, что есть следующая страница
+		sql.WriteString(` limit ` + param(query.Limit+1))
+	}
+	return sql.String(), args, nil
+}
+
+func (jsonData *DBStorage) SearchUserLinks(userID string, query model.LinkQuery) (model.LinkPage, error) {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.LinkPage{}, model.ErrUnavailable
+	}
+	sql, args, err := searchQuery(userID, query)
+	if err != nil {
+		return model.LinkPage{}, err
+	}
+	rows, err := connection.Query(context.Background(), sql, args...)
+	if err != nil {
+		return model.LinkPage{}, wrapPgError(err)
+	}
+	defer rows.Close()
+
+	var page model.LinkPage
+	for rows.Next() {
+		info, err := scanUserRow(rows)
+		if err != nil {
+			return model.LinkPage{}, err
+		}
+		page.Links = append(page.Links, info)
+	}
+	if rows.Err() != nil {
+		return model.LinkPage{}, rows.Err()
+	}
+	if query.Limit > 0 && len(page.Links) > query.Limit {
+		page.Links = page.Links[:query.Limit]
+		page.NextCursor = search.NextCursor(page.Links[query.Limit-1], query.Sort)
+	}
+	return page, nil
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/storage/db"
+	"github.com/jackc/pgx/v5"
+)
+
+const createTemplatesTableQuery = `
+CREATE TABLE IF NOT EXISTS shortener.templates
+	(
+	    name text primary key,
+	    params jsonb NOT NULL DEFAULT '{}'
+	)`
+
+const selectTemplates = `
+select name, params from shortener.templates order by name`
+
+const selectTemplate = `
+select name, params from shortener.templates where name = $1`
+
+const upsertTemplate = `
+insert into shortener.templates (name, params) values ($1, $2)
+on conflict (name) do update set params = excluded.params`
+
+const deleteTemplate = `
+delete from shortener.templates where name = $1`
+
+func (jsonData *DBStorage) Templates() ([]model.Template, error) {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return nil, model.ErrUnavailable
+	}
+	rows, err := connection.Query(context.Background(), selectTemplates)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []model.Template
+	for rows.Next() {
+		var template model.Template
+		err = rows.Scan(&template.Name, &template.Params)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+func (jsonData *DBStorage) GetTemplate(name string) (model.Template, error) {
+
+	var template model.Template
+	connection := db.GetDB()
+	if connection == nil {
+		return template, model.ErrUnavailable
+	}
+	err := connection.QueryRow(context.Background(), selectTemplate, name).Scan(&template.Name, &template.Params)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return template, model.ErrNotFound
+	}
+	return template, err
+}
+
+func (jsonData *DBStorage) SetTemplate(template model.Template) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	_, err := connection.Exec(context.Background(), upsertTemplate, template.Name, template.Params)
+	return wrapPgError(err)
+}
+
+func (jsonData *DBStorage) DeleteTemplate(name string) error {
+	return execByID(context.Background(), deleteTemplate, name)
+}
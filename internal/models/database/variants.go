@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/storage/db"
+	"github.com/jackc/pgx/v5"
+)
+
+const createVariantHitsTableQuery = `
+CREATE TABLE IF NOT EXISTS shortener.variant_hits
+	(
+	    uid text,
+	    variant text,
+	    hits integer NOT NULL DEFAULT 0,
+	    primary key (uid, variant)
+	)`
+
+var updateOptions = `
+update shortener.short_links set (` + optionColumns + `) = (` + placeholders(2, optionCount) + `) where uid = $1`
+
+// consumeClick засчитывает переход одним запросом, поэтому конкурентные
+// редиректы не превысят лимит
+const consumeClick = `
+update shortener.short_links set clicks = clicks + 1
+where uid = $1 and not is_disabled and (max_clicks = 0 or clicks < max_clicks)
+returning clicks`
+
+const selectExists = `
+select true from shortener.short_links where uid = $1`
+
+const incrementVariantHits = `
+insert into shortener.variant_hits (uid, variant, hits) values ($1, $2, 1)
+on conflict (uid, variant) do update set hits = shortener.variant_hits.hits + 1`
+
+const selectVariantHits = `
+select variant, hits from shortener.variant_hits where uid = $1`
+
+func (jsonData *DBStorage) UpdateOptions(id string, options model.LinkOptions) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	args := append([]any{id}, optionArgs(options)...)
+	tag, err := connection.Exec(context.Background(), updateOptions, args...)
+	if err != nil {
+		return wrapPgError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+	return nil
+}
+
+func (jsonData *DBStorage) Consume(id string) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	var clicks int
+	err := connection.QueryRow(context.Background(), consumeClick, id).Scan(&clicks)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	var exists bool
+	err = connection.QueryRow(context.Background(), selectExists, id).Scan(&exists)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return model.ErrDisabled
+}
+
+func (jsonData *DBStorage) RecordVariant(id, variant string) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	_, err := connection.Exec(context.Background(), incrementVariantHits, id, variant)
+	return err
+}
+
+func (jsonData *DBStorage) VariantHits(id string) (map[string]int, error) {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return nil, model.ErrUnavailable
+	}
+	rows, err := connection.Query(context.Background(), selectVariantHits, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := make(map[string]int)
+	for rows.Next() {
+		var variant string
+		var count int
+		err = rows.Scan(&variant, &count)
+		if err != nil {
+			return nil, err
+		}
+		hits[variant] = count
+	}
+	return hits, rows.Err()
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/storage/db"
+	"time"
+)
+
+const createWebhooksTableQuery = `
+CREATE TABLE IF NOT EXISTS shortener.webhooks
+	(
+	    name text primary key,
+	    url text NOT NULL,
+	    secret text NOT NULL DEFAULT '',
+	    events jsonb NOT NULL DEFAULT '[]'
+	)`
+
+const createDeliveriesTableQuery = `
+CREATE TABLE IF NOT EXISTS shortener.webhook_deliveries
+	(
+	    id text primary key,
+	    webhook text NOT NULL,
+	    event text NOT NULL,
+	    payload jsonb NOT NULL,
+	    status text NOT NULL,
+	    attempts integer NOT NULL DEFAULT 0,
+	    next_attempt_at timestamptz,
+	    last_status integer NOT NULL DEFAULT 0,
+	    last_error text NOT NULL DEFAULT '',
+	    created_at timestamptz NOT NULL DEFAULT now(),
+	    delivered_at timestamptz
+	)`
+
+const createDeliveriesIndexQuery = `
+CREATE INDEX IF NOT EXISTS webhook_deliveries_status
+ON shortener.webhook_deliveries(status, next_attempt_at)`
+
+const selectWebhooks = `
+select name, url, secret, events from shortener.webhooks order by name`
+
+const upsertWebhook = `
+insert into shortener.webhooks (name, url, secret, events) values ($1, $2, $3, $4)
+on conflict (name) do update set url = excluded.url, secret = excluded.secret, events = excluded.events`
+
+const deleteWebhook = `
+delete from shortener.webhooks where name = $1`
+
+const upsertDelivery = `
+insert into shortener.webhook_deliveries
+	(id, webhook, event, payload, status, attempts, next_attempt_at, last_status, last_error, created_at, delivered_at)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, coalesce($10, now()), $11)
+on conflict (id) do update set status = excluded.status, attempts = excluded.attempts,
+	next_attempt_at = excluded.next_attempt_at, last_status = excluded.last_status,
+	last_error = excluded.last_error, delivered_at = excluded.delivered_at`
+
+const deleteDeliveredBefore = `
+delete from shortener.webhook_deliveries where status = $1 and delivered_at < $2`
+
+const selectDeliveries = `
+select id, webhook, event, payload, status, attempts, next_attempt_at, last_status, last_error, created_at, delivered_at
+from shortener.webhook_deliveries where $1 = '' or status = $1 order by created_at, id`
+
+func (jsonData *DBStorage) Webhooks() ([]model.Webhook, error) {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return nil, model.ErrUnavailable
+	}
+	rows, err := connection.Query(context.Background(), selectWebhooks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []model.Webhook
+	for rows.Next() {
+		var webhook model.Webhook
+		err = rows.Scan(&webhook.Name, &webhook.URL, &webhook.Secret, &webhook.Events)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (jsonData *DBStorage) SetWebhook(webhook model.Webhook) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	_, err := connection.Exec(context.Background(), upsertWebhook, webhook.Name, webhook.URL, webhook.Secret, jsonValue(webhook.Events))
+	return wrapPgError(err)
+}
+
+func (jsonData *DBStorage) DeleteWebhook(name string) error {
+	return execByID(context.Background(), deleteWebhook, name)
+}
+
+func (jsonData *DBStorage) PruneDeliveries(before time.Time) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	_, err := connection.Exec(context.Background(), deleteDeliveredBefore, model.DeliveryDelivered, before)
+	return err
+}
+
+func (jsonData *DBStorage) SaveDelivery(delivery model.Delivery) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	_, err := connection.Exec(context.Background(), upsertDelivery, delivery.ID, delivery.Webhook, delivery.Event,
+		string(delivery.Payload), delivery.Status, delivery.Attempts, delivery.NextAt, delivery.LastStatus,
+		delivery.LastError, delivery.CreatedAt, delivery.DeliveredAt)
+	return wrapPgError(err)
+}
+
+func (jsonData *DBStorage) Deliveries(status string) ([]model.Delivery, error) {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return nil, model.ErrUnavailable
+	}
+	rows, err := connection.Query(context.Background(), selectDeliveries, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []model.Delivery
+	for rows.Next() {
+		var v model.Delivery
+		var payload string
+		err = rows.Scan(&v.ID, &v.Webhook, &v.Event, &payload, &v.Status, &v.Attempts, &v.NextAt,
+			&v.LastStatus, &v.LastError, &v.CreatedAt, &v.DeliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		v.Payload = []byte(payload)
+		deliveries = append(deliveries, v)
+	}
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/storage/db"
+	"github.com/jackc/pgx/v5"
+)
+
+const createWorkspacesTableQuery = `
+CREATE TABLE IF NOT EXISTS shortener.workspaces
+	(
+	    id text primary key,
+	    name text NOT NULL,
+	    quota integer NOT NULL DEFAULT 0,
+	    redirect_type integer NOT NULL DEFAULT 0,
+	    domain text NOT NULL DEFAULT '',
+	    members jsonb NOT NULL DEFAULT '[]',
+	    created_at timestamptz NOT NULL DEFAULT now()
+	)`
+
+const createWorkspaceLinksIndexQuery = `
+CREATE INDEX IF NOT EXISTS short_links_workspace
+ON shortener.short_links(workspace) WHERE workspace <> ''`
+
+const selectWorkspaceColumns = `
+select id, name, quota, redirect_type, domain, members, created_at from shortener.workspaces`
+
+const selectUserWorkspaces = selectWorkspaceColumns + `
+where members @> $1::jsonb order by name`
+
+const selectWorkspace = selectWorkspaceColumns + `
+where id = $1`
+
+const upsertWorkspace = `
+insert into shortener.workspaces (id, name, quota, redirect_type, domain, members, created_at)
+values ($1, $2, $3, $4, $5, $6, coalesce($7, now()))
+on conflict (id) do update set name = excluded.name, quota = excluded.quota, redirect_type = excluded.redirect_type,
+	domain = excluded.domain, members = excluded.members`
+
+const deleteWorkspace = `
+delete from shortener.workspaces where id = $1`
+
+const selectWorkspaceStats = `
+select count(*), coalesce(sum(clicks), 0) from shortener.short_links where workspace = $1 and not is_disabled`
+
+func scanWorkspace(row pgx.Row) (model.Workspace, error) {
+	var workspace model.Workspace
+	err := row.Scan(&workspace.ID, &workspace.Name, &workspace.Quota, &workspace.RedirectType, &workspace.Domain,
+		&workspace.Members, &workspace.CreatedAt)
+	return workspace, err
+}
+
+func (jsonData *DBStorage) Workspaces(userID string) ([]model.Workspace, error) {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return nil, model.ErrUnavailable
+	}
+	member, err := json.Marshal([]map[string]string{{"user_id": userID}})
+	if err != nil {
+		return nil, err
+	}
+	rows, err := connection.Query(context.Background(), selectUserWorkspaces, string(member))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workspaces []model.Workspace
+	for rows.Next() {
+		workspace, err := scanWorkspace(rows)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, workspace)
+	}
+	return workspaces, rows.Err()
+}
+
+func (jsonData *DBStorage) GetWorkspace(id string) (model.Workspace, error) {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.Workspace{}, model.ErrUnavailable
+	}
+	workspace, err := scanWorkspace(connection.QueryRow(context.Background(), selectWorkspace, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Workspace{}, model.ErrWorkspaceNotFound
+	}
+	return workspace, err
+}
+
+func (jsonData *DBStorage) SetWorkspace(workspace model.Workspace) error {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.ErrUnavailable
+	}
+	_, err := connection.Exec(context.Background(), upsertWorkspace, workspace.ID, workspace.Name, workspace.Quota,
+		workspace.RedirectType, workspace.Domain, jsonValue(workspace.Members), workspace.CreatedAt)
+	return wrapPgError(err)
+}
+
+func (jsonData *DBStorage) DeleteWorkspace(id string) error {
+	err := execByID(context.Background(), deleteWorkspace, id)
+	if errors.Is(err, model.ErrNotFound) {
+		return model.ErrWorkspaceNotFound
+	}
+	return err
+}
+
+func (jsonData *DBStorage) WorkspaceStats(id string) (model.WorkspaceStats, error) {
+
+	connection := db.GetDB()
+	if connection == nil {
+		return model.WorkspaceStats{}, model.ErrUnavailable
+	}
+	var stats model.WorkspaceStats
+	err := connection.QueryRow(context.Background(), selectWorkspaceStats, id).Scan(&stats.Links, &stats.Clicks)
+	return stats, err
+}
@@ -0,0 +1,42 @@
+package files
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+)
+
+func (jsonData *FileStorage) SetHealth(id string, health model.Health) error {
+
+	itemsMx.Lock()
+	defer itemsMx.Unlock()
+
+	fileName := confModule.Config.Final.LinkFile
+	savedData, err := loadItems(fileName)
+	if err != nil {
+		return err
+	}
+
+	for i := range savedData {
+		if savedData[i].ID == id {
+			savedData[i].Health = &health
+			return storeItems(savedData, fileName)
+		}
+	}
+	return model.ErrNotFound
+}
+
+func (jsonData *FileStorage) ActiveLinks() ([]model.LinkInfo, error) {
+
+	savedData, err := loadItems(confModule.Config.Final.LinkFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []model.LinkInfo
+	for _, v := range savedData {
+		if !v.Disabled {
+			links = append(links, toLinkInfo(v))
+		}
+	}
+	return links, nil
+}
@@ -0,0 +1,86 @@
+package files
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"time"
+)
+
+type linkVersion struct {
+	ID string `json:"correlation_id"`
+	model.LinkVersion
+}
+
+func loadHistory() ([]linkVersion, error) {
+	var history []linkVersion
+	err := loadSide(sideFile("history"), &history)
+	return history, err
+}
+
+// Edit меняет адрес и настройки ссылки, прежняя версия уходит в историю
+func (jsonData *FileStorage) Edit(id, link string, options model.LinkOptions) error {
+
+	itemsMx.Lock()
+	defer itemsMx.Unlock()
+
+	fileName := confModule.Config.Final.LinkFile
+	savedData, err := loadItems(fileName)
+	if err != nil {
+		return err
+	}
+
+	index := -1
+	for i := range savedData {
+		if savedData[i].ID == id {
+			index = i
+		}
+	}
+	if index < 0 {
+		return model.ErrNotFound
+	}
+	for i := range savedData {
+		if i != index && savedData[i].Link == link && savedData[i].Domain == savedData[index].Domain {
+			return model.NewError(model.CodeConflict, "link already exists", nil)
+		}
+	}
+
+	history, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	number := 1
+	for _, v := range history {
+		if v.ID == id {
+			number++
+		}
+	}
+	now := time.Now()
+	version := toLinkInfo(savedData[index]).Version(number)
+	version.ReplacedAt = &now
+	err = storeSide(sideFile("history"), append(history, linkVersion{ID: id, LinkVersion: version}))
+	if err != nil {
+		return err
+	}
+
+	if savedData[index].Link != link {
+		savedData[index].Metadata = nil
+		savedData[index].Health = nil
+	}
+	savedData[index].Link = link
+	savedData[index].LinkOptions = options
+	return storeItems(savedData, fileName)
+}
+
+func (jsonData *FileStorage) History(id string) ([]model.LinkVersion, error) {
+	history, err := loadHistory()
+	if err != nil {
+		return nil, err
+	}
+	var versions []model.LinkVersion
+	for _, v := range history {
+		if v.ID == id {
+			versions = append(versions, v.LinkVersion)
+		}
+	}
+	return versions, nil
+}
@@ -0,0 +1,81 @@
+package files
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"sync"
+	"time"
+)
+
+// idempotencyMx защищает файл ключей от одновременной проверки и записи
+var idempotencyMx sync.Mutex
+
+// loadIdempotency читает ключи, истекшие отбрасываются
+func loadIdempotency() ([]model.Idempotency, error) {
+	var saved []model.Idempotency
+	err := loadSide(sideFile("idempotency"), &saved)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	records := saved[:0]
+	for _, v := range saved {
+		if !v.IsExpired(now) {
+			records = append(records, v)
+		}
+	}
+	return records, nil
+}
+
+func (jsonData *FileStorage) ReserveIdempotency(record model.Idempotency) (model.Idempotency, error) {
+	idempotencyMx.Lock()
+	defer idempotencyMx.Unlock()
+
+	saved, err := loadIdempotency()
+	if err != nil {
+		return record, err
+	}
+	for _, v := range saved {
+		if v.UserID == record.UserID && v.Key == record.Key {
+			return v, model.ErrConflict
+		}
+	}
+	return record, storeSide(sideFile("idempotency"), append(saved, record))
+}
+
+func (jsonData *FileStorage) SaveIdempotency(record model.Idempotency) error {
+	idempotencyMx.Lock()
+	defer idempotencyMx.Unlock()
+
+	saved, err := loadIdempotency()
+	if err != nil {
+		return err
+	}
+	isFound := false
+	for i := range saved {
+		if saved[i].UserID == record.UserID && saved[i].Key == record.Key {
+			saved[i] = record
+			isFound = true
+		}
+	}
+	if !isFound {
+		saved = append(saved, record)
+	}
+	return storeSide(sideFile("idempotency"), saved)
+}
+
+func (jsonData *FileStorage) DeleteIdempotency(userID, key string) error {
+	idempotencyMx.Lock()
+	defer idempotencyMx.Unlock()
+
+	saved, err := loadIdempotency()
+	if err != nil {
+		return err
+	}
+	toSave := make([]model.Idempotency, 0, len(saved))
+	for _, v := range saved {
+		if v.UserID != userID || v.Key != key {
+			toSave = append(toSave, v)
+		}
+	}
+	return storeSide(sideFile("idempotency"), toSave)
+}
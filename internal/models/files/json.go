@@ -4,13 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
 	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
-	"github.com/MaximMNsk/go-url-shortener/internal/util/shorter"
 	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
 	"io"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
 type FileStorage struct {
@@ -28,9 +31,21 @@ func (jsonData *FileStorage) Init(link, shortLink, id string, ctx context.Contex
 }
 
 type inputOutputData struct {
-	Link      string `json:"original_url"`
-	ShortLink string `json:"short_url"`
-	ID        string `json:"correlation_id"`
+	Link      string          `json:"original_url"`
+	ShortLink string          `json:"short_url"`
+	ID        string          `json:"correlation_id"`
+	UserID    string          `json:"user_id,omitempty"`
+	Disabled  bool            `json:"is_disabled,omitempty"`
+	Clicks    int             `json:"clicks,omitempty"`
+	CreatedAt *time.Time      `json:"created_at,omitempty"`
+	Metadata  *model.Metadata `json:"metadata,omitempty"`
+	Health    *model.Health   `json:"health,omitempty"`
+	model.LinkOptions
+}
+
+// urlKey адрес ссылки вместе с доменом, адрес уникален в пределах домена
+func (item inputOutputData) urlKey() string {
+	return item.Domain + "\n" + item.Link
 }
 
 func (jsonData *FileStorage) Get() (string, error) {
@@ -48,10 +63,13 @@ func (jsonData *FileStorage) Get() (string, error) {
 	}
 	for _, v := range savedData {
 		if v.ID == jsonData.ID || v.Link == jsonData.Link {
+			if v.Disabled {
+				return "", model.ErrDisabled
+			}
 			return v.Link, nil
 		}
 	}
-	return "", errors.New("no data found")
+	return "", model.ErrNotFound
 }
 
 func getData(fileName string) (string, error) {
@@ -91,43 +109,93 @@ func getData(fileName string) (string, error) {
 	return result, err
 }
 
-func (jsonData *FileStorage) Set() error {
+func (jsonData *FileStorage) Set(info model.LinkInfo) error {
 
 	fileName := confModule.Config.Final.LinkFile
 	logger.PrintLog(logger.INFO, "Set to file: "+fileName)
 
-	var toSave []inputOutputData
-	var savedData []inputOutputData
-
+	now := time.Now()
 	preparedData := inputOutputData{
-		Link:      jsonData.Link,
-		ShortLink: jsonData.ShortLink,
-		ID:        jsonData.ID,
+		Link:        info.OriginalURL,
+		ShortLink:   info.ShortURL,
+		ID:          info.ID,
+		UserID:      info.UserID,
+		CreatedAt:   &now,
+		LinkOptions: info.LinkOptions,
 	}
 
-	jsonString, err := getData(fileName)
+	existing, rejected, err := insertItems([]inputOutputData{preparedData}, true, fileName)
 	if err != nil {
-		logger.PrintLog(logger.ERROR, "Setter. Json string: "+jsonString+". Error: "+err.Error())
+		logger.PrintLog(logger.ERROR, "Setter. Save new link: "+err.Error())
+		return err
 	}
+	if existing[0] != "" {
+		return model.ErrConflict
+	}
+	return rejected[0]
+}
 
-	err = json.Unmarshal([]byte(jsonString), &savedData)
+// insertItems добавляет в файл ссылки с еще не сохраненными адресами. Для каждой ссылки
+// возвращается короткий url сохраненной ссылки с тем же адресом, в том числе раньше в этой
+// же пачке, или пустая строка, если ссылка добавлена. rejected - ошибка ссылки, которая не
+// добавлена из-за занятого ид или квоты пространства. С atomic при любом совпадении файл не меняется
+func insertItems(items []inputOutputData, atomic bool, fileName string) (existing []string, rejected []error, err error) {
+	itemsMx.Lock()
+	defer itemsMx.Unlock()
+
+	quotas, err := workspaceQuotas(items)
 	if err != nil {
-		logger.PrintLog(logger.ERROR, "Setter. Unmarshal json string: "+jsonString+". Error: "+err.Error())
+		return nil, nil, err
 	}
 
-	toSave = append(savedData, preparedData)
-	var content []byte
-	content, err = json.Marshal(toSave)
-	if err != nil {
-		logger.PrintLog(logger.ERROR, "Setter. Marshal new json string: "+jsonString+". Error: "+err.Error())
+	var savedData []inputOutputData
+	jsonString, err := getData(fileName)
+	if err == nil {
+		err = json.Unmarshal([]byte(jsonString), &savedData)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	isOk := saveData(content, fileName)
-	if !isOk {
-		err = errors.New("can't save")
-		logger.PrintLog(logger.ERROR, "Setter. Save new content: "+string(content)+". Error: "+err.Error())
+	saved := make(map[string]string, len(savedData)+len(items))
+	ids := make(map[string]bool, len(savedData)+len(items))
+	// links активные ссылки пространств, квота считается под той же блокировкой, что и запись
+	links := make(map[string]int)
+	for _, v := range savedData {
+		saved[v.urlKey()] = v.ShortLink
+		ids[v.ID] = true
+		if v.Workspace != "" && !v.Disabled {
+			links[v.Workspace]++
+		}
+	}
+	existing = make([]string, len(items))
+	rejected = make([]error, len(items))
+	added := 0
+	for i, v := range items {
+		if shortLink, ok := saved[v.urlKey()]; ok {
+			existing[i] = shortLink
+			continue
+		}
+		if ids[v.ID] {
+			rejected[i] = model.ErrIDTaken
+			continue
+		}
+		if v.Workspace != "" {
+			if quotas[v.Workspace] > 0 && links[v.Workspace] >= quotas[v.Workspace] {
+				rejected[i] = model.ErrQuotaExceeded
+				continue
+			}
+			links[v.Workspace]++
+		}
+		saved[v.urlKey()] = v.ShortLink
+		ids[v.ID] = true
+		savedData = append(savedData, v)
+		added++
+	}
+	if added == 0 || atomic && added < len(items) {
+		return existing, rejected, nil
 	}
-	return err
+	return existing, rejected, storeItems(savedData, fileName)
 }
 
 func saveData(data []byte, fileName string) bool {
@@ -181,65 +249,237 @@ func MakeStorageFile(fileName string) error {
 	return nil
 }
 
-type outputBatch struct {
-	CorrelationID string `json:"correlation_id"`
-	ShortURL      string `json:"short_url"`
-}
-
-func (jsonData *FileStorage) BatchSet() ([]byte, error) {
+func (jsonData *FileStorage) BatchSet(userID string, batch []byte, atomic bool) ([]byte, error) {
 
-	var mx sync.Mutex
-	mx.Lock()
-	defer mx.Unlock()
+	var savingData []inputOutputData
+	err := json.Unmarshal(batch, &savingData)
+	if err != nil {
+		return nil, model.NewError(model.CodeInvalid, "invalid batch", err)
+	}
 
-	var savingData []FileStorage
-	var outputData []outputBatch
+	now := time.Now()
+	correlationIDs := make([]string, len(savingData))
+	for i, v := range savingData {
+		correlationIDs[i] = v.ID
+		savingData[i].ID = domains.Key(v.Domain, v.ID)
+		savingData[i].ShortLink = domains.ShortURL(savingData[i].ID)
+		savingData[i].UserID = userID
+		savingData[i].CreatedAt = &now
+	}
 
-	err := json.Unmarshal([]byte(jsonData.Link), &savingData)
+	existing, rejected, err := insertItems(savingData, atomic, confModule.Config.Final.LinkFile)
 	if err != nil {
 		return nil, err
 	}
 
+	outputData := make([]api.BatchResponseItem, 0, len(savingData))
 	for i, v := range savingData {
-		shortLink := shorter.GetShortURL(confModule.Config.Final.ShortURLAddr, v.ID)
-		savingData[i].ID = v.ID
-		savingData[i].ShortLink = shortLink
-
-		outputData = append(outputData, outputBatch{ShortURL: shortLink, CorrelationID: v.ID})
+		item := api.BatchResponseItem{CorrelationID: correlationIDs[i], ShortURL: v.ShortLink, Status: model.BatchCreated}
+		if existing[i] != "" {
+			item.ShortURL = existing[i]
+			item.Status = model.BatchExists
+		}
+		outputData = append(outputData, item)
 	}
+	batchErr := api.BatchError(outputData, rejected, atomic)
 
-	///////// Current logic
-	var savedData []FileStorage
+	JSONResp, err := json.Marshal(outputData)
+	if err != nil {
+		logger.PrintLog(logger.WARN, err.Error())
+		return nil, err
+	}
+	return JSONResp, batchErr
+}
 
-	fileName := confModule.Config.Final.LinkFile
+func loadItems(fileName string) ([]inputOutputData, error) {
+	var savedData []inputOutputData
 	jsonString, err := getData(fileName)
 	if err != nil {
-		jsonString = ""
-	} else {
-		err = json.Unmarshal([]byte(jsonString), &savedData)
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(jsonString), &savedData)
+	if err != nil {
+		return nil, err
+	}
+	return savedData, nil
+}
+
+// scanItems читает файл потоком и передает ссылки в fn по одной
+func scanItems(fileName string, fn func(item inputOutputData) error) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	_, err = decoder.Token()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for decoder.More() {
+		var item inputOutputData
+		err = decoder.Decode(&item)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		err = fn(item)
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	toSave := append(savedData, savingData...)
-	var content []byte
-	content, err = json.Marshal(toSave)
+func storeItems(items []inputOutputData, fileName string) error {
+	content, err := json.Marshal(items)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if !saveData(content, fileName) {
+		return errors.New("can't save")
 	}
+	return nil
+}
 
-	isOk := saveData(content, fileName)
-	if !isOk {
-		err = errors.New("can't save")
-		return []byte(""), err
+func (jsonData *FileStorage) Stats() (model.Stats, error) {
+
+	var stats model.Stats
+	savedData, err := loadItems(confModule.Config.Final.LinkFile)
+	if err != nil {
+		return stats, err
 	}
-	//////// End logic
 
-	JSONResp, err := json.Marshal(outputData)
+	users := make(map[string]bool)
+	for _, v := range savedData {
+		stats.URLs++
+		if v.UserID != "" {
+			users[v.UserID] = true
+		}
+	}
+	stats.Users = len(users)
+
+	return stats, nil
+}
+
+func (jsonData *FileStorage) Lookup(id string) (model.LinkInfo, error) {
+
+	savedData, err := loadItems(confModule.Config.Final.LinkFile)
 	if err != nil {
-		logger.PrintLog(logger.WARN, err.Error())
+		return model.LinkInfo{}, err
 	}
+	for _, v := range savedData {
+		if v.ID == id {
+			return toLinkInfo(v), nil
+		}
+	}
+	return model.LinkInfo{}, model.ErrNotFound
+}
+
+func (jsonData *FileStorage) Disable(id string) error {
+
+	itemsMx.Lock()
+	defer itemsMx.Unlock()
+
+	fileName := confModule.Config.Final.LinkFile
+	savedData, err := loadItems(fileName)
+	if err != nil {
+		return err
+	}
+
+	isFound := false
+	for i := range savedData {
+		if savedData[i].ID == id {
+			savedData[i].Disabled = true
+			isFound = true
+		}
+	}
+	if !isFound {
+		return model.ErrNotFound
+	}
+	return storeItems(savedData, fileName)
+}
 
-	return JSONResp, nil
+func (jsonData *FileStorage) Purge(id string) error {
+
+	itemsMx.Lock()
+	defer itemsMx.Unlock()
+
+	fileName := confModule.Config.Final.LinkFile
+	savedData, err := loadItems(fileName)
+	if err != nil {
+		return err
+	}
+
+	toSave := make([]inputOutputData, 0, len(savedData))
+	for _, v := range savedData {
+		if v.ID != id {
+			toSave = append(toSave, v)
+		}
+	}
+	if len(toSave) == len(savedData) {
+		return model.ErrNotFound
+	}
+	return storeItems(toSave, fileName)
+}
+
+func (jsonData *FileStorage) UserLinks(userID string) ([]model.LinkInfo, error) {
+
+	var links []model.LinkInfo
+	err := jsonData.ScanUserLinks(userID, func(info model.LinkInfo) error {
+		links = append(links, info)
+		return nil
+	})
+	return links, err
+}
+
+func (jsonData *FileStorage) ScanUserLinks(userID string, fn func(info model.LinkInfo) error) error {
+
+	return scanItems(confModule.Config.Final.LinkFile, func(item inputOutputData) error {
+		if item.UserID != userID || item.Disabled {
+			return nil
+		}
+		return fn(toLinkInfo(item))
+	})
+}
+
+func (jsonData *FileStorage) DeleteUserLinks(userID string, ids []string) error {
+
+	itemsMx.Lock()
+	defer itemsMx.Unlock()
+
+	fileName := confModule.Config.Final.LinkFile
+	savedData, err := loadItems(fileName)
+	if err != nil {
+		return err
+	}
+
+	toDelete := make(map[string]bool)
+	for _, id := range ids {
+		toDelete[id] = true
+	}
+	for i := range savedData {
+		if toDelete[savedData[i].ID] && savedData[i].UserID == userID {
+			savedData[i].Disabled = true
+		}
+	}
+	return storeItems(savedData, fileName)
+}
+
+func toLinkInfo(item inputOutputData) model.LinkInfo {
+	return model.LinkInfo{
+		ID:          item.ID,
+		ShortURL:    item.ShortLink,
+		OriginalURL: item.Link,
+		UserID:      item.UserID,
+		Disabled:    item.Disabled,
+		Clicks:      item.Clicks,
+		CreatedAt:   item.CreatedAt,
+		Metadata:    item.Metadata,
+		Health:      item.Health,
+		LinkOptions: item.LinkOptions,
+	}
 }
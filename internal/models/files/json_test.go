@@ -1,13 +1,17 @@
 package files
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
 	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -77,12 +81,12 @@ func TestJSONDataSet_Set(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			jsonData := &FileStorage{
-				Link:      tt.fields.Link,
-				ShortLink: tt.fields.ShortLink,
-				ID:        tt.fields.ID,
-			}
-			_ = jsonData.Set()
+			jsonData := &FileStorage{}
+			_ = jsonData.Set(model.LinkInfo{
+				OriginalURL: tt.fields.Link,
+				ShortURL:    tt.fields.ShortLink,
+				ID:          tt.fields.ID,
+			})
 			require.FileExists(t, filepath.Join(tt.args.fileName))
 		})
 	}
@@ -134,3 +138,100 @@ func TestJSONDataGet_Get(t *testing.T) {
 		})
 	}
 }
+
+func TestConcurrentRewrites(t *testing.T) {
+	linkFile := confModule.Config.Final.LinkFile
+	confModule.Config.Final.LinkFile = filepath.Join(t.TempDir(), "links.json")
+	defer func() { confModule.Config.Final.LinkFile = linkFile }()
+	require.NoError(t, MakeStorageFile(confModule.Config.Final.LinkFile))
+
+	for _, id := range []string{"clicked", "edited"} {
+		info := model.LinkInfo{OriginalURL: "https://example.com/" + id, ShortURL: "http://localhost/" + id, ID: id}
+		require.NoError(t, (&FileStorage{}).Set(info))
+	}
+
+	// Переписывание файла другими ссылками не должно терять засчитанные переходы
+	const clicks = 20
+	var wg sync.WaitGroup
+	for i := 0; i < clicks; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, (&FileStorage{}).Consume("clicked"))
+			assert.NoError(t, (&FileStorage{}).RecordVariant("clicked", "a"))
+		}()
+		go func(i int) {
+			defer wg.Done()
+			jsonData := &FileStorage{}
+			assert.NoError(t, jsonData.UpdateOptions("edited", model.LinkOptions{MaxClicks: i + 1}))
+			assert.NoError(t, jsonData.DeleteUserLinks("", []string{"other"}))
+		}(i)
+	}
+	wg.Wait()
+
+	info, err := (&FileStorage{}).Lookup("clicked")
+	require.NoError(t, err)
+	assert.Equal(t, clicks, info.Clicks)
+	hits, err := (&FileStorage{}).VariantHits("clicked")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": clicks}, hits)
+}
+
+func TestTakenID(t *testing.T) {
+	linkFile := confModule.Config.Final.LinkFile
+	confModule.Config.Final.LinkFile = filepath.Join(t.TempDir(), "links.json")
+	defer func() { confModule.Config.Final.LinkFile = linkFile }()
+	require.NoError(t, MakeStorageFile(confModule.Config.Final.LinkFile))
+
+	jsonData := &FileStorage{}
+	require.NoError(t, jsonData.Set(model.LinkInfo{OriginalURL: "https://example.com/first", ShortURL: "http://localhost/taken", ID: "taken"}))
+	assert.ErrorIs(t, jsonData.Set(model.LinkInfo{OriginalURL: "https://example.com/second", ShortURL: "http://localhost/taken", ID: "taken"}), model.ErrIDTaken)
+
+	batch := `[{"correlation_id":"taken","original_url":"https://example.com/second"},{"correlation_id":"free","original_url":"https://example.com/free"}]`
+	resp, err := jsonData.BatchSet("", []byte(batch), false)
+	require.NoError(t, err)
+	var items []api.BatchResponseItem
+	require.NoError(t, json.Unmarshal(resp, &items))
+	assert.Equal(t, model.BatchInvalid, items[0].Status)
+	assert.Equal(t, model.BatchCreated, items[1].Status)
+
+	info, err := (&FileStorage{}).Lookup("taken")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/first", info.OriginalURL)
+}
+
+func TestWorkspaceQuota(t *testing.T) {
+	linkFile := confModule.Config.Final.LinkFile
+	confModule.Config.Final.LinkFile = filepath.Join(t.TempDir(), "links.json")
+	defer func() { confModule.Config.Final.LinkFile = linkFile }()
+	require.NoError(t, MakeStorageFile(confModule.Config.Final.LinkFile))
+	require.NoError(t, (&FileStorage{}).SetWorkspace(model.Workspace{ID: "team", Name: "Team", Quota: 3}))
+
+	// Параллельные вставки не проходят квоту, потому что она считается вместе с записью
+	const links = 10
+	errs := make([]error, links)
+	var wg sync.WaitGroup
+	for i := 0; i < links; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("link%d", i)
+			errs[i] = (&FileStorage{}).Set(model.LinkInfo{OriginalURL: "https://example.com/" + id, ShortURL: "http://localhost/" + id, ID: id,
+				LinkOptions: model.LinkOptions{Workspace: "team"}})
+		}(i)
+	}
+	wg.Wait()
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.ErrorIs(t, err, model.ErrQuotaExceeded)
+	}
+	assert.Equal(t, 3, created)
+
+	batch := `[{"correlation_id":"batch","original_url":"https://example.com/batch","workspace":"team"}]`
+	_, err := (&FileStorage{}).BatchSet("", []byte(batch), true)
+	assert.ErrorIs(t, err, model.ErrQuotaExceeded)
+}
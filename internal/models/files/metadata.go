@@ -0,0 +1,26 @@
+package files
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+)
+
+func (jsonData *FileStorage) SetMetadata(id string, metadata model.Metadata) error {
+
+	itemsMx.Lock()
+	defer itemsMx.Unlock()
+
+	fileName := confModule.Config.Final.LinkFile
+	savedData, err := loadItems(fileName)
+	if err != nil {
+		return err
+	}
+
+	for i := range savedData {
+		if savedData[i].ID == id {
+			savedData[i].Metadata = &metadata
+			return storeItems(savedData, fileName)
+		}
+	}
+	return model.ErrNotFound
+}
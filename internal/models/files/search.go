@@ -0,0 +1,77 @@
+package files
+
+import (
+	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/search"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"os"
+	"strconv"
+)
+
+// linksIndex индекс поиска по файлу ссылок, обновляется, когда файл меняется
+var linksIndex search.Cache
+
+// fileVersion версия файла по имени, времени изменения и размеру
+func fileVersion(fileName string) (string, error) {
+	info, err := os.Stat(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return fileName, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return fileName + "|" + strconv.FormatInt(info.ModTime().UnixNano(), 10) + "|" + strconv.FormatInt(info.Size(), 10), nil
+}
+
+func (jsonData *FileStorage) SearchUserLinks(userID string, query model.LinkQuery) (model.LinkPage, error) {
+
+	fileName := confModule.Config.Final.LinkFile
+	var matched map[string]bool
+	terms := search.Terms(query.Q)
+	if len(terms) > 0 {
+		version, err := fileVersion(fileName)
+		if err != nil {
+			return model.LinkPage{}, err
+		}
+		matched, err = linksIndex.Match(version, func(add func(info model.LinkInfo)) error {
+			return scanItems(fileName, func(item inputOutputData) error {
+				add(toLinkInfo(item))
+				return nil
+			})
+		}, terms)
+		if err != nil {
+			return model.LinkPage{}, err
+		}
+	}
+
+	var links []model.LinkInfo
+	err := jsonData.scanLinks(userID, query.Workspace, func(info model.LinkInfo) error {
+		if len(terms) == 0 || matched[info.ID] {
+			links = append(links, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return model.LinkPage{}, err
+	}
+	return search.Paginate(links, query)
+}
+
+// scanLinks передает в fn ссылки пространства workspace, а с пустым workspace - личные ссылки пользователя userID
+func (jsonData *FileStorage) scanLinks(userID, workspace string, fn func(info model.LinkInfo) error) error {
+	if workspace == "" {
+		return jsonData.ScanUserLinks(userID, func(info model.LinkInfo) error {
+			if info.Workspace != "" {
+				return nil
+			}
+			return fn(info)
+		})
+	}
+	return scanItems(confModule.Config.Final.LinkFile, func(item inputOutputData) error {
+		if item.Workspace != workspace || item.Disabled {
+			return nil
+		}
+		return fn(toLinkInfo(item))
+	})
+}
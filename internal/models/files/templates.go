@@ -0,0 +1,99 @@
+package files
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sideFile возвращает путь к файлу рядом с файлом ссылок: links.json -> links.<name>.json
+func sideFile(name string) string {
+	linkFile := confModule.Config.Final.LinkFile
+	ext := filepath.Ext(linkFile)
+	return strings.TrimSuffix(linkFile, ext) + "." + name + ext
+}
+
+// loadSide читает json из файла, отсутствующий файл считается пустым
+func loadSide(fileName string, data any) error {
+	jsonString, err := getData(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(jsonString), data)
+}
+
+func storeSide(fileName string, data any) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if !saveData(content, fileName) {
+		return errors.New("can't save")
+	}
+	return nil
+}
+
+func loadTemplates() ([]model.Template, error) {
+	var templates []model.Template
+	err := loadSide(sideFile("templates"), &templates)
+	return templates, err
+}
+
+func (jsonData *FileStorage) Templates() ([]model.Template, error) {
+	return loadTemplates()
+}
+
+func (jsonData *FileStorage) GetTemplate(name string) (model.Template, error) {
+	saved, err := loadTemplates()
+	if err != nil {
+		return model.Template{}, err
+	}
+	for _, v := range saved {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+	return model.Template{}, model.ErrNotFound
+}
+
+func (jsonData *FileStorage) SetTemplate(template model.Template) error {
+	saved, err := loadTemplates()
+	if err != nil {
+		return err
+	}
+	toSave := []model.Template{template}
+	for _, v := range saved {
+		if v.Name != template.Name {
+			toSave = append(toSave, v)
+		}
+	}
+	sort.Slice(toSave, func(i, j int) bool {
+		return toSave[i].Name < toSave[j].Name
+	})
+	return storeSide(sideFile("templates"), toSave)
+}
+
+func (jsonData *FileStorage) DeleteTemplate(name string) error {
+	saved, err := loadTemplates()
+	if err != nil {
+		return err
+	}
+	toSave := make([]model.Template, 0, len(saved))
+	for _, v := range saved {
+		if v.Name != name {
+			toSave = append(toSave, v)
+		}
+	}
+	if len(toSave) == len(saved) {
+		return model.ErrNotFound
+	}
+	return storeSide(sideFile("templates"), toSave)
+}
@@ -0,0 +1,110 @@
+package files
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"sync"
+)
+
+type variantHits struct {
+	ID      string `json:"correlation_id"`
+	Variant string `json:"variant"`
+	Hits    int    `json:"hits"`
+}
+
+func (jsonData *FileStorage) UpdateOptions(id string, options model.LinkOptions) error {
+
+	itemsMx.Lock()
+	defer itemsMx.Unlock()
+
+	fileName := confModule.Config.Final.LinkFile
+	savedData, err := loadItems(fileName)
+	if err != nil {
+		return err
+	}
+
+	isFound := false
+	for i := range savedData {
+		if savedData[i].ID == id {
+			savedData[i].LinkOptions = options
+			isFound = true
+		}
+	}
+	if !isFound {
+		return model.ErrNotFound
+	}
+	return storeItems(savedData, fileName)
+}
+
+// itemsMx защищает файл ссылок, когда запись зависит от прочитанных данных
+var itemsMx sync.Mutex
+
+// Consume засчитывает переход, если лимит переходов не исчерпан
+func (jsonData *FileStorage) Consume(id string) error {
+
+	itemsMx.Lock()
+	defer itemsMx.Unlock()
+
+	fileName := confModule.Config.Final.LinkFile
+	savedData, err := loadItems(fileName)
+	if err != nil {
+		return err
+	}
+
+	for i := range savedData {
+		if savedData[i].ID != id {
+			continue
+		}
+		if savedData[i].Disabled || savedData[i].MaxClicks > 0 && savedData[i].Clicks >= savedData[i].MaxClicks {
+			return model.ErrDisabled
+		}
+		savedData[i].Clicks++
+		return storeItems(savedData, fileName)
+	}
+	return model.ErrNotFound
+}
+
+// variantsMx защищает файл переходов по вариантам, его пишут конкурентные запросы на переход
+var variantsMx sync.Mutex
+
+func (jsonData *FileStorage) RecordVariant(id, variant string) error {
+	variantsMx.Lock()
+	defer variantsMx.Unlock()
+
+	var saved []variantHits
+	err := loadSide(sideFile("variants"), &saved)
+	if err != nil {
+		return err
+	}
+
+	isFound := false
+	for i := range saved {
+		if saved[i].ID == id && saved[i].Variant == variant {
+			saved[i].Hits++
+			isFound = true
+		}
+	}
+	if !isFound {
+		saved = append(saved, variantHits{ID: id, Variant: variant, Hits: 1})
+	}
+	return storeSide(sideFile("variants"), saved)
+}
+
+func (jsonData *FileStorage) VariantHits(id string) (map[string]int, error) {
+	variantsMx.Lock()
+	defer variantsMx.Unlock()
+
+	var saved []variantHits
+	err := loadSide(sideFile("variants"), &saved)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make(map[string]int)
+	for _, v := range saved {
+		if v.ID == id {
+			hits[v.Variant] = v.Hits
+		}
+	}
+	return hits, nil
+}
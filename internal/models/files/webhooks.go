@@ -0,0 +1,127 @@
+package files
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"sort"
+	"sync"
+	"time"
+)
+
+// webhooksMx защищает файлы подписок и доставок, их пишут и запросы, и фоновая отправка
+var webhooksMx sync.Mutex
+
+func loadWebhooks() ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	err := loadSide(sideFile("webhooks"), &webhooks)
+	return webhooks, err
+}
+
+func loadDeliveries() ([]model.Delivery, error) {
+	var deliveries []model.Delivery
+	err := loadSide(sideFile("deliveries"), &deliveries)
+	return deliveries, err
+}
+
+func (jsonData *FileStorage) Webhooks() ([]model.Webhook, error) {
+	webhooksMx.Lock()
+	defer webhooksMx.Unlock()
+	return loadWebhooks()
+}
+
+func (jsonData *FileStorage) SetWebhook(webhook model.Webhook) error {
+	webhooksMx.Lock()
+	defer webhooksMx.Unlock()
+
+	saved, err := loadWebhooks()
+	if err != nil {
+		return err
+	}
+	toSave := []model.Webhook{webhook}
+	for _, v := range saved {
+		if v.Name != webhook.Name {
+			toSave = append(toSave, v)
+		}
+	}
+	sort.Slice(toSave, func(i, j int) bool {
+		return toSave[i].Name < toSave[j].Name
+	})
+	return storeSide(sideFile("webhooks"), toSave)
+}
+
+func (jsonData *FileStorage) DeleteWebhook(name string) error {
+	webhooksMx.Lock()
+	defer webhooksMx.Unlock()
+
+	saved, err := loadWebhooks()
+	if err != nil {
+		return err
+	}
+	toSave := make([]model.Webhook, 0, len(saved))
+	for _, v := range saved {
+		if v.Name != name {
+			toSave = append(toSave, v)
+		}
+	}
+	if len(toSave) == len(saved) {
+		return model.ErrNotFound
+	}
+	return storeSide(sideFile("webhooks"), toSave)
+}
+
+func (jsonData *FileStorage) SaveDelivery(delivery model.Delivery) error {
+	webhooksMx.Lock()
+	defer webhooksMx.Unlock()
+
+	saved, err := loadDeliveries()
+	if err != nil {
+		return err
+	}
+	isFound := false
+	for i := range saved {
+		if saved[i].ID == delivery.ID {
+			saved[i] = delivery
+			isFound = true
+		}
+	}
+	if !isFound {
+		saved = append(saved, delivery)
+	}
+	return storeSide(sideFile("deliveries"), saved)
+}
+
+func (jsonData *FileStorage) PruneDeliveries(before time.Time) error {
+	webhooksMx.Lock()
+	defer webhooksMx.Unlock()
+
+	saved, err := loadDeliveries()
+	if err != nil {
+		return err
+	}
+	kept := make([]model.Delivery, 0, len(saved))
+	for _, v := range saved {
+		if v.Status != model.DeliveryDelivered || v.DeliveredAt == nil || !v.DeliveredAt.Before(before) {
+			kept = append(kept, v)
+		}
+	}
+	if len(kept) == len(saved) {
+		return nil
+	}
+	return storeSide(sideFile("deliveries"), kept)
+}
+
+func (jsonData *FileStorage) Deliveries(status string) ([]model.Delivery, error) {
+	webhooksMx.Lock()
+	defer webhooksMx.Unlock()
+
+	saved, err := loadDeliveries()
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []model.Delivery
+	for _, v := range saved {
+		if status == "" || v.Status == status {
+			deliveries = append(deliveries, v)
+		}
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,132 @@
+package files
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"sort"
+	"sync"
+)
+
+// workspacesMx защищает файл пространств
+var workspacesMx sync.Mutex
+
+func loadWorkspaces() ([]model.Workspace, error) {
+	var workspaces []model.Workspace
+	err := loadSide(sideFile("workspaces"), &workspaces)
+	return workspaces, err
+}
+
+func (jsonData *FileStorage) Workspaces(userID string) ([]model.Workspace, error) {
+	workspacesMx.Lock()
+	defer workspacesMx.Unlock()
+
+	saved, err := loadWorkspaces()
+	if err != nil {
+		return nil, err
+	}
+	var workspaces []model.Workspace
+	for _, v := range saved {
+		if v.Role(userID) != "" {
+			workspaces = append(workspaces, v)
+		}
+	}
+	sort.Slice(workspaces, func(i, j int) bool {
+		return workspaces[i].Name < workspaces[j].Name
+	})
+	return workspaces, nil
+}
+
+func (jsonData *FileStorage) GetWorkspace(id string) (model.Workspace, error) {
+	workspacesMx.Lock()
+	defer workspacesMx.Unlock()
+
+	saved, err := loadWorkspaces()
+	if err != nil {
+		return model.Workspace{}, err
+	}
+	for _, v := range saved {
+		if v.ID == id {
+			return v, nil
+		}
+	}
+	return model.Workspace{}, model.ErrWorkspaceNotFound
+}
+
+func (jsonData *FileStorage) SetWorkspace(workspace model.Workspace) error {
+	workspacesMx.Lock()
+	defer workspacesMx.Unlock()
+
+	saved, err := loadWorkspaces()
+	if err != nil {
+		return err
+	}
+	isFound := false
+	for i := range saved {
+		if saved[i].ID == workspace.ID {
+			saved[i] = workspace
+			isFound = true
+		}
+	}
+	if !isFound {
+		saved = append(saved, workspace)
+	}
+	return storeSide(sideFile("workspaces"), saved)
+}
+
+func (jsonData *FileStorage) DeleteWorkspace(id string) error {
+	workspacesMx.Lock()
+	defer workspacesMx.Unlock()
+
+	saved, err := loadWorkspaces()
+	if err != nil {
+		return err
+	}
+	var toSave []model.Workspace
+	for _, v := range saved {
+		if v.ID != id {
+			toSave = append(toSave, v)
+		}
+	}
+	if len(toSave) == len(saved) {
+		return model.ErrWorkspaceNotFound
+	}
+	return storeSide(sideFile("workspaces"), toSave)
+}
+
+// workspaceQuotas возвращает квоты пространств, в которые идут ссылки items
+func workspaceQuotas(items []inputOutputData) (map[string]int, error) {
+	quotas := make(map[string]int)
+	for _, v := range items {
+		if v.Workspace != "" {
+			quotas[v.Workspace] = 0
+		}
+	}
+	if len(quotas) == 0 {
+		return quotas, nil
+	}
+
+	workspacesMx.Lock()
+	defer workspacesMx.Unlock()
+	saved, err := loadWorkspaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range saved {
+		if _, ok := quotas[v.ID]; ok {
+			quotas[v.ID] = v.Quota
+		}
+	}
+	return quotas, nil
+}
+
+func (jsonData *FileStorage) WorkspaceStats(id string) (model.WorkspaceStats, error) {
+	var stats model.WorkspaceStats
+	err := scanItems(confModule.Config.Final.LinkFile, func(item inputOutputData) error {
+		if item.Workspace == id && !item.Disabled {
+			stats.Links++
+			stats.Clicks += item.Clicks
+		}
+		return nil
+	})
+	return stats, err
+}
@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	memoryStorage "github.com/MaximMNsk/go-url-shortener/internal/storage/memory"
+)
+
+func (jsonData *MemStorage) SetHealth(id string, health model.Health) error {
+	isFound := jsonData.Storage.Update(id, func(item *memoryStorage.StorageItem) {
+		item.Health = &health
+	})
+	if !isFound {
+		return model.ErrNotFound
+	}
+	return nil
+}
+
+func (jsonData *MemStorage) ActiveLinks() ([]model.LinkInfo, error) {
+	var links []model.LinkInfo
+	for _, v := range jsonData.Storage.Get() {
+		if !v.Disabled {
+			links = append(links, toLinkInfo(v))
+		}
+	}
+	return links, nil
+}
@@ -0,0 +1,32 @@
+package memory
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	memoryStorage "github.com/MaximMNsk/go-url-shortener/internal/storage/memory"
+	"time"
+)
+
+// Edit меняет адрес и настройки ссылки, прежняя версия уходит в историю
+func (jsonData *MemStorage) Edit(id, link string, options model.LinkOptions) error {
+	return jsonData.Storage.Edit(id, link, func(item *memoryStorage.StorageItem) {
+		now := time.Now()
+		version := toLinkInfo(*item).Version(len(item.History) + 1)
+		version.ReplacedAt = &now
+		item.History = append(item.History, version)
+		if item.Link != link {
+			item.Metadata = nil
+			item.Health = nil
+		}
+		item.Link = link
+		item.LinkOptions = options
+	})
+}
+
+func (jsonData *MemStorage) History(id string) ([]model.LinkVersion, error) {
+	for _, v := range jsonData.Storage.Get() {
+		if v.ID == id {
+			return append([]model.LinkVersion(nil), v.History...), nil
+		}
+	}
+	return nil, model.ErrNotFound
+}
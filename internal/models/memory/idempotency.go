@@ -0,0 +1,24 @@
+package memory
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"time"
+)
+
+func (jsonData *MemStorage) ReserveIdempotency(record model.Idempotency) (model.Idempotency, error) {
+	saved, ok := jsonData.Storage.ReserveIdempotency(record, time.Now())
+	if !ok {
+		return saved, model.ErrConflict
+	}
+	return saved, nil
+}
+
+func (jsonData *MemStorage) SaveIdempotency(record model.Idempotency) error {
+	jsonData.Storage.SaveIdempotency(record)
+	return nil
+}
+
+func (jsonData *MemStorage) DeleteIdempotency(userID, key string) error {
+	jsonData.Storage.DeleteIdempotency(userID, key)
+	return nil
+}
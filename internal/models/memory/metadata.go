@@ -0,0 +1,16 @@
+package memory
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	memoryStorage "github.com/MaximMNsk/go-url-shortener/internal/storage/memory"
+)
+
+func (jsonData *MemStorage) SetMetadata(id string, metadata model.Metadata) error {
+	isFound := jsonData.Storage.Update(id, func(item *memoryStorage.StorageItem) {
+		item.Metadata = &metadata
+	})
+	if !isFound {
+		return model.ErrNotFound
+	}
+	return nil
+}
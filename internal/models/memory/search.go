@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/search"
+	"strconv"
+)
+
+func (jsonData *MemStorage) SearchUserLinks(userID string, query model.LinkQuery) (model.LinkPage, error) {
+
+	var matched map[string]bool
+	terms := search.Terms(query.Q)
+	if len(terms) > 0 {
+		version := strconv.FormatUint(jsonData.Storage.Version(), 10)
+		var err error
+		matched, err = jsonData.index.Match(version, func(add func(info model.LinkInfo)) error {
+			for _, v := range jsonData.Storage.Get() {
+				add(toLinkInfo(v))
+			}
+			return nil
+		}, terms)
+		if err != nil {
+			return model.LinkPage{}, err
+		}
+	}
+
+	var links []model.LinkInfo
+	err := jsonData.scanLinks(userID, query.Workspace, func(info model.LinkInfo) error {
+		if len(terms) == 0 || matched[info.ID] {
+			links = append(links, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return model.LinkPage{}, err
+	}
+	return search.Paginate(links, query)
+}
+
+// scanLinks передает в fn ссылки пространства workspace, а с пустым workspace - личные ссылки пользователя userID
+func (jsonData *MemStorage) scanLinks(userID, workspace string, fn func(info model.LinkInfo) error) error {
+	if workspace == "" {
+		return jsonData.ScanUserLinks(userID, func(info model.LinkInfo) error {
+			if info.Workspace != "" {
+				return nil
+			}
+			return fn(info)
+		})
+	}
+	for _, v := range jsonData.Storage.Get() {
+		if v.Workspace == workspace && !v.Disabled {
+			err := fn(toLinkInfo(v))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
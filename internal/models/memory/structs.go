@@ -3,12 +3,14 @@ package memory
 import (
 	"context"
 	"encoding/json"
-	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
 	memoryStorage "github.com/MaximMNsk/go-url-shortener/internal/storage/memory"
 	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
-	"github.com/MaximMNsk/go-url-shortener/internal/util/shorter"
-	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/search"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
 	"sync"
+	"time"
 )
 
 type MemStorage struct {
@@ -17,6 +19,8 @@ type MemStorage struct {
 	ID        string `json:"correlation_id"`
 	Ctx       context.Context
 	Storage   memoryStorage.Storage
+	// index поиск по ссылкам, обновляется после их изменения
+	index search.Cache
 }
 
 func (jsonData *MemStorage) Init(link, shortLink, id string, ctx context.Context) {
@@ -37,81 +41,170 @@ func (jsonData *MemStorage) Get() (string, error) {
 	storageData := jsonData.Storage.Get()
 
 	if len(storageData) == 0 {
-		return "", errors.New("data not found")
+		return "", model.ErrNotFound
 	}
 
 	for _, v := range storageData {
 		if v.ID == jsonData.ID || v.Link == jsonData.Link {
+			if v.Disabled {
+				return "", model.ErrDisabled
+			}
 			return v.Link, nil
 		}
 	}
-	return "", errors.New("data not found")
+	return "", model.ErrNotFound
 }
 
-func (jsonData *MemStorage) Set() error {
+func (jsonData *MemStorage) Set(info model.LinkInfo) error {
 
 	logger.PrintLog(logger.INFO, "Set to memory")
 
-	var mx sync.Mutex
-	mx.Lock()
-	defer mx.Unlock()
+	var toStore = memoryStorage.StorageItem{
+		Link:        info.OriginalURL,
+		ShortLink:   info.ShortURL,
+		ID:          info.ID,
+		UserID:      info.UserID,
+		CreatedAt:   time.Now(),
+		LinkOptions: info.LinkOptions,
+	}
+	existing, rejected := jsonData.Storage.Insert([]memoryStorage.StorageItem{toStore}, true)
+	if existing[0] != "" {
+		return model.ErrConflict
+	}
+	return rejected[0]
+}
 
-	storageData := jsonData.Storage.Get()
+func (jsonData *MemStorage) BatchSet(userID string, batch []byte, atomic bool) ([]byte, error) {
 
-	if len(storageData) != 0 {
-		for _, v := range storageData {
-			if v.Link == jsonData.Link {
-				return nil
-			}
+	var savingData []api.BatchRequestItem
+	err := json.Unmarshal(batch, &savingData)
+	if err != nil {
+		return nil, model.NewError(model.CodeInvalid, "invalid batch", err)
+	}
+
+	toStore := make([]memoryStorage.StorageItem, 0, len(savingData))
+	for _, v := range savingData {
+		key := domains.Key(v.Domain, v.CorrelationID)
+		toStore = append(toStore, memoryStorage.StorageItem{
+			Link:        v.OriginalURL,
+			ShortLink:   domains.ShortURL(key),
+			ID:          key,
+			UserID:      userID,
+			CreatedAt:   time.Now(),
+			LinkOptions: v.LinkOptions,
+		})
+	}
+	existing, rejected := jsonData.Storage.Insert(toStore, atomic)
+
+	outputData := make([]api.BatchResponseItem, 0, len(toStore))
+	for i, v := range toStore {
+		item := api.BatchResponseItem{CorrelationID: savingData[i].CorrelationID, ShortURL: v.ShortLink, Status: model.BatchCreated}
+		if existing[i] != "" {
+			item.ShortURL = existing[i]
+			item.Status = model.BatchExists
 		}
+		outputData = append(outputData, item)
 	}
+	batchErr := api.BatchError(outputData, rejected, atomic)
 
-	var toStore = memoryStorage.StorageItem{
-		Link:      jsonData.Link,
-		ShortLink: jsonData.ShortLink,
-		ID:        jsonData.ID,
+	JSONResp, err := json.Marshal(outputData)
+	if err != nil {
+		logger.PrintLog(logger.WARN, err.Error())
+		return nil, err
 	}
-	jsonData.Storage.Set(toStore)
+	return JSONResp, batchErr
+}
 
-	return nil
+func (jsonData *MemStorage) Stats() (model.Stats, error) {
+
+	var stats model.Stats
+	users := make(map[string]bool)
+	for _, v := range jsonData.Storage.Get() {
+		stats.URLs++
+		if v.UserID != "" {
+			users[v.UserID] = true
+		}
+	}
+	stats.Users = len(users)
+
+	return stats, nil
 }
 
-type outputBatch struct {
-	CorrelationID string `json:"correlation_id"`
-	ShortURL      string `json:"short_url"`
+func (jsonData *MemStorage) Lookup(id string) (model.LinkInfo, error) {
+
+	for _, v := range jsonData.Storage.Get() {
+		if v.ID == id {
+			return toLinkInfo(v), nil
+		}
+	}
+	return model.LinkInfo{}, model.ErrNotFound
 }
 
-func (jsonData *MemStorage) BatchSet() ([]byte, error) {
+func (jsonData *MemStorage) Disable(id string) error {
 
-	var mx sync.Mutex
-	mx.Lock()
-	defer mx.Unlock()
+	isFound := jsonData.Storage.Update(id, func(item *memoryStorage.StorageItem) {
+		item.Disabled = true
+	})
+	if !isFound {
+		return model.ErrNotFound
+	}
+	return nil
+}
 
-	var savingData []MemStorage
-	var outputData []outputBatch
+func (jsonData *MemStorage) Purge(id string) error {
 
-	err := json.Unmarshal([]byte(jsonData.Link), &savingData)
-	if err != nil {
-		return nil, err
+	if !jsonData.Storage.Delete(id) {
+		return model.ErrNotFound
 	}
+	return nil
+}
+
+func (jsonData *MemStorage) UserLinks(userID string) ([]model.LinkInfo, error) {
+
+	var links []model.LinkInfo
+	err := jsonData.ScanUserLinks(userID, func(info model.LinkInfo) error {
+		links = append(links, info)
+		return nil
+	})
+	return links, err
+}
+
+func (jsonData *MemStorage) ScanUserLinks(userID string, fn func(info model.LinkInfo) error) error {
 
-	for i, v := range savingData {
-		shortLink := shorter.GetShortURL(confModule.Config.Final.ShortURLAddr, v.ID)
-		savingData[i].ShortLink = shortLink
-		//storage[savingData[i].ID] = savingData[i]
-		var toStore = memoryStorage.StorageItem{
-			Link:      savingData[i].Link,
-			ShortLink: shortLink,
-			ID:        savingData[i].ID,
+	for _, v := range jsonData.Storage.Get() {
+		if v.UserID == userID && !v.Disabled {
+			err := fn(toLinkInfo(v))
+			if err != nil {
+				return err
+			}
 		}
-		jsonData.Storage.Set(toStore)
-		outputData = append(outputData, outputBatch{ShortURL: shortLink, CorrelationID: v.ID})
 	}
+	return nil
+}
 
-	JSONResp, err := json.Marshal(outputData)
-	if err != nil {
-		logger.PrintLog(logger.WARN, err.Error())
+func (jsonData *MemStorage) DeleteUserLinks(userID string, ids []string) error {
+
+	for _, id := range ids {
+		jsonData.Storage.Update(id, func(item *memoryStorage.StorageItem) {
+			if item.UserID == userID {
+				item.Disabled = true
+			}
+		})
 	}
+	return nil
+}
 
-	return JSONResp, nil
+func toLinkInfo(item memoryStorage.StorageItem) model.LinkInfo {
+	return model.LinkInfo{
+		ID:          item.ID,
+		ShortURL:    item.ShortLink,
+		OriginalURL: item.Link,
+		UserID:      item.UserID,
+		Disabled:    item.Disabled,
+		Clicks:      item.Clicks,
+		CreatedAt:   &item.CreatedAt,
+		Metadata:    item.Metadata,
+		Health:      item.Health,
+		LinkOptions: item.LinkOptions,
+	}
 }
@@ -0,0 +1,37 @@
+package memory
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"sort"
+)
+
+func (jsonData *MemStorage) Templates() ([]model.Template, error) {
+	var templates []model.Template
+	for _, v := range jsonData.Storage.GetTemplates() {
+		templates = append(templates, v)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
+
+func (jsonData *MemStorage) GetTemplate(name string) (model.Template, error) {
+	template, ok := jsonData.Storage.GetTemplates()[name]
+	if !ok {
+		return model.Template{}, model.ErrNotFound
+	}
+	return template, nil
+}
+
+func (jsonData *MemStorage) SetTemplate(template model.Template) error {
+	jsonData.Storage.SetTemplate(template)
+	return nil
+}
+
+func (jsonData *MemStorage) DeleteTemplate(name string) error {
+	if !jsonData.Storage.DeleteTemplate(name) {
+		return model.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package memory
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	memoryStorage "github.com/MaximMNsk/go-url-shortener/internal/storage/memory"
+)
+
+func (jsonData *MemStorage) UpdateOptions(id string, options model.LinkOptions) error {
+	isFound := jsonData.Storage.Update(id, func(item *memoryStorage.StorageItem) {
+		item.LinkOptions = options
+	})
+	if !isFound {
+		return model.ErrNotFound
+	}
+	return nil
+}
+
+// Consume атомарно засчитывает переход, если лимит переходов не исчерпан
+func (jsonData *MemStorage) Consume(id string) error {
+	var err error
+	isFound := jsonData.Storage.Update(id, func(item *memoryStorage.StorageItem) {
+		if item.Disabled || item.MaxClicks > 0 && item.Clicks >= item.MaxClicks {
+			err = model.ErrDisabled
+			return
+		}
+		item.Clicks++
+	})
+	if !isFound {
+		return model.ErrNotFound
+	}
+	return err
+}
+
+func (jsonData *MemStorage) RecordVariant(id, variant string) error {
+	jsonData.Storage.AddHit(id, variant)
+	return nil
+}
+
+func (jsonData *MemStorage) VariantHits(id string) (map[string]int, error) {
+	return jsonData.Storage.GetHits(id), nil
+}
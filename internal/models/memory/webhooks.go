@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"sort"
+	"time"
+)
+
+func (jsonData *MemStorage) Webhooks() ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	for _, v := range jsonData.Storage.GetWebhooks() {
+		webhooks = append(webhooks, v)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].Name < webhooks[j].Name
+	})
+	return webhooks, nil
+}
+
+func (jsonData *MemStorage) SetWebhook(webhook model.Webhook) error {
+	jsonData.Storage.SetWebhook(webhook)
+	return nil
+}
+
+func (jsonData *MemStorage) DeleteWebhook(name string) error {
+	if !jsonData.Storage.DeleteWebhook(name) {
+		return model.ErrNotFound
+	}
+	return nil
+}
+
+func (jsonData *MemStorage) SaveDelivery(delivery model.Delivery) error {
+	jsonData.Storage.SaveDelivery(delivery)
+	return nil
+}
+
+func (jsonData *MemStorage) PruneDeliveries(before time.Time) error {
+	jsonData.Storage.PruneDeliveries(before)
+	return nil
+}
+
+func (jsonData *MemStorage) Deliveries(status string) ([]model.Delivery, error) {
+	var deliveries []model.Delivery
+	for _, v := range jsonData.Storage.GetDeliveries() {
+		if status == "" || v.Status == status {
+			deliveries = append(deliveries, v)
+		}
+	}
+	return deliveries, nil
+}
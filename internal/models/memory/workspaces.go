@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"sort"
+)
+
+func (jsonData *MemStorage) Workspaces(userID string) ([]model.Workspace, error) {
+	var workspaces []model.Workspace
+	for _, v := range jsonData.Storage.GetWorkspaces() {
+		if v.Role(userID) != "" {
+			workspaces = append(workspaces, v)
+		}
+	}
+	sort.Slice(workspaces, func(i, j int) bool {
+		return workspaces[i].Name < workspaces[j].Name
+	})
+	return workspaces, nil
+}
+
+func (jsonData *MemStorage) GetWorkspace(id string) (model.Workspace, error) {
+	workspace, ok := jsonData.Storage.GetWorkspaces()[id]
+	if !ok {
+		return model.Workspace{}, model.ErrWorkspaceNotFound
+	}
+	return workspace, nil
+}
+
+func (jsonData *MemStorage) SetWorkspace(workspace model.Workspace) error {
+	jsonData.Storage.SetWorkspace(workspace)
+	return nil
+}
+
+func (jsonData *MemStorage) DeleteWorkspace(id string) error {
+	if !jsonData.Storage.DeleteWorkspace(id) {
+		return model.ErrWorkspaceNotFound
+	}
+	return nil
+}
+
+func (jsonData *MemStorage) WorkspaceStats(id string) (model.WorkspaceStats, error) {
+	var stats model.WorkspaceStats
+	for _, v := range jsonData.Storage.Get() {
+		if v.Workspace == id && !v.Disabled {
+			stats.Links++
+			stats.Clicks += v.Clicks
+		}
+	}
+	return stats, nil
+}
@@ -4,13 +4,13 @@ import (
 	"context"
 	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
 	"github.com/MaximMNsk/go-url-shortener/server/config"
-	"github.com/jackc/pgx/v5"
-	_ "github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
+// db пул соединений: обработчики запросов и фоновые задачи ходят в БД параллельно
 var (
-	db *pgx.Conn
+	db *pgxpool.Pool
 )
 
 var ctx context.Context
@@ -18,12 +18,21 @@ var ctx context.Context
 func Connect() error {
 	ctx = context.Background()
 	logger.PrintLog(logger.INFO, config.Config.Final.DB)
-	database, err := pgx.Connect(ctx, config.Config.Final.DB)
+	database, err := pgxpool.New(ctx, config.Config.Final.DB)
+	if err != nil {
+		return err
+	}
+	// Пул соединяется лениво, проверяем БД сразу
+	err = database.Ping(ctx)
+	if err != nil {
+		database.Close()
+		return err
+	}
 	db = database
-	return err
+	return nil
 }
 
-func GetDB() *pgx.Conn {
+func GetDB() *pgxpool.Pool {
 	return db
 }
 
@@ -32,10 +41,10 @@ func GetCtx() context.Context {
 }
 
 func Close() error {
-	err := db.Close(ctx)
-	if err != nil {
-		logger.PrintLog(logger.ERROR, "Can't close connection")
-		return err
+	if db == nil {
+		return nil
 	}
+	db.Close()
+	db = nil
 	return nil
 }
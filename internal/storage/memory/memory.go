@@ -1,13 +1,42 @@
 package memorystorage
 
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"sync"
+	"time"
+)
+
 type StorageItem struct {
 	Link      string
 	ShortLink string
 	ID        string
+	UserID    string
+	Disabled  bool
+	Clicks    int
+	CreatedAt time.Time
+	History   []model.LinkVersion
+	Metadata  *model.Metadata
+	Health    *model.Health
+	model.LinkOptions
 }
 
 type Storage struct {
-	data []StorageItem
+	mx         sync.RWMutex
+	data       []StorageItem
+	templates  map[string]model.Template
+	hits       map[string]map[string]int
+	webhooks   map[string]model.Webhook
+	deliveries []model.Delivery
+	// version меняется при каждом изменении ссылок
+	version uint64
+	// idempotency ключи запросов по пользователю и ключу
+	idempotency map[string]model.Idempotency
+	workspaces  map[string]model.Workspace
+}
+
+// urlKey адрес элемента вместе с доменом, адрес уникален в пределах домена
+func (item StorageItem) urlKey() string {
+	return item.Domain + "\n" + item.Link
 }
 
 func (s *Storage) Init() {
@@ -15,9 +44,315 @@ func (s *Storage) Init() {
 }
 
 func (s *Storage) Set(data StorageItem) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
 	s.data = append(s.data, data)
+	s.version++
 }
 
+// Insert добавляет элементы с еще не сохраненными адресами. Для каждого элемента
+// возвращается короткий url ссылки, которая уже была сохранена с тем же адресом, в том
+// числе раньше в этой же пачке, или пустая строка, если элемент добавлен. rejected - ошибка
+// элемента, который не добавлен, потому что его ид уже занят ссылкой с другим адресом
+// (model.ErrIDTaken) или в его пространстве кончилась квота (model.ErrQuotaExceeded).
+// С atomic при любом совпадении не добавляется ничего
+func (s *Storage) Insert(items []StorageItem, atomic bool) (existing []string, rejected []error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	saved := make(map[string]string, len(s.data)+len(items))
+	ids := make(map[string]bool, len(s.data)+len(items))
+	// links активные ссылки пространств, квота считается под той же блокировкой, что и вставка
+	links := make(map[string]int)
+	for _, v := range s.data {
+		saved[v.urlKey()] = v.ShortLink
+		ids[v.ID] = true
+		if v.Workspace != "" && !v.Disabled {
+			links[v.Workspace]++
+		}
+	}
+	existing = make([]string, len(items))
+	rejected = make([]error, len(items))
+	conflict := false
+	for i, v := range items {
+		if shortLink, ok := saved[v.urlKey()]; ok {
+			existing[i] = shortLink
+			conflict = true
+			continue
+		}
+		if ids[v.ID] {
+			rejected[i] = model.ErrIDTaken
+			conflict = true
+			continue
+		}
+		if v.Workspace != "" {
+			quota := s.workspaces[v.Workspace].Quota
+			if quota > 0 && links[v.Workspace] >= quota {
+				rejected[i] = model.ErrQuotaExceeded
+				conflict = true
+				continue
+			}
+			links[v.Workspace]++
+		}
+		saved[v.urlKey()] = v.ShortLink
+		ids[v.ID] = true
+	}
+	if atomic && conflict {
+		return existing, rejected
+	}
+	for i, v := range items {
+		if existing[i] == "" && rejected[i] == nil {
+			s.data = append(s.data, v)
+		}
+	}
+	s.version++
+	return existing, rejected
+}
+
+// Get возвращает копию элементов, Update и Delete меняют сохраненный срез на месте
 func (s *Storage) Get() []StorageItem {
-	return s.data
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	data := make([]StorageItem, len(s.data))
+	copy(data, s.data)
+	return data
+}
+
+// Version возвращает номер изменения ссылок, по нему перестраиваются производные данные
+func (s *Storage) Version() uint64 {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	return s.version
+}
+
+// Update применяет fn к элементу с указанным ид, возвращает false, если элемента нет
+func (s *Storage) Update(id string, fn func(item *StorageItem)) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for i := range s.data {
+		if s.data[i].ID == id {
+			fn(&s.data[i])
+			s.version++
+			return true
+		}
+	}
+	return false
+}
+
+// Edit применяет fn к элементу с указанным ид, если адрес link не занят другим элементом того же домена
+func (s *Storage) Edit(id, link string, fn func(item *StorageItem)) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	index := -1
+	for i := range s.data {
+		if s.data[i].ID == id {
+			index = i
+		}
+	}
+	if index < 0 {
+		return model.ErrNotFound
+	}
+	for i := range s.data {
+		if i != index && s.data[i].Link == link && s.data[i].Domain == s.data[index].Domain {
+			return model.NewError(model.CodeConflict, "link already exists", nil)
+		}
+	}
+	fn(&s.data[index])
+	s.version++
+	return nil
+}
+
+// Delete удаляет элемент с указанным ид, возвращает false, если элемента нет
+func (s *Storage) Delete(id string) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for i := range s.data {
+		if s.data[i].ID == id {
+			s.data = append(s.data[:i], s.data[i+1:]...)
+			s.version++
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Storage) SetTemplate(template model.Template) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.templates == nil {
+		s.templates = make(map[string]model.Template)
+	}
+	s.templates[template.Name] = template
+}
+
+func (s *Storage) GetTemplates() map[string]model.Template {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	templates := make(map[string]model.Template, len(s.templates))
+	for k, v := range s.templates {
+		templates[k] = v
+	}
+	return templates
+}
+
+// DeleteTemplate удаляет шаблон, возвращает false, если шаблона нет
+func (s *Storage) DeleteTemplate(name string) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	_, ok := s.templates[name]
+	delete(s.templates, name)
+	return ok
+}
+
+// AddHit увеличивает счетчик переходов на вариант ссылки
+func (s *Storage) AddHit(id, variant string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.hits == nil {
+		s.hits = make(map[string]map[string]int)
+	}
+	if s.hits[id] == nil {
+		s.hits[id] = make(map[string]int)
+	}
+	s.hits[id][variant]++
+}
+
+func (s *Storage) GetHits(id string) map[string]int {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	hits := make(map[string]int, len(s.hits[id]))
+	for k, v := range s.hits[id] {
+		hits[k] = v
+	}
+	return hits
+}
+
+func (s *Storage) SetWebhook(webhook model.Webhook) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.webhooks == nil {
+		s.webhooks = make(map[string]model.Webhook)
+	}
+	s.webhooks[webhook.Name] = webhook
+}
+
+func (s *Storage) GetWebhooks() map[string]model.Webhook {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	webhooks := make(map[string]model.Webhook, len(s.webhooks))
+	for k, v := range s.webhooks {
+		webhooks[k] = v
+	}
+	return webhooks
+}
+
+// DeleteWebhook удаляет подписку, возвращает false, если подписки нет
+func (s *Storage) DeleteWebhook(name string) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	_, ok := s.webhooks[name]
+	delete(s.webhooks, name)
+	return ok
+}
+
+// SaveDelivery добавляет доставку или заменяет доставку с тем же ид
+func (s *Storage) SaveDelivery(delivery model.Delivery) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	for i := range s.deliveries {
+		if s.deliveries[i].ID == delivery.ID {
+			s.deliveries[i] = delivery
+			return
+		}
+	}
+	s.deliveries = append(s.deliveries, delivery)
+}
+
+// PruneDeliveries удаляет доставки, доставленные раньше before
+func (s *Storage) PruneDeliveries(before time.Time) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	kept := s.deliveries[:0]
+	for _, v := range s.deliveries {
+		if v.Status != model.DeliveryDelivered || v.DeliveredAt == nil || !v.DeliveredAt.Before(before) {
+			kept = append(kept, v)
+		}
+	}
+	s.deliveries = kept
+}
+
+func (s *Storage) GetDeliveries() []model.Delivery {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	return append([]model.Delivery(nil), s.deliveries...)
+}
+
+func (s *Storage) SetWorkspace(workspace model.Workspace) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.workspaces == nil {
+		s.workspaces = make(map[string]model.Workspace)
+	}
+	workspace.Members = append([]model.Member(nil), workspace.Members...)
+	s.workspaces[workspace.ID] = workspace
+}
+
+func (s *Storage) GetWorkspaces() map[string]model.Workspace {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	workspaces := make(map[string]model.Workspace, len(s.workspaces))
+	for k, v := range s.workspaces {
+		v.Members = append([]model.Member(nil), v.Members...)
+		workspaces[k] = v
+	}
+	return workspaces
+}
+
+// DeleteWorkspace удаляет пространство, возвращает false, если его нет
+func (s *Storage) DeleteWorkspace(id string) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	_, ok := s.workspaces[id]
+	delete(s.workspaces, id)
+	return ok
+}
+
+func idempotencyKey(userID, key string) string {
+	return userID + "\x00" + key
+}
+
+// ReserveIdempotency сохраняет ключ, если действующего ключа нет, и возвращает true.
+// Иначе возвращает сохраненный ключ и false. Истекшие ключи при этом удаляются
+func (s *Storage) ReserveIdempotency(record model.Idempotency, now time.Time) (model.Idempotency, bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.idempotency == nil {
+		s.idempotency = make(map[string]model.Idempotency)
+	}
+	for k, v := range s.idempotency {
+		if v.IsExpired(now) {
+			delete(s.idempotency, k)
+		}
+	}
+	key := idempotencyKey(record.UserID, record.Key)
+	if saved, ok := s.idempotency[key]; ok {
+		return saved, false
+	}
+	s.idempotency[key] = record
+	return record, true
+}
+
+func (s *Storage) SaveIdempotency(record model.Idempotency) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.idempotency == nil {
+		s.idempotency = make(map[string]model.Idempotency)
+	}
+	s.idempotency[idempotencyKey(record.UserID, record.Key)] = record
+}
+
+func (s *Storage) DeleteIdempotency(userID, key string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	delete(s.idempotency, idempotencyKey(userID, key))
 }
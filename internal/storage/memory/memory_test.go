@@ -0,0 +1,21 @@
+package memorystorage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetReturnsCopy(t *testing.T) {
+	var s Storage
+	s.Set(StorageItem{ID: "first", Link: "https://example.com/first"})
+	s.Set(StorageItem{ID: "second", Link: "https://example.com/second"})
+
+	items := s.Get()
+	assert.True(t, s.Delete("first"))
+	assert.True(t, s.Update("second", func(item *StorageItem) { item.Clicks++ }))
+
+	// Изменения хранилища не видны в уже отданных элементах
+	assert.Equal(t, []string{"first", "second"}, []string{items[0].ID, items[1].ID})
+	assert.Equal(t, 0, items[1].Clicks)
+	assert.Len(t, s.Get(), 1)
+}
@@ -0,0 +1,189 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/safehttp"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DefaultTimeout  = 5 * time.Second
+	DefaultMaxBytes = 512 << 10
+	maxTextLength   = 300
+)
+
+var ErrNotHTML = errors.New("destination is not an html page")
+
+// Page данные страницы, нужные для карточки ссылки
+type Page struct {
+	Title       string
+	Description string
+	Image       string
+}
+
+// Fetcher загружает страницу и достает из нее заголовок и Open Graph теги.
+// Client можно подменить, например, клиентом httptest сервера
+type Fetcher struct {
+	Client   *http.Client
+	MaxBytes int64
+}
+
+// NewFetcher возвращает загрузчик с клиентом client, при nil используется
+// клиент с таймаутом, который не ходит на внутренние адреса
+func NewFetcher(client *http.Client) *Fetcher {
+	if client == nil {
+		client = safehttp.NewClient(DefaultTimeout)
+	}
+	return &Fetcher{Client: client, MaxBytes: DefaultMaxBytes}
+}
+
+// Fetch загружает страницу по адресу link, читает не больше MaxBytes
+func (f *Fetcher) Fetch(ctx context.Context, link string) (Page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return Page{}, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	req.Header.Set("User-Agent", "go-url-shortener metadata fetcher")
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return Page{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Page{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+			return Page{}, ErrNotHTML
+		}
+	}
+
+	maxBytes := f.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	return Parse(io.LimitReader(resp.Body, maxBytes), resp.Request.URL), nil
+}
+
+// Parse разбирает html до конца head. Open Graph теги важнее title и
+// description, относительный адрес картинки разрешается от base
+func Parse(r io.Reader, base *url.URL) Page {
+	var page, og Page
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return page.merge(og, base)
+		case html.TextToken:
+			if inTitle {
+				page.Title += string(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				return page.merge(og, base)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = page.Title == ""
+			case atom.Body:
+				return page.merge(og, base)
+			case atom.Meta:
+				if hasAttr {
+					readMeta(tokenizer, &page, &og)
+				}
+			}
+		}
+	}
+}
+
+func readMeta(tokenizer *html.Tokenizer, page, og *Page) {
+	var key, content string
+	for {
+		name, value, more := tokenizer.TagAttr()
+		switch string(name) {
+		case "property", "name":
+			if key == "" || strings.HasPrefix(strings.ToLower(string(value)), "og:") {
+				key = strings.ToLower(string(value))
+			}
+		case "content":
+			content = string(value)
+		}
+		if !more {
+			break
+		}
+	}
+
+	switch key {
+	case "og:title":
+		og.Title = content
+	case "og:description":
+		og.Description = content
+	case "og:image", "og:image:url", "og:image:secure_url":
+		if og.Image == "" {
+			og.Image = content
+		}
+	case "description":
+		page.Description = content
+	}
+}
+
+func (p Page) merge(og Page, base *url.URL) Page {
+	if og.Title != "" {
+		p.Title = og.Title
+	}
+	if og.Description != "" {
+		p.Description = og.Description
+	}
+	p.Title = clean(p.Title)
+	p.Description = clean(p.Description)
+	p.Image = resolve(strings.TrimSpace(og.Image), base)
+	return p
+}
+
+// clean схлопывает пробелы и обрезает слишком длинный текст
+func clean(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= maxTextLength {
+		return text
+	}
+	return string([]rune(text)[:maxTextLength])
+}
+
+// resolve возвращает абсолютный http(s) адрес картинки или пустую строку
+func resolve(image string, base *url.URL) string {
+	if image == "" {
+		return ""
+	}
+	imageURL, err := url.Parse(image)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		imageURL = base.ResolveReference(imageURL)
+	}
+	if imageURL.Scheme != "http" && imageURL.Scheme != "https" {
+		return ""
+	}
+	return imageURL.String()
+}
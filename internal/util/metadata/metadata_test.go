@@ -0,0 +1,107 @@
+package metadata
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/safehttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	base, err := url.Parse("https://example.com/blog/post")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		html string
+		want Page
+	}{
+		{
+			name: "Title and description",
+			html: `<html><head><title> Hello &amp;
+				world </title><meta name="description" content="About"></head></html>`,
+			want: Page{Title: "Hello & world", Description: "About"},
+		},
+		{
+			name: "Open Graph wins",
+			html: `<head><title>Page</title><meta name="description" content="About">
+				<meta property="og:title" content="OG title"><meta property="og:description" content="OG about">
+				<meta property="og:image" content="/img/cover.png"></head>`,
+			want: Page{Title: "OG title", Description: "OG about", Image: "https://example.com/img/cover.png"},
+		},
+		{
+			name: "Content before property",
+			html: `<meta content="https://cdn.example.com/a.jpg" property="og:image">`,
+			want: Page{Image: "https://cdn.example.com/a.jpg"},
+		},
+		{
+			name: "Script image dropped",
+			html: `<meta property="og:image" content="javascript:alert(1)">`,
+			want: Page{},
+		},
+		{
+			name: "Body is not read",
+			html: `<head></head><body><title>Inside body</title></body>`,
+			want: Page{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Parse(strings.NewReader(tt.html), base))
+		})
+	}
+
+	long := Parse(strings.NewReader("<title>"+strings.Repeat("a", 1000)+"</title>"), base)
+	assert.Len(t, long.Title, maxTextLength)
+}
+
+func TestFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<title>Page</title><meta property="og:image" content="cover.png">`))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<!--" + strings.Repeat("x", 2048) + "--><title>Too far</title>"))
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	fetcher := NewFetcher(ts.Client())
+	fetcher.MaxBytes = 1024
+
+	page, err := fetcher.Fetch(context.Background(), ts.URL+"/page")
+	require.NoError(t, err)
+	assert.Equal(t, Page{Title: "Page", Image: ts.URL + "/cover.png"}, page)
+
+	page, err = fetcher.Fetch(context.Background(), ts.URL+"/redirect")
+	require.NoError(t, err)
+	assert.Equal(t, "Page", page.Title)
+
+	page, err = fetcher.Fetch(context.Background(), ts.URL+"/huge")
+	require.NoError(t, err)
+	assert.Empty(t, page.Title)
+
+	_, err = fetcher.Fetch(context.Background(), ts.URL+"/image")
+	assert.ErrorIs(t, err, ErrNotHTML)
+
+	_, err = fetcher.Fetch(context.Background(), ts.URL+"/missing")
+	assert.Error(t, err)
+
+	// Клиент по умолчанию не ходит на локальные адреса
+	_, err = NewFetcher(nil).Fetch(context.Background(), ts.URL+"/page")
+	assert.ErrorIs(t, err, safehttp.ErrPrivateTarget)
+}
@@ -0,0 +1,53 @@
+package probe
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/safehttp"
+	"io"
+	"net/http"
+	"time"
+)
+
+const DefaultTimeout = 10 * time.Second
+
+// Prober проверяет, что адрес отвечает. Client можно подменить,
+// например, клиентом httptest сервера
+type Prober struct {
+	Client *http.Client
+}
+
+// NewProber возвращает проверку с клиентом client, при nil используется
+// клиент с таймаутом, который не ходит на внутренние адреса
+func NewProber(client *http.Client) *Prober {
+	if client == nil {
+		client = safehttp.NewClient(DefaultTimeout)
+	}
+	return &Prober{Client: client}
+}
+
+// Check возвращает код ответа на HEAD. Часть серверов не умеет HEAD
+// или отвечает на него ошибкой, тогда код берется из GET
+func (p *Prober) Check(ctx context.Context, link string) (int, error) {
+	status, err := p.do(ctx, http.MethodHead, link)
+	if err == nil && status < http.StatusBadRequest {
+		return status, nil
+	}
+	return p.do(ctx, http.MethodGet, link)
+}
+
+func (p *Prober) do(ctx context.Context, method, link string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "go-url-shortener link checker")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Немного читаем тело, чтобы соединение вернулось в пул
+	_, _ = io.CopyN(io.Discard, resp.Body, 4<<10)
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,49 @@
+package probe
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/gone", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/gone", http.NotFound)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		link    string
+		status  int
+		wantErr bool
+	}{
+		{name: "Head", link: ts.URL + "/ok", status: http.StatusOK},
+		{name: "Get after failed head", link: ts.URL + "/no-head", status: http.StatusOK},
+		{name: "Redirect to missing", link: ts.URL + "/moved", status: http.StatusNotFound},
+		{name: "Bad url", link: "http://%zz", wantErr: true},
+	}
+	prober := NewProber(ts.Client())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := prober.Check(context.Background(), tt.link)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, status)
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package qrcode
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// Пример HELLO WORLD, версия 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	assert.Equal(t, want, reedSolomonRemainder(data, reedSolomonDivisor(len(want))))
+}
+
+// readFormat читает уровень и маску из первой копии служебной информации
+func readFormat(t *testing.T, c *Code) (Level, int) {
+	bits := 0
+	read := func(x, y, i int) {
+		if c.Black(x, y) {
+			bits |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		read(8, i, i)
+	}
+	read(8, 7, 6)
+	read(8, 8, 7)
+	read(7, 8, 8)
+	for i := 9; i < 15; i++ {
+		read(14-i, 8, i)
+	}
+	bits ^= 0x5412
+
+	rem := bits
+	for i := 14; i >= 10; i-- {
+		if rem>>i&1 != 0 {
+			rem ^= 0x537 << (i - 10)
+		}
+	}
+	require.Zero(t, rem, "format bits are damaged")
+	for level, v := range formatBits {
+		if v == bits>>13 {
+			return Level(level), bits >> 10 & 7
+		}
+	}
+	t.Fatal("unknown level")
+	return 0, 0
+}
+
+// decode читает данные из кода, проверяя синдромы каждого блока
+func decode(t *testing.T, c *Code) []byte {
+	level, mask := readFormat(t, c)
+	require.Equal(t, c.Level, level)
+	c.applyMask(mask)
+	defer c.applyMask(mask)
+
+	var codewords []byte
+	var current byte
+	count := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if c.isFunction[y][x] {
+					continue
+				}
+				current <<= 1
+				if c.Black(x, y) {
+					current |= 1
+				}
+				if count++; count%8 == 0 {
+					codewords = append(codewords, current)
+				}
+			}
+		}
+	}
+
+	numBlocks := eccBlocks[level][c.Version]
+	eccLen := eccCodewordsPerBlock[level][c.Version]
+	rawCodewords := rawDataModules(c.Version) / 8
+	require.GreaterOrEqual(t, len(codewords), rawCodewords)
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortBlockLen-eccLen; i++ {
+		for b := range blocks {
+			if i < shortBlockLen-eccLen || b >= numShortBlocks {
+				blocks[b] = append(blocks[b], codewords[k])
+				k++
+			}
+		}
+	}
+	dataLens := make([]int, numBlocks)
+	for b := range blocks {
+		dataLens[b] = len(blocks[b])
+	}
+	for i := 0; i < eccLen; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for b, block := range blocks {
+		// Блок с кодом коррекции делится на порождающий многочлен без остатка: r(α^i) = 0
+		root := byte(1)
+		for i := 0; i < eccLen; i++ {
+			var syndrome byte
+			for _, v := range block {
+				syndrome = reedSolomonMultiply(syndrome, root) ^ v
+			}
+			require.Zero(t, syndrome, "block %d syndrome %d", b, i)
+			root = reedSolomonMultiply(root, 0x02)
+		}
+		data = append(data, block[:dataLens[b]]...)
+	}
+
+	bit := func(i int) int { return int(data[i>>3]>>(7-i&7)) & 1 }
+	read := func(pos, length int) int {
+		value := 0
+		for i := 0; i < length; i++ {
+			value = value<<1 | bit(pos+i)
+		}
+		return value
+	}
+	require.Equal(t, 0b0100, read(0, 4), "byte mode expected")
+	length := read(4, countBits(c.Version))
+	result := make([]byte, length)
+	for i := range result {
+		result[i] = byte(read(4+countBits(c.Version)+i*8, 8))
+	}
+	return result
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		level   Level
+		version int
+	}{
+		{name: "Short url low", data: "http://localhost:8080/abcdef12", level: Low, version: 2},
+		{name: "Version 1 limit", data: strings.Repeat("a", 17), level: Low, version: 1},
+		{name: "Version 1 high", data: strings.Repeat("a", 7), level: High, version: 1},
+		{name: "Version 2 high", data: strings.Repeat("a", 8), level: High, version: 2},
+		{name: "Version info", data: strings.Repeat("b", 200), level: Medium, version: 10},
+		{name: "Mixed blocks", data: strings.Repeat("c", 60), level: Quartile, version: 5},
+		{name: "Version 40", data: strings.Repeat("d", 2953), level: Low, version: 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Encode([]byte(tt.data), tt.level)
+			require.NoError(t, err)
+			assert.Equal(t, tt.version, c.Version)
+			assert.Equal(t, tt.version*4+17, c.Size)
+			assert.Equal(t, tt.data, string(decode(t, c)))
+		})
+	}
+
+	_, err := Encode([]byte(strings.Repeat("d", 2954)), Low)
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+func TestRender(t *testing.T) {
+	c, err := Encode([]byte("http://localhost:8080/abcdef12"), Medium)
+	require.NoError(t, err)
+	fg, ok := ParseColor("#112233")
+	require.True(t, ok)
+	bg, ok := ParseColor("ffffff")
+	require.True(t, ok)
+	_, ok = ParseColor("red")
+	assert.False(t, ok)
+
+	style := Style{Size: 256, Margin: 4, Foreground: fg, Background: bg}
+	data, err := c.PNG(style)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 256, img.Bounds().Dx())
+
+	// Левый верхний модуль поискового узора темный, поле светлое
+	_, scale, offset := c.modulePixels(style)
+	r, g, b, _ := img.At(offset, offset).RGBA()
+	assert.Equal(t, [3]uint32{0x1111, 0x2222, 0x3333}, [3]uint32{r, g, b})
+	r, g, b, _ = img.At(offset-scale, offset).RGBA()
+	assert.Equal(t, [3]uint32{0xffff, 0xffff, 0xffff}, [3]uint32{r, g, b})
+
+	svg := string(c.SVG(style))
+	assert.True(t, strings.HasPrefix(svg, "<svg"))
+	assert.Contains(t, svg, `fill="#112233"`)
+	assert.Contains(t, svg, `viewBox="0 0 37 37"`)
+}
@@ -0,0 +1,95 @@
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+// Style оформление картинки: сторона в пикселях, поле в модулях и цвета
+type Style struct {
+	Size       int
+	Margin     int
+	Foreground color.RGBA
+	Background color.RGBA
+}
+
+// ParseColor разбирает цвет вида ff0000 или #ff0000
+func ParseColor(s string) (color.RGBA, bool) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return color.RGBA{}, false
+	}
+	value, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, false
+	}
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 0xff}, true
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// modulePixels возвращает размер модуля в пикселях и отступ, чтобы код встал по центру
+func (c *Code) modulePixels(style Style) (int, int, int) {
+	modules := c.Size + 2*style.Margin
+	scale := style.Size / modules
+	if scale < 1 {
+		scale = 1
+	}
+	size := style.Size
+	if size < modules*scale {
+		size = modules * scale
+	}
+	offset := (size-modules*scale)/2 + style.Margin*scale
+	return size, scale, offset
+}
+
+// PNG рисует код в двухцветную png, модули целые, остаток стороны уходит в поле
+func (c *Code) PNG(style Style) ([]byte, error) {
+	size, scale, offset := c.modulePixels(style)
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{style.Background, style.Foreground})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Black(x, y) {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				row := img.Pix[(offset+y*scale+dy)*img.Stride:]
+				for dx := 0; dx < scale; dx++ {
+					row[offset+x*scale+dx] = 1
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG рисует код одним path в координатах модулей
+func (c *Code) SVG(style Style) []byte {
+	modules := c.Size + 2*style.Margin
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		style.Size, style.Size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"/><path fill="%s" d="`, hexColor(style.Background), hexColor(style.Foreground))
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Black(x, y) {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+style.Margin, y+style.Margin)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
@@ -0,0 +1,216 @@
+package search
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Поля сортировки ссылок
+const (
+	FieldCreatedAt = "created_at"
+	FieldClicks    = "clicks"
+	FieldURL       = "url"
+)
+
+var errInvalidCursor = model.NewError(model.CodeInvalid, "invalid cursor", nil)
+
+// ParseSort возвращает поле и направление сортировки, пустая сортировка - сначала новые
+func ParseSort(value string) (field string, desc bool, err error) {
+	if value == "" {
+		value = model.SortNewest
+	}
+	field, desc = strings.TrimPrefix(value, "-"), strings.HasPrefix(value, "-")
+	switch field {
+	case FieldCreatedAt, FieldClicks, FieldURL:
+		return field, desc, nil
+	}
+	return "", false, model.NewError(model.CodeInvalid, "unsupported sort "+value, nil)
+}
+
+// Cursor место, где закончилась страница: значение поля сортировки и ид последней ссылки
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// Encode возвращает непрозрачную строку курсора
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor разбирает курсор, выданный для той же сортировки
+func DecodeCursor(value, sort string) (Cursor, error) {
+	var cursor Cursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, errInvalidCursor
+	}
+	err = json.Unmarshal(data, &cursor)
+	if err != nil || cursor.ID == "" {
+		return cursor, errInvalidCursor
+	}
+	if cursor.Sort != sort {
+		return cursor, model.NewError(model.CodeInvalid, "cursor belongs to another sort", nil)
+	}
+	return cursor, nil
+}
+
+// Arg значение курсора для запроса к базе по полю field
+func (c Cursor) Arg(field string) (any, error) {
+	if field == FieldURL {
+		return c.Value, nil
+	}
+	number, err := strconv.ParseInt(c.Value, 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	if field == FieldCreatedAt {
+		return time.Unix(0, number).UTC(), nil
+	}
+	return number, nil
+}
+
+// SortValue значение поля сортировки ссылки в виде строки курсора. Ссылки без
+// времени создания считаются созданными в начале эпохи
+func SortValue(info model.LinkInfo, field string) string {
+	switch field {
+	case FieldClicks:
+		return strconv.Itoa(info.Clicks)
+	case FieldURL:
+		return info.OriginalURL
+	}
+	if info.CreatedAt == nil {
+		return "0"
+	}
+	return strconv.FormatInt(info.CreatedAt.UnixNano(), 10)
+}
+
+// NextCursor курсор страницы, которая начнется после ссылки last
+func NextCursor(last model.LinkInfo, sort string) string {
+	field, _, _ := ParseSort(sort)
+	if sort == "" {
+		sort = model.SortNewest
+	}
+	return Cursor{Sort: sort, Value: SortValue(last, field), ID: last.ID}.Encode()
+}
+
+// compare сравнивает ссылки по полю field, при равенстве - по ид
+func compare(a, b model.LinkInfo, field string) int {
+	var result int
+	switch field {
+	case FieldClicks:
+		result = a.Clicks - b.Clicks
+	case FieldURL:
+		result = strings.Compare(a.OriginalURL, b.OriginalURL)
+	default:
+		at, bt := createdAt(a), createdAt(b)
+		result = at.Compare(bt)
+	}
+	if result != 0 {
+		return result
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+func createdAt(info model.LinkInfo) time.Time {
+	if info.CreatedAt == nil {
+		return time.Unix(0, 0)
+	}
+	return *info.CreatedAt
+}
+
+// Paginate отбирает из ссылок подходящие по метке и папке, сортирует и отдает
+// query.Limit ссылок после курсора. Поиск по словам делается до вызова
+func Paginate(links []model.LinkInfo, query model.LinkQuery) (model.LinkPage, error) {
+	field, desc, err := ParseSort(query.Sort)
+	if err != nil {
+		return model.LinkPage{}, err
+	}
+	sortName := query.Sort
+	if sortName == "" {
+		sortName = model.SortNewest
+	}
+	var after *model.LinkInfo
+	if query.Cursor != "" {
+		cursor, err := DecodeCursor(query.Cursor, sortName)
+		if err != nil {
+			return model.LinkPage{}, err
+		}
+		after, err = cursorLink(cursor, field)
+		if err != nil {
+			return model.LinkPage{}, err
+		}
+	}
+
+	selected := make([]model.LinkInfo, 0, len(links))
+	for _, v := range links {
+		if query.Folder != "" && v.Folder != query.Folder || query.Tag != "" && !hasTag(v.Tags, query.Tag) {
+			continue
+		}
+		if after != nil && !isAfter(v, *after, field, desc) {
+			continue
+		}
+		selected = append(selected, v)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return isAfter(selected[j], selected[i], field, desc)
+	})
+
+	page := model.LinkPage{Links: selected}
+	if query.Limit > 0 && len(selected) > query.Limit {
+		page.Links = selected[:query.Limit]
+		page.NextCursor = NextCursor(page.Links[query.Limit-1], sortName)
+	}
+	return page, nil
+}
+
+// isAfter сообщает, что ссылка a идет после b в порядке сортировки
+func isAfter(a, b model.LinkInfo, field string, desc bool) bool {
+	if desc {
+		return compare(a, b, field) < 0
+	}
+	return compare(a, b, field) > 0
+}
+
+// cursorLink восстанавливает из курсора ссылку, после которой начинается страница
+func cursorLink(cursor Cursor, field string) (*model.LinkInfo, error) {
+	info := &model.LinkInfo{ID: cursor.ID}
+	arg, err := cursor.Arg(field)
+	if err != nil {
+		return nil, err
+	}
+	switch v := arg.(type) {
+	case time.Time:
+		info.CreatedAt = &v
+	case int64:
+		info.Clicks = int(v)
+	case string:
+		info.OriginalURL = v
+	}
+	return info, nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, v := range tags {
+		if v == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// AddLink индексирует ссылку по адресу, ид и заголовку страницы
+func (x *Index) AddLink(info model.LinkInfo) {
+	title := ""
+	if info.Metadata != nil {
+		title = info.Metadata.Title
+	}
+	x.Add(info.ID, info.OriginalURL, info.ID, title)
+}
@@ -0,0 +1,158 @@
+package search
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"strings"
+	"sync"
+)
+
+// gramSize длина n-граммы индекса, слова короче ищутся перебором
+const gramSize = 3
+
+// Terms разбивает запрос на слова в нижнем регистре
+func Terms(q string) []string {
+	return strings.Fields(strings.ToLower(q))
+}
+
+// Index инвертированный индекс по триграммам: для каждой триграммы хранятся
+// документы, в тексте которых она есть. Подстрока ищется пересечением списков
+// ее триграмм с проверкой найденных документов
+type Index struct {
+	texts    map[string]string
+	postings map[string]map[string]bool
+}
+
+func NewIndex() *Index {
+	return &Index{texts: make(map[string]string), postings: make(map[string]map[string]bool)}
+}
+
+// Add индексирует документ id по полям fields. Документ с тем же текстом не переиндексируется
+func (x *Index) Add(id string, fields ...string) {
+	// Поля разделяются переводом строки, в словах запроса его не бывает,
+	// поэтому триграммы на стыке полей ничего не находят
+	text := strings.ToLower(strings.Join(fields, "\n"))
+	if saved, ok := x.texts[id]; ok {
+		if saved == text {
+			return
+		}
+		x.Remove(id)
+	}
+	x.texts[id] = text
+	for _, gram := range grams(text) {
+		if x.postings[gram] == nil {
+			x.postings[gram] = make(map[string]bool)
+		}
+		x.postings[gram][id] = true
+	}
+}
+
+// Remove убирает документ id из индекса
+func (x *Index) Remove(id string) {
+	for _, gram := range grams(x.texts[id]) {
+		delete(x.postings[gram], id)
+		if len(x.postings[gram]) == 0 {
+			delete(x.postings, gram)
+		}
+	}
+	delete(x.texts, id)
+}
+
+// Match возвращает документы, в которых есть каждое из слов terms
+func (x *Index) Match(terms []string) map[string]bool {
+	var found map[string]bool
+	for _, term := range terms {
+		candidates := x.candidates(term)
+		matched := make(map[string]bool, len(candidates))
+		for id := range candidates {
+			if (found == nil || found[id]) && strings.Contains(x.texts[id], term) {
+				matched[id] = true
+			}
+		}
+		found = matched
+		if len(found) == 0 {
+			break
+		}
+	}
+	return found
+}
+
+// candidates документы, в которых есть все триграммы слова
+func (x *Index) candidates(term string) map[string]bool {
+	termGrams := grams(term)
+	if len(termGrams) == 0 {
+		all := make(map[string]bool, len(x.texts))
+		for id := range x.texts {
+			all[id] = true
+		}
+		return all
+	}
+	// Начинаем с самого короткого списка
+	shortest := x.postings[termGrams[0]]
+	for _, gram := range termGrams[1:] {
+		if len(x.postings[gram]) < len(shortest) {
+			shortest = x.postings[gram]
+		}
+	}
+	candidates := make(map[string]bool, len(shortest))
+	for id := range shortest {
+		isFound := true
+		for _, gram := range termGrams {
+			if !x.postings[gram][id] {
+				isFound = false
+				break
+			}
+		}
+		if isFound {
+			candidates[id] = true
+		}
+	}
+	return candidates
+}
+
+func grams(text string) []string {
+	runes := []rune(text)
+	if len(runes) < gramSize {
+		return nil
+	}
+	result := make([]string, 0, len(runes)-gramSize+1)
+	for i := 0; i+gramSize <= len(runes); i++ {
+		result = append(result, string(runes[i:i+gramSize]))
+	}
+	return result
+}
+
+// Cache хранит индекс ссылок и обновляет его, когда меняется версия данных. Данные меняются
+// и без изменения текста, например при переходе по ссылке, поэтому заново индексируются
+// только ссылки с новым текстом, а пропавшие убираются
+type Cache struct {
+	mx      sync.Mutex
+	version string
+	index   *Index
+}
+
+// Match возвращает ссылки, в которых есть каждое из слов terms. Если версия сменилась,
+// scan передает в add все ссылки, и по ним обновляется индекс
+func (c *Cache) Match(version string, scan func(add func(info model.LinkInfo)) error, terms []string) (map[string]bool, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.index == nil {
+		c.index = NewIndex()
+	}
+	if c.version != version || c.version == "" {
+		seen := make(map[string]bool, len(c.index.texts))
+		err := scan(func(info model.LinkInfo) {
+			seen[info.ID] = true
+			c.index.AddLink(info)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for id := range c.index.texts {
+			if !seen[id] {
+				c.index.Remove(id)
+			}
+		}
+		c.version = version
+	}
+	return c.index.Match(terms), nil
+}
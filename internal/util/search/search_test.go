@@ -0,0 +1,131 @@
+package search
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestIndexMatch(t *testing.T) {
+	index := NewIndex()
+	index.Add("docs", "https://example.com/docs", "docs", "Getting Started")
+	index.Add("blog", "https://blog.example.org/post", "blog", "Release notes")
+	index.Add("go", "https://go.dev", "go", "")
+
+	tests := []struct {
+		name string
+		q    string
+		want []string
+	}{
+		{name: "Substring of url", q: "example", want: []string{"docs", "blog"}},
+		{name: "Title ignoring case", q: "STARTED", want: []string{"docs"}},
+		{name: "All words", q: "example notes", want: []string{"blog"}},
+		{name: "Short word", q: "go", want: []string{"go"}},
+		{name: "Across fields", q: "docsdocs", want: []string{}},
+		{name: "Nothing", q: "missing", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := index.Match(Terms(tt.q))
+			var ids []string
+			for id := range found {
+				ids = append(ids, id)
+			}
+			assert.ElementsMatch(t, tt.want, ids)
+		})
+	}
+}
+
+func TestCacheMatch(t *testing.T) {
+	links := []model.LinkInfo{
+		{ID: "docs", OriginalURL: "https://example.com/docs"},
+		{ID: "blog", OriginalURL: "https://example.com/blog"},
+	}
+	scans := 0
+	scan := func(add func(info model.LinkInfo)) error {
+		scans++
+		for _, v := range links {
+			add(v)
+		}
+		return nil
+	}
+	var cache Cache
+
+	found, err := cache.Match("1", scan, Terms("example"))
+	require.NoError(t, err)
+	assert.Len(t, found, 2)
+	_, err = cache.Match("1", scan, Terms("docs"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, scans)
+
+	// Клик меняет версию, но не текст ссылки
+	links[0].Clicks++
+	found, err = cache.Match("2", scan, Terms("docs"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"docs": true}, found)
+
+	links = []model.LinkInfo{{ID: "docs", OriginalURL: "https://example.org/guide"}}
+	found, err = cache.Match("3", scan, Terms("example.com"))
+	require.NoError(t, err)
+	assert.Empty(t, found)
+	found, err = cache.Match("3", scan, Terms("guide"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"docs": true}, found)
+	assert.Len(t, cache.index.texts, 1)
+	for _, ids := range cache.index.postings {
+		assert.NotContains(t, ids, "blog")
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	moment := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) *time.Time {
+		v := moment.Add(time.Duration(minutes) * time.Minute)
+		return &v
+	}
+	links := []model.LinkInfo{
+		{ID: "a", OriginalURL: "https://c.example", Clicks: 5, CreatedAt: at(1), LinkOptions: model.LinkOptions{Tags: []string{"x"}, Folder: "work"}},
+		{ID: "b", OriginalURL: "https://a.example", Clicks: 5, CreatedAt: at(3)},
+		{ID: "c", OriginalURL: "https://b.example", Clicks: 1, CreatedAt: at(2), LinkOptions: model.LinkOptions{Tags: []string{"x", "y"}}},
+		{ID: "d", OriginalURL: "https://d.example", Clicks: 9},
+	}
+
+	tests := []struct {
+		name    string
+		query   model.LinkQuery
+		pages   [][]string
+		wantErr bool
+	}{
+		{name: "Newest first", query: model.LinkQuery{Limit: 3}, pages: [][]string{{"b", "c", "a"}, {"d"}}},
+		{name: "Oldest first", query: model.LinkQuery{Sort: model.SortOldest, Limit: 2}, pages: [][]string{{"d", "a"}, {"c", "b"}}},
+		{name: "Clicks with ties", query: model.LinkQuery{Sort: model.SortClicks, Limit: 2}, pages: [][]string{{"d", "b"}, {"a", "c"}}},
+		{name: "Url", query: model.LinkQuery{Sort: model.SortURL, Limit: 1}, pages: [][]string{{"b"}, {"c"}, {"a"}, {"d"}}},
+		{name: "Tag", query: model.LinkQuery{Tag: "x", Limit: 10}, pages: [][]string{{"c", "a"}}},
+		{name: "Folder", query: model.LinkQuery{Folder: "work"}, pages: [][]string{{"a"}}},
+		{name: "Unknown sort", query: model.LinkQuery{Sort: "title"}, wantErr: true},
+		{name: "Broken cursor", query: model.LinkQuery{Cursor: "!!"}, wantErr: true},
+		{name: "Cursor of another sort", query: model.LinkQuery{Sort: model.SortURL, Cursor: NextCursor(links[0], model.SortClicks)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			for i, want := range tt.pages {
+				page, err := Paginate(links, query)
+				require.NoError(t, err)
+				var ids []string
+				for _, v := range page.Links {
+					ids = append(ids, v.ID)
+				}
+				assert.Equal(t, want, ids)
+				assert.Equal(t, i < len(tt.pages)-1, page.NextCursor != "")
+				query.Cursor = page.NextCursor
+			}
+			if tt.wantErr {
+				_, err := Paginate(links, query)
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/rand"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"net/http"
+	"strings"
+)
+
+const CookieName = "user_id"
+
+const userIDLen = 16
+
+type ctxKey struct{}
+
+type newUserKey struct{}
+
+// WithUserID кладет идентификатор пользователя в контекст
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, userID)
+}
+
+// GetUserID достает идентификатор пользователя из контекста
+func GetUserID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	userID, _ := ctx.Value(ctxKey{}).(string)
+	return userID
+}
+
+// IsNewUser сообщает, что ид выдан этому запросу, потому что валидной куки не было
+func IsNewUser(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	isNew, _ := ctx.Value(newUserKey{}).(bool)
+	return isNew
+}
+
+// Sign подписывает значение секретным ключом из настроек
+func Sign(value string) string {
+	h := hmac.New(sha256.New, []byte(confModule.Config.Final.SecretKey))
+	h.Write([]byte(value))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NewUserID генерирует идентификатор нового пользователя
+func NewUserID() string {
+	return rand.RandStringBytes(userIDLen)
+}
+
+// MakeToken возвращает подписанное значение для куки
+func MakeToken(userID string) string {
+	return userID + "." + Sign(userID)
+}
+
+// ParseToken проверяет подпись и возвращает идентификатор пользователя
+func ParseToken(token string) (string, bool) {
+	userID, signature, found := strings.Cut(token, ".")
+	if !found || userID == "" {
+		return "", false
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(userID))) {
+		return "", false
+	}
+	return userID, true
+}
+
+// Handler выдает пользователю подписанную куку, если ее нет или она невалидна
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var userID string
+		cookie, err := r.Cookie(CookieName)
+		if err == nil {
+			userID, _ = ParseToken(cookie.Value)
+		}
+		ctx := r.Context()
+		if userID == "" {
+			userID = NewUserID()
+			http.SetCookie(w, &http.Cookie{
+				Name:     CookieName,
+				Value:    MakeToken(userID),
+				Path:     "/",
+				HttpOnly: true,
+			})
+			ctx = context.WithValue(ctx, newUserKey{}, true)
+		}
+		next.ServeHTTP(w, r.WithContext(WithUserID(ctx, userID)))
+	})
+}
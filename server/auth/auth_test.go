@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		want   string
+		wantOk bool
+	}{
+		{
+			name:   "Valid token",
+			token:  MakeToken("someUser"),
+			want:   "someUser",
+			wantOk: true,
+		},
+		{
+			name:   "Wrong signature",
+			token:  "someUser.0000",
+			wantOk: false,
+		},
+		{
+			name:   "Without signature",
+			token:  "someUser",
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseToken(tt.token)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var userID string
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = GetUserID(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	result := w.Result()
+	_ = result.Body.Close()
+	require.NotEmpty(t, userID)
+	require.Len(t, result.Cookies(), 1)
+
+	firstUser := userID
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.AddCookie(result.Cookies()[0])
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, request)
+	assert.Equal(t, firstUser, userID)
+	assert.Empty(t, w.Result().Cookies())
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
@@ -13,31 +15,92 @@ import (
 
 const localHost = "http://localhost"
 const localPort = "8080"
+const localGRPCPort = "3200"
 
 type OuterConfig struct {
 	Default struct {
-		AppAddr      string
-		ShortURLAddr string
-		LinkFile     string
-		DB           string
+		AppAddr        string
+		GRPCAddr       string
+		ShortURLAddr   string
+		LinkFile       string
+		DB             string
+		TrustedSubnet  string
+		AdminToken     string
+		SecretKey      string
+		CORSOrigins    string
+		RedirectType   string
+		CountryHeader  string
+		Interstitial   string
+		Blocklist      string
+		FetchMetadata  string
+		HealthCheck    string
+		BatchChunk     string
+		MaxBatchBytes  string
+		IdempotencyTTL string
+		Domains        string
 	}
 	Env struct {
-		AppAddr      string `env:"SERVER_ADDRESS"`
-		ShortURLAddr string `env:"BASE_URL"`
-		LinkFile     string `env:"FILE_STORAGE_PATH"`
-		DB           string `env:"DATABASE_DSN"`
+		AppAddr        string `env:"SERVER_ADDRESS"`
+		GRPCAddr       string `env:"GRPC_ADDRESS"`
+		ShortURLAddr   string `env:"BASE_URL"`
+		LinkFile       string `env:"FILE_STORAGE_PATH"`
+		DB             string `env:"DATABASE_DSN"`
+		TrustedSubnet  string `env:"TRUSTED_SUBNET"`
+		AdminToken     string `env:"ADMIN_TOKEN"`
+		SecretKey      string `env:"SECRET_KEY"`
+		CORSOrigins    string `env:"CORS_ALLOWED_ORIGINS"`
+		RedirectType   string `env:"REDIRECT_TYPE"`
+		CountryHeader  string `env:"COUNTRY_HEADER"`
+		Interstitial   string `env:"INTERSTITIAL"`
+		Blocklist      string `env:"BLOCKLIST"`
+		FetchMetadata  string `env:"FETCH_METADATA"`
+		HealthCheck    string `env:"HEALTH_CHECK_INTERVAL"`
+		BatchChunk     string `env:"BATCH_CHUNK_SIZE"`
+		MaxBatchBytes  string `env:"MAX_BATCH_BYTES"`
+		IdempotencyTTL string `env:"IDEMPOTENCY_TTL"`
+		Domains        string `env:"DOMAINS"`
 	}
 	Flag struct {
-		AppAddr      string
-		ShortURLAddr string
-		LinkFile     string
-		DB           string
+		AppAddr        string
+		GRPCAddr       string
+		ShortURLAddr   string
+		LinkFile       string
+		DB             string
+		TrustedSubnet  string
+		AdminToken     string
+		SecretKey      string
+		CORSOrigins    string
+		RedirectType   string
+		CountryHeader  string
+		Interstitial   string
+		Blocklist      string
+		FetchMetadata  string
+		HealthCheck    string
+		BatchChunk     string
+		MaxBatchBytes  string
+		IdempotencyTTL string
+		Domains        string
 	}
 	Final struct {
-		AppAddr      string
-		ShortURLAddr string
-		LinkFile     string
-		DB           string
+		AppAddr        string
+		GRPCAddr       string
+		ShortURLAddr   string
+		LinkFile       string
+		DB             string
+		TrustedSubnet  string
+		AdminToken     string
+		SecretKey      string
+		CORSOrigins    string
+		RedirectType   string
+		CountryHeader  string
+		Interstitial   string
+		Blocklist      string
+		FetchMetadata  string
+		HealthCheck    string
+		BatchChunk     string
+		MaxBatchBytes  string
+		IdempotencyTTL string
+		Domains        string
 	}
 }
 
@@ -51,9 +114,24 @@ var Config OuterConfig
 // и сохраняет их значения в соответствующих переменных
 func parseFlags() {
 	flag.StringVar(&Config.Flag.AppAddr, "a", "", "address and port to run server")
+	flag.StringVar(&Config.Flag.GRPCAddr, "g", "", "address and port to run grpc server")
 	flag.StringVar(&Config.Flag.ShortURLAddr, "b", "", "address and port to short link")
 	flag.StringVar(&Config.Flag.LinkFile, "f", "", "path to file with links")
 	flag.StringVar(&Config.Flag.DB, "d", "", "db connection")
+	flag.StringVar(&Config.Flag.TrustedSubnet, "t", "", "trusted subnet (CIDR) for internal api")
+	flag.StringVar(&Config.Flag.AdminToken, "admin-token", "", "token for internal api")
+	flag.StringVar(&Config.Flag.SecretKey, "k", "", "secret key to sign user cookies")
+	flag.StringVar(&Config.Flag.CORSOrigins, "cors", "", "comma separated origins allowed by CORS, * for any without cookies")
+	flag.StringVar(&Config.Flag.RedirectType, "redirect", "", "default redirect status: 301, 302, 307 or 308")
+	flag.StringVar(&Config.Flag.CountryHeader, "country-header", "", "request header with client country set by proxy")
+	flag.StringVar(&Config.Flag.Interstitial, "interstitial", "", "warning page before redirect: off, flagged or all")
+	flag.StringVar(&Config.Flag.Blocklist, "blocklist", "", "comma separated domains flagged for warning page")
+	flag.StringVar(&Config.Flag.FetchMetadata, "fetch-metadata", "", "fetch title and Open Graph tags of destinations: on or off")
+	flag.StringVar(&Config.Flag.HealthCheck, "health-check", "", "interval of destination health checks, 0 to disable")
+	flag.StringVar(&Config.Flag.BatchChunk, "batch-chunk", "", "links saved to storage at once by streaming batch")
+	flag.StringVar(&Config.Flag.MaxBatchBytes, "max-batch-bytes", "", "max size of batch request body in bytes")
+	flag.StringVar(&Config.Flag.IdempotencyTTL, "idempotency-ttl", "", "how long responses to requests with Idempotency-Key are kept")
+	flag.StringVar(&Config.Flag.Domains, "domains", "", "comma separated short domains: base url and optional =fallback url for unknown ids")
 
 	flag.Parse()
 }
@@ -75,12 +153,31 @@ func (config *OuterConfig) handleFinal() error {
 	return err
 }
 
+// randomKey возвращает случайный ключ подписи cookie
+func randomKey() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
 func setDefaults() {
 	Config.Default.AppAddr = fmt.Sprintf("%s:%s", localHost, localPort)
+	Config.Default.GRPCAddr = fmt.Sprintf("%s:%s", "localhost", localGRPCPort)
 	Config.Default.ShortURLAddr = fmt.Sprintf("%s:%s", localHost, localPort)
 	rootPath, _ := pathhandler.ProjectRoot()
 	Config.Default.LinkFile = filepath.Join(rootPath, "internal/storage/files/links.json")
 	Config.Default.DB = "user=postgres password=12345 dbname=postgres sslmode=disable"
+	Config.Default.RedirectType = "307"
+	Config.Default.CountryHeader = "X-Country-Code"
+	Config.Default.Interstitial = "flagged"
+	Config.Default.FetchMetadata = "on"
+	Config.Default.HealthCheck = "1h"
+	Config.Default.BatchChunk = "1000"
+	Config.Default.MaxBatchBytes = "67108864"
+	Config.Default.IdempotencyTTL = "24h"
 }
 
 func parseEnv() {
@@ -104,6 +201,14 @@ func HandleConfig() (OuterConfig, error) {
 		Config.Final.AppAddr = Config.Default.AppAddr
 	}
 
+	if Config.Env.GRPCAddr != "" {
+		Config.Final.GRPCAddr = Config.Env.GRPCAddr
+	} else if Config.Flag.GRPCAddr != "" {
+		Config.Final.GRPCAddr = Config.Flag.GRPCAddr
+	} else {
+		Config.Final.GRPCAddr = Config.Default.GRPCAddr
+	}
+
 	if Config.Env.ShortURLAddr != "" {
 		Config.Final.ShortURLAddr = Config.Env.ShortURLAddr
 	} else if Config.Flag.ShortURLAddr != "" {
@@ -128,6 +233,125 @@ func HandleConfig() (OuterConfig, error) {
 		Config.Final.DB = Config.Default.DB
 	}
 
+	if Config.Env.TrustedSubnet != "" {
+		Config.Final.TrustedSubnet = Config.Env.TrustedSubnet
+	} else if Config.Flag.TrustedSubnet != "" {
+		Config.Final.TrustedSubnet = Config.Flag.TrustedSubnet
+	} else {
+		Config.Final.TrustedSubnet = Config.Default.TrustedSubnet
+	}
+
+	if Config.Env.AdminToken != "" {
+		Config.Final.AdminToken = Config.Env.AdminToken
+	} else if Config.Flag.AdminToken != "" {
+		Config.Final.AdminToken = Config.Flag.AdminToken
+	} else {
+		Config.Final.AdminToken = Config.Default.AdminToken
+	}
+
+	if Config.Env.SecretKey != "" {
+		Config.Final.SecretKey = Config.Env.SecretKey
+	} else if Config.Flag.SecretKey != "" {
+		Config.Final.SecretKey = Config.Flag.SecretKey
+	} else {
+		// Общий ключ по умолчанию позволил бы подделать cookie любого пользователя, поэтому без
+		// заданного ключа cookie подписываются случайным, и после перезапуска пользователи получают новые ид
+		key, err := randomKey()
+		if err != nil {
+			return Config, err
+		}
+		Config.Final.SecretKey = key
+		logger.PrintLog(logger.WARN, "Secret key is not set, user cookies are signed with a random key until restart")
+	}
+
+	if Config.Env.CORSOrigins != "" {
+		Config.Final.CORSOrigins = Config.Env.CORSOrigins
+	} else if Config.Flag.CORSOrigins != "" {
+		Config.Final.CORSOrigins = Config.Flag.CORSOrigins
+	} else {
+		Config.Final.CORSOrigins = Config.Default.CORSOrigins
+	}
+
+	if Config.Env.RedirectType != "" {
+		Config.Final.RedirectType = Config.Env.RedirectType
+	} else if Config.Flag.RedirectType != "" {
+		Config.Final.RedirectType = Config.Flag.RedirectType
+	} else {
+		Config.Final.RedirectType = Config.Default.RedirectType
+	}
+
+	if Config.Env.CountryHeader != "" {
+		Config.Final.CountryHeader = Config.Env.CountryHeader
+	} else if Config.Flag.CountryHeader != "" {
+		Config.Final.CountryHeader = Config.Flag.CountryHeader
+	} else {
+		Config.Final.CountryHeader = Config.Default.CountryHeader
+	}
+
+	if Config.Env.Interstitial != "" {
+		Config.Final.Interstitial = Config.Env.Interstitial
+	} else if Config.Flag.Interstitial != "" {
+		Config.Final.Interstitial = Config.Flag.Interstitial
+	} else {
+		Config.Final.Interstitial = Config.Default.Interstitial
+	}
+
+	if Config.Env.Blocklist != "" {
+		Config.Final.Blocklist = Config.Env.Blocklist
+	} else if Config.Flag.Blocklist != "" {
+		Config.Final.Blocklist = Config.Flag.Blocklist
+	} else {
+		Config.Final.Blocklist = Config.Default.Blocklist
+	}
+
+	if Config.Env.FetchMetadata != "" {
+		Config.Final.FetchMetadata = Config.Env.FetchMetadata
+	} else if Config.Flag.FetchMetadata != "" {
+		Config.Final.FetchMetadata = Config.Flag.FetchMetadata
+	} else {
+		Config.Final.FetchMetadata = Config.Default.FetchMetadata
+	}
+
+	if Config.Env.HealthCheck != "" {
+		Config.Final.HealthCheck = Config.Env.HealthCheck
+	} else if Config.Flag.HealthCheck != "" {
+		Config.Final.HealthCheck = Config.Flag.HealthCheck
+	} else {
+		Config.Final.HealthCheck = Config.Default.HealthCheck
+	}
+
+	if Config.Env.BatchChunk != "" {
+		Config.Final.BatchChunk = Config.Env.BatchChunk
+	} else if Config.Flag.BatchChunk != "" {
+		Config.Final.BatchChunk = Config.Flag.BatchChunk
+	} else {
+		Config.Final.BatchChunk = Config.Default.BatchChunk
+	}
+
+	if Config.Env.MaxBatchBytes != "" {
+		Config.Final.MaxBatchBytes = Config.Env.MaxBatchBytes
+	} else if Config.Flag.MaxBatchBytes != "" {
+		Config.Final.MaxBatchBytes = Config.Flag.MaxBatchBytes
+	} else {
+		Config.Final.MaxBatchBytes = Config.Default.MaxBatchBytes
+	}
+
+	if Config.Env.IdempotencyTTL != "" {
+		Config.Final.IdempotencyTTL = Config.Env.IdempotencyTTL
+	} else if Config.Flag.IdempotencyTTL != "" {
+		Config.Final.IdempotencyTTL = Config.Flag.IdempotencyTTL
+	} else {
+		Config.Final.IdempotencyTTL = Config.Default.IdempotencyTTL
+	}
+
+	if Config.Env.Domains != "" {
+		Config.Final.Domains = Config.Env.Domains
+	} else if Config.Flag.Domains != "" {
+		Config.Final.Domains = Config.Flag.Domains
+	} else {
+		Config.Final.Domains = Config.Default.Domains
+	}
+
 	err := Config.handleFinal()
 	return Config, err
 }
@@ -0,0 +1,149 @@
+package domains
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/shorter"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Separator отделяет домен от ид в ключе ссылки. В ид и алиасах его не бывает,
+// поэтому ключи ссылок разных доменов не пересекаются
+const Separator = "~"
+
+// Domain короткий домен. Name - хост, по которому домен выбирается из заголовка Host,
+// у домена по умолчанию пустой. Fallback - куда отправлять по неизвестным ид, пустой - 404
+type Domain struct {
+	Name     string
+	BaseURL  string
+	Fallback string
+}
+
+// Parse разбирает список доменов вида "https://go.example=https://example.com/404,s.example".
+// Базовый url без схемы получает https
+func Parse(value string) ([]Domain, error) {
+	var result []Domain
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		base, fallback, _ := strings.Cut(item, "=")
+		base, fallback = strings.TrimRight(strings.TrimSpace(base), "/"), strings.TrimSpace(fallback)
+		if !strings.Contains(base, "://") {
+			base = "https://" + base
+		}
+		baseURL, err := url.Parse(base)
+		if err != nil || baseURL.Host == "" || baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+			return nil, model.NewError(model.CodeInvalid, "invalid domain "+item, err)
+		}
+		if fallback != "" {
+			fallbackURL, err := url.Parse(fallback)
+			if err != nil || fallbackURL.Host == "" || fallbackURL.Scheme != "http" && fallbackURL.Scheme != "https" {
+				return nil, model.NewError(model.CodeInvalid, "fallback of domain "+item+" must be an absolute http(s) url", err)
+			}
+		}
+		host := strings.ToLower(baseURL.Host)
+		if seen[host] {
+			return nil, model.NewError(model.CodeInvalid, "domain "+host+" is repeated", nil)
+		}
+		seen[host] = true
+		result = append(result, Domain{Name: host, BaseURL: base, Fallback: fallback})
+	}
+	return result, nil
+}
+
+// List возвращает домен по умолчанию с адресом BASE_URL и домены из DOMAINS. Запись DOMAINS
+// с хостом BASE_URL задает fallback домена по умолчанию. С ошибкой в DOMAINS остается только
+// домен по умолчанию, при старте она проверяется через Parse
+func List() []Domain {
+	base := confModule.Config.Final.ShortURLAddr
+	defaultHost := ""
+	if baseURL, err := url.Parse(base); err == nil {
+		defaultHost = strings.ToLower(baseURL.Host)
+	}
+	result := []Domain{{BaseURL: base}}
+	parsed, _ := Parse(confModule.Config.Final.Domains)
+	for _, v := range parsed {
+		if v.Name == defaultHost {
+			result[0].Fallback = v.Fallback
+			continue
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+// Find возвращает домен по имени. Пустое имя и хост BASE_URL - домен по умолчанию
+func Find(name string) (Domain, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	list := List()
+	if name == "" || name == defaultName(list[0]) {
+		return list[0], nil
+	}
+	for _, v := range list[1:] {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+	return Domain{}, model.NewError(model.CodeInvalid, "unknown domain "+name, nil)
+}
+
+// ByHost выбирает домен по заголовку Host. Хост сравнивается с портом, а если так домен
+// не нашелся, то без него. Неизвестный хост обслуживает домен по умолчанию
+func ByHost(host string) Domain {
+	host = strings.ToLower(host)
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	list := List()
+	for _, name := range []string{host, hostname} {
+		for _, v := range list[1:] {
+			if v.Name == name {
+				return v
+			}
+		}
+	}
+	return list[0]
+}
+
+func defaultName(domain Domain) string {
+	baseURL, err := url.Parse(domain.BaseURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(baseURL.Host)
+}
+
+// Key ключ ссылки в хранилище. У домена по умолчанию совпадает с ид,
+// у остальных доменов перед ид стоит домен
+func Key(domain, id string) string {
+	if domain == "" {
+		return id
+	}
+	return domain + Separator + id
+}
+
+// Split разбирает ключ ссылки на домен и ид
+func Split(key string) (domain, id string) {
+	i := strings.LastIndex(key, Separator)
+	if i < 0 {
+		return "", key
+	}
+	return key[:i], key[i+len(Separator):]
+}
+
+// ShortURL короткий url ссылки с ключом key. Домен, которого уже нет в DOMAINS,
+// считается доступным по https
+func ShortURL(key string) string {
+	name, id := Split(key)
+	domain, err := Find(name)
+	if err != nil {
+		return shorter.GetShortURL("https://"+name, id)
+	}
+	return shorter.GetShortURL(domain.BaseURL, id)
+}
@@ -0,0 +1,72 @@
+package domains
+
+import (
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []Domain
+		wantErr bool
+	}{
+		{name: "Empty", value: " "},
+		{
+			name:  "Scheme and fallback",
+			value: "Go.Example=https://example.com/404?from=go, http://s.example:8080/",
+			want: []Domain{
+				{Name: "go.example", BaseURL: "https://Go.Example", Fallback: "https://example.com/404?from=go"},
+				{Name: "s.example:8080", BaseURL: "http://s.example:8080"},
+			},
+		},
+		{name: "Relative fallback", value: "go.example=/404", wantErr: true},
+		{name: "Bad scheme", value: "ftp://go.example", wantErr: true},
+		{name: "Repeated", value: "go.example,https://GO.example", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestByHost(t *testing.T) {
+	confModule.Config.Final.ShortURLAddr = "http://localhost:8080"
+	confModule.Config.Final.Domains = "go.example=https://example.com/404,localhost:8080=https://example.com/home"
+	defer func() { confModule.Config.Final.ShortURLAddr, confModule.Config.Final.Domains = "", "" }()
+
+	tests := []struct {
+		name     string
+		host     string
+		want     string
+		fallback string
+	}{
+		{name: "Domain", host: "go.example", want: "go.example", fallback: "https://example.com/404"},
+		{name: "Domain with port", host: "GO.example:443", want: "go.example", fallback: "https://example.com/404"},
+		{name: "Default domain", host: "localhost:8080", fallback: "https://example.com/home"},
+		{name: "Unknown host", host: "other.example", fallback: "https://example.com/home"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domain := ByHost(tt.host)
+			assert.Equal(t, tt.want, domain.Name)
+			assert.Equal(t, tt.fallback, domain.Fallback)
+		})
+	}
+
+	assert.Equal(t, "abc", Key("", "abc"))
+	assert.Equal(t, "https://go.example/abc", ShortURL(Key("go.example", "abc")))
+	assert.Equal(t, "http://localhost:8080/abc", ShortURL("abc"))
+	assert.Equal(t, "https://gone.example/abc", ShortURL("gone.example~abc"))
+	_, err := Find("unknown.example")
+	assert.Error(t, err)
+}
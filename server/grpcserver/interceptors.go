@@ -0,0 +1,41 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// AuthInterceptor берет пользователя из метаданных user_id, при отсутствии выдает нового
+func AuthInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var userID string
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok {
+		values := md.Get(auth.CookieName)
+		if len(values) > 0 {
+			userID, _ = auth.ParseToken(values[0])
+		}
+	}
+	if userID == "" {
+		userID = auth.NewUserID()
+		err := grpc.SetHeader(ctx, metadata.Pairs(auth.CookieName, auth.MakeToken(userID)))
+		if err != nil {
+			logger.PrintLog(logger.WARN, "Can't set user header: "+err.Error())
+		}
+	}
+	return handler(auth.WithUserID(ctx, userID), req)
+}
+
+// LogInterceptor пишет в лог метод, длительность и код ответа
+func LogInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logger.PrintLog(logger.INFO, fmt.Sprintf("gRPC %s, duration: %s, code: %s",
+		info.FullMethod, time.Since(start), status.Code(err)))
+	return resp, err
+}
@@ -0,0 +1,229 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
+	pb "github.com/MaximMNsk/go-url-shortener/server/grpcserver/proto"
+	"github.com/MaximMNsk/go-url-shortener/server/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+type ShortenerServer struct {
+	pb.UnimplementedShortenerServer
+	serv *server.Server
+}
+
+// NewGRPCServer собирает gRPC сервер поверх того же хранилища, что и HTTP
+func NewGRPCServer(s *server.Server) *grpc.Server {
+	grpcServ := grpc.NewServer(grpc.ChainUnaryInterceptor(LogInterceptor, AuthInterceptor))
+	pb.RegisterShortenerServer(grpcServ, &ShortenerServer{serv: s})
+	reflection.Register(grpcServ)
+	return grpcServ
+}
+
+// statusError сопоставляет код ошибки хранилища и код gRPC
+func statusError(err error) error {
+	code := codes.Internal
+	switch model.CodeOf(err) {
+	case model.CodeInvalid:
+		code = codes.InvalidArgument
+	case model.CodeForbidden:
+		code = codes.PermissionDenied
+	case model.CodeNotFound, model.CodeGone:
+		code = codes.NotFound
+	case model.CodeConflict:
+		code = codes.AlreadyExists
+	case model.CodeTooLarge:
+		code = codes.ResourceExhausted
+	case model.CodeUnprocessable:
+		code = codes.FailedPrecondition
+	case model.CodeUnavailable:
+		code = codes.Unavailable
+	}
+	if code == codes.Internal {
+		return status.Error(code, "internal error")
+	}
+	return status.Error(code, err.Error())
+}
+
+func (g *ShortenerServer) Shorten(ctx context.Context, in *pb.ShortenRequest) (*pb.ShortenResponse, error) {
+	if in.GetUrl() == "" {
+		return nil, status.Error(codes.InvalidArgument, "url is empty")
+	}
+
+	shortLink, err := g.serv.Shorten(ctx, in.GetUrl(), model.LinkOptions{
+		RedirectType: int(in.GetRedirectType()),
+		Passthrough:  in.GetPassthrough(),
+		PassPath:     in.GetPassPath(),
+		Template:     in.GetTemplate(),
+		Rules:        toRules(in.GetRules()),
+		Variants:     toVariants(in.GetVariants()),
+		Sticky:       in.GetSticky(),
+		Password:     in.GetPassword(),
+		MaxClicks:    int(in.GetMaxClicks()),
+		Interstitial: in.GetInterstitial(),
+		Tags:         in.GetTags(),
+		Folder:       in.GetFolder(),
+		Domain:       in.GetDomain(),
+		Workspace:    in.GetWorkspace(),
+	})
+	if server.IsConflict(err) {
+		return &pb.ShortenResponse{Result: shortLink, AlreadyExists: true}, nil
+	}
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can not set link data: "+err.Error())
+		return nil, statusError(err)
+	}
+	return &pb.ShortenResponse{Result: shortLink}, nil
+}
+
+func (g *ShortenerServer) BatchShorten(ctx context.Context, in *pb.BatchShortenRequest) (*pb.BatchShortenResponse, error) {
+	var items []api.BatchRequestItem
+	for _, v := range in.GetItems() {
+		options := model.LinkOptions{
+			RedirectType: int(v.GetRedirectType()),
+			Passthrough:  v.GetPassthrough(),
+			PassPath:     v.GetPassPath(),
+			Template:     v.GetTemplate(),
+			Rules:        toRules(v.GetRules()),
+			Variants:     toVariants(v.GetVariants()),
+			Sticky:       v.GetSticky(),
+			Password:     v.GetPassword(),
+			MaxClicks:    int(v.GetMaxClicks()),
+			Interstitial: v.GetInterstitial(),
+			Tags:         v.GetTags(),
+			Folder:       v.GetFolder(),
+			Domain:       v.GetDomain(),
+			Workspace:    v.GetWorkspace(),
+		}
+		items = append(items, api.BatchRequestItem{
+			CorrelationID: v.GetCorrelationId(),
+			OriginalURL:   v.GetOriginalUrl(),
+			LinkOptions:   options,
+		})
+	}
+	batch, err := json.Marshal(items)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	resData, err := g.serv.BatchShorten(ctx, string(batch), in.GetAtomic())
+	isConflict := server.IsConflict(err)
+	if err != nil && !isConflict {
+		logger.PrintLog(logger.ERROR, "Can not set batch data: "+err.Error())
+		return nil, statusError(err)
+	}
+
+	var saved []api.BatchResponseItem
+	err = json.Unmarshal(resData, &saved)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &pb.BatchShortenResponse{AlreadyExists: isConflict}
+	for _, v := range saved {
+		resp.Items = append(resp.Items, &pb.BatchResult{CorrelationId: v.CorrelationID, ShortUrl: v.ShortURL, Status: v.Status, Error: v.Error})
+	}
+	return resp, nil
+}
+
+// Resolve отдает адрес ссылки на домене из запроса и, как переход по ней, засчитывает
+// клик и отправляет вебхуки. Ссылки с паролем открываются только через форму в браузере
+func (g *ShortenerServer) Resolve(ctx context.Context, in *pb.ResolveRequest) (*pb.ResolveResponse, error) {
+	domain, err := domains.Find(in.GetDomain())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	link, err := g.serv.ResolveVisit(ctx, domain, in.GetId())
+	if err == nil && link.OriginalURL == "" {
+		err = model.ErrNotFound
+	}
+	if err != nil {
+		logger.PrintLog(logger.WARN, "Can not get link: "+err.Error())
+		return nil, statusError(err)
+	}
+	if link.PasswordHash != "" {
+		return nil, status.Error(codes.PermissionDenied, "link is protected by password")
+	}
+	link, err = g.serv.ConsumeVisit(link)
+	if err != nil {
+		logger.PrintLog(logger.WARN, "Consume exception: "+err.Error())
+		return nil, statusError(err)
+	}
+	g.serv.EmitVisit(link, link.OriginalURL)
+	return &pb.ResolveResponse{OriginalUrl: link.OriginalURL}, nil
+}
+
+func (g *ShortenerServer) ListUserURLs(ctx context.Context, in *pb.ListUserURLsRequest) (*pb.ListUserURLsResponse, error) {
+	page, err := g.serv.SearchUserURLs(ctx, model.LinkQuery{
+		Workspace: in.GetWorkspace(),
+		Tag:       in.GetTag(),
+		Folder:    in.GetFolder(),
+		Q:         in.GetQ(),
+		Sort:      in.GetSort(),
+		Cursor:    in.GetCursor(),
+		Limit:     int(in.GetLimit()),
+	})
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can not get user links: "+err.Error())
+		return nil, statusError(err)
+	}
+
+	resp := &pb.ListUserURLsResponse{NextCursor: page.NextCursor}
+	for _, v := range page.Links {
+		item := &pb.UserURL{ShortUrl: v.ShortURL, OriginalUrl: v.OriginalURL, Tags: v.Tags, Folder: v.Folder}
+		if v.Metadata != nil {
+			item.Title, item.Description, item.Image = v.Metadata.Title, v.Metadata.Description, v.Metadata.Image
+		}
+		resp.Urls = append(resp.Urls, item)
+	}
+	return resp, nil
+}
+
+func (g *ShortenerServer) DeleteUserURLs(ctx context.Context, in *pb.DeleteUserURLsRequest) (*pb.DeleteUserURLsResponse, error) {
+	err := g.serv.DeleteUserURLs(ctx, in.GetIds())
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can not delete user links: "+err.Error())
+		return nil, statusError(err)
+	}
+	return &pb.DeleteUserURLsResponse{}, nil
+}
+
+func (g *ShortenerServer) Ping(_ context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	err := server.Ping()
+	if err != nil {
+		logger.PrintLog(logger.ERROR, err.Error())
+		return nil, status.Error(codes.Unavailable, "database is unavailable")
+	}
+	return &pb.PingResponse{}, nil
+}
+
+func toRules(rules []*pb.Rule) []model.Rule {
+	var result []model.Rule
+	for _, v := range rules {
+		result = append(result, model.Rule{
+			Device:   v.GetDevice(),
+			Language: v.GetLanguage(),
+			Country:  v.GetCountry(),
+			From:     v.GetFrom(),
+			To:       v.GetTo(),
+			Target:   v.GetTarget(),
+		})
+	}
+	return result
+}
+
+func toVariants(variants []*pb.Variant) []model.Variant {
+	var result []model.Variant
+	for _, v := range variants {
+		result = append(result, model.Variant{Name: v.GetName(), Target: v.GetTarget(), Weight: int(v.GetWeight())})
+	}
+	return result
+}
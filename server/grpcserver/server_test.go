@@ -0,0 +1,140 @@
+package grpcserver
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	pb "github.com/MaximMNsk/go-url-shortener/server/grpcserver/proto"
+	"github.com/MaximMNsk/go-url-shortener/server/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newClient(t *testing.T) pb.ShortenerClient {
+	confModule.Config.Final.ShortURLAddr = "http://localhost:8080"
+	serv := server.NewServ(confModule.Config, &memory.MemStorage{})
+	return newServerClient(t, &serv)
+}
+
+func newServerClient(t *testing.T, serv *server.Server) pb.ShortenerClient {
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServ := NewGRPCServer(serv)
+	go func() {
+		_ = grpcServ.Serve(listener)
+	}()
+	t.Cleanup(grpcServ.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return pb.NewShortenerClient(conn)
+}
+
+func TestShortenerServer(t *testing.T) {
+	client := newClient(t)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), auth.CookieName, auth.MakeToken("grpcUser"))
+
+	shortened, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://ya.ru"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/74704cb5", shortened.GetResult())
+
+	resolved, err := client.Resolve(ctx, &pb.ResolveRequest{Id: "74704cb5"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru", resolved.GetOriginalUrl())
+
+	protected, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://ya.ru/secret", Password: "secret"})
+	require.NoError(t, err)
+	_, err = client.Resolve(ctx, &pb.ResolveRequest{Id: protected.GetResult()[strings.LastIndex(protected.GetResult(), "/")+1:]})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Resolve расходует переходы так же, как редирект
+	limited, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://ya.ru/once", MaxClicks: 1})
+	require.NoError(t, err)
+	limitedID := limited.GetResult()[strings.LastIndex(limited.GetResult(), "/")+1:]
+	_, err = client.Resolve(ctx, &pb.ResolveRequest{Id: limitedID})
+	require.NoError(t, err)
+	_, err = client.Resolve(ctx, &pb.ResolveRequest{Id: limitedID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	batch, err := client.BatchShorten(ctx, &pb.BatchShortenRequest{Items: []*pb.BatchItem{
+		{CorrelationId: "first", OriginalUrl: "https://first.ru"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, batch.GetItems(), 1)
+	assert.Equal(t, "http://localhost:8080/first", batch.GetItems()[0].GetShortUrl())
+
+	list, err := client.ListUserURLs(ctx, &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, list.GetUrls(), 4)
+
+	_, err = client.DeleteUserURLs(ctx, &pb.DeleteUserURLsRequest{Ids: []string{"first"}})
+	require.NoError(t, err)
+
+	_, err = client.Resolve(ctx, &pb.ResolveRequest{Id: "first"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	client := newClient(t)
+
+	var header metadata.MD
+	_, err := client.ListUserURLs(context.Background(), &pb.ListUserURLsRequest{}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Len(t, header.Get(auth.CookieName), 1)
+
+	_, ok := auth.ParseToken(header.Get(auth.CookieName)[0])
+	assert.True(t, ok)
+}
+
+func TestResolveDomainAndWebhooks(t *testing.T) {
+	confModule.Config.Final.ShortURLAddr = "http://localhost:8080"
+	confModule.Config.Final.Domains = "go.example"
+	defer func() { confModule.Config.Final.Domains = "" }()
+
+	storage := &memory.MemStorage{}
+	require.NoError(t, storage.SetWebhook(model.Webhook{Name: "all", URL: "http://localhost/hook"}))
+	serv := server.NewServ(confModule.Config, storage)
+	var err error
+	serv.Webhooks, err = server.NewDispatcher(storage, http.DefaultClient)
+	require.NoError(t, err)
+	client := newServerClient(t, &serv)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), auth.CookieName, auth.MakeToken("grpcUser"))
+
+	shortened, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://ya.ru/domain", Domain: "go.example", MaxClicks: 1})
+	require.NoError(t, err)
+	id := shortened.GetResult()[strings.LastIndex(shortened.GetResult(), "/")+1:]
+
+	// Ид ищется на домене из запроса, как редирект на хост этого домена
+	_, err = client.Resolve(ctx, &pb.ResolveRequest{Id: id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.Resolve(ctx, &pb.ResolveRequest{Id: id, Domain: "unknown.example"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	resolved, err := client.Resolve(ctx, &pb.ResolveRequest{Id: id, Domain: "go.example"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru/domain", resolved.GetOriginalUrl())
+
+	deliveries, err := storage.Deliveries("")
+	require.NoError(t, err)
+	var events []string
+	for _, v := range deliveries {
+		events = append(events, v.Event)
+	}
+	assert.Equal(t, []string{model.EventLinkCreated, model.EventLinkClicked, model.EventLinkExpired}, events)
+}
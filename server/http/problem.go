@@ -0,0 +1,89 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"net/http"
+	"strconv"
+)
+
+/**
+ * Ошибки в формате RFC 7807
+ */
+
+const problemTypePrefix = "urn:shortener:problem:"
+
+// Problem тело ответа application/problem+json
+type Problem struct {
+	Type   string          `json:"type"`
+	Title  string          `json:"title"`
+	Status int             `json:"status"`
+	Detail string          `json:"detail,omitempty"`
+	Code   model.ErrorCode `json:"code"`
+}
+
+// StatusOf сопоставляет код ошибки и HTTP статус
+func StatusOf(code model.ErrorCode) int {
+	switch code {
+	case model.CodeInvalid:
+		return http.StatusBadRequest
+	case model.CodeForbidden:
+		return http.StatusForbidden
+	case model.CodeNotFound:
+		return http.StatusNotFound
+	case model.CodeConflict:
+		return http.StatusConflict
+	case model.CodeGone:
+		return http.StatusGone
+	case model.CodeTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case model.CodeUnprocessable:
+		return http.StatusUnprocessableEntity
+	case model.CodeUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// NewProblem собирает описание ошибки, детали внутренних ошибок наружу не отдаются
+func NewProblem(err error) Problem {
+	code := model.CodeOf(err)
+	status := StatusOf(code)
+	problem := Problem{
+		Type:   problemTypePrefix + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+	}
+	if code != model.CodeInternal {
+		problem.Detail = err.Error()
+	}
+	return problem
+}
+
+// ProblemJSON отдает ошибку для JSON маршрутов
+func ProblemJSON(w http.ResponseWriter, err error) {
+	problem := NewProblem(err)
+	body, _ := json.Marshal(problem)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	_, _ = w.Write(body)
+}
+
+// ErrorText отдает ошибку для текстовых маршрутов
+func ErrorText(w http.ResponseWriter, err error) {
+	status := StatusOf(model.CodeOf(err))
+	http.Error(w, http.StatusText(status), status)
+}
+
+// ReadBodyError оборачивает ошибку чтения тела, превышение размера отдается как 413
+func ReadBodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return model.NewError(model.CodeTooLarge, "body is larger than "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes", nil)
+	}
+	return model.NewError(model.CodeInvalid, "can't read body", err)
+}
@@ -2,12 +2,19 @@ package http
 
 import (
 	"net/http"
+	"strings"
 )
 
 /**
  * Responses
  */
 
+// Значения Additional.Place: куда в ответе положить дополнительные данные
+const (
+	PlaceHeader = "header"
+	PlaceBody   = "body"
+)
+
 type Additional struct {
 	Place     string
 	OuterData string
@@ -18,6 +25,11 @@ func BadRequest(w http.ResponseWriter) {
 	http.Error(w, "400 bad request", http.StatusBadRequest)
 }
 
+func MethodNotAllowed(w http.ResponseWriter, allowed []string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+}
+
 func InternalError(w http.ResponseWriter) {
 	http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
 }
@@ -25,13 +37,28 @@ func InternalError(w http.ResponseWriter) {
 func TempRedirect(w http.ResponseWriter, addData Additional) {
 	successAnswer(w, http.StatusTemporaryRedirect, addData)
 }
+
+// Redirect отдает редирект с переданным статусом,
+// постоянные редиректы разрешено кэшировать, если Cache-Control не задан заранее
+func Redirect(w http.ResponseWriter, status int, addData Additional) {
+	if w.Header().Get("Cache-Control") != "" {
+		successAnswer(w, status, addData)
+		return
+	}
+	if status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+	successAnswer(w, status, addData)
+}
 func successAnswer(w http.ResponseWriter, status int, additionalData Additional) {
 	w.Header().Add("Content-Type", "text/plain")
-	if additionalData.Place == "header" {
+	if additionalData.Place == PlaceHeader {
 		w.Header().Add(additionalData.OuterData, additionalData.InnerData)
 	}
 	w.WriteHeader(status)
-	if additionalData.Place == "body" {
+	if additionalData.Place == PlaceBody {
 		_, _ = w.Write([]byte(additionalData.InnerData))
 	}
 }
@@ -41,6 +68,14 @@ func Ok(w http.ResponseWriter) {
 	successAnswer(w, http.StatusOK, addData)
 }
 
+func Accepted(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func NoContent(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func Created(w http.ResponseWriter, addData Additional) {
 	successAnswer(w, http.StatusCreated, addData)
 }
@@ -51,15 +86,19 @@ func Conflict(w http.ResponseWriter, addData Additional) {
 
 func successAnswerJSON(w http.ResponseWriter, status int, additionalData Additional) {
 	w.Header().Add("Content-Type", "application/json")
-	if additionalData.Place == "header" {
+	if additionalData.Place == PlaceHeader {
 		w.Header().Add(additionalData.OuterData, additionalData.InnerData)
 	}
 	w.WriteHeader(status)
-	if additionalData.Place == "body" {
+	if additionalData.Place == PlaceBody {
 		_, _ = w.Write([]byte(additionalData.InnerData))
 	}
 }
 
+func OkJSON(w http.ResponseWriter, addData Additional) {
+	successAnswerJSON(w, http.StatusOK, addData)
+}
+
 func CreatedJSON(w http.ResponseWriter, addData Additional) {
 	successAnswerJSON(w, http.StatusCreated, addData)
 }
@@ -67,3 +106,7 @@ func CreatedJSON(w http.ResponseWriter, addData Additional) {
 func ConflictJSON(w http.ResponseWriter, addData Additional) {
 	successAnswerJSON(w, http.StatusConflict, addData)
 }
+
+func BadRequestJSON(w http.ResponseWriter, addData Additional) {
+	successAnswerJSON(w, http.StatusBadRequest, addData)
+}
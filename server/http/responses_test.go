@@ -1,6 +1,9 @@
 package http
 
 import (
+	"encoding/json"
+	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"io"
@@ -157,3 +160,36 @@ func TestCreated(t *testing.T) {
 		})
 	}
 }
+
+func TestProblemJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   model.ErrorCode
+		detail bool
+	}{
+		{name: "Not found", err: model.ErrNotFound, status: http.StatusNotFound, code: model.CodeNotFound, detail: true},
+		{name: "Gone", err: model.ErrDisabled, status: http.StatusGone, code: model.CodeGone, detail: true},
+		{name: "Conflict", err: model.NewError(model.CodeConflict, "exists", errors.New("pg")), status: http.StatusConflict, code: model.CodeConflict, detail: true},
+		{name: "Unavailable", err: model.ErrUnavailable, status: http.StatusServiceUnavailable, code: model.CodeUnavailable, detail: true},
+		{name: "Untyped", err: errors.New("secret details"), status: http.StatusInternalServerError, code: model.CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ProblemJSON(w, tt.err)
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.status, result.StatusCode)
+			assert.Equal(t, "application/problem+json", result.Header.Get("Content-Type"))
+
+			var problem Problem
+			require.NoError(t, json.NewDecoder(result.Body).Decode(&problem))
+			assert.Equal(t, tt.status, problem.Status)
+			assert.Equal(t, tt.code, problem.Code)
+			assert.Equal(t, tt.detail, problem.Detail != "")
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package openapi
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//go:embed openapi.json
+var document []byte
+
+type Schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Format     string             `json:"format"`
+	Required   []string           `json:"required"`
+	Properties map[string]*Schema `json:"properties"`
+	Items      *Schema            `json:"items"`
+	Enum       []any              `json:"enum"`
+	MinLength  *int               `json:"minLength"`
+	MaxLength  *int               `json:"maxLength"`
+	MinItems   *int               `json:"minItems"`
+	MaxItems   *int               `json:"maxItems"`
+	Minimum    *float64           `json:"minimum"`
+	Maximum    *float64           `json:"maximum"`
+	ReadOnly   bool               `json:"readOnly"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Operation struct {
+	Summary     string       `json:"summary"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+type Document struct {
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+var spec, specErr = Parse(document)
+
+// Spec возвращает разобранный документ, встроенный в бинарник
+func Spec() (*Document, error) {
+	return spec, specErr
+}
+
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Handler отдает документ как есть
+func Handler(res http.ResponseWriter, _ *http.Request) {
+	httpResp.OkJSON(res, httpResp.Additional{
+		Place:     httpResp.PlaceBody,
+		InnerData: string(document),
+	})
+}
+
+// FindOperation ищет операцию по методу и пути запроса,
+// литеральные сегменты пути приоритетнее параметров
+func (d *Document) FindOperation(method, path string) (*Operation, bool) {
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	var found *Operation
+	bestScore := -1
+	for pattern, operations := range d.Paths {
+		operation, ok := operations[strings.ToLower(method)]
+		if !ok {
+			continue
+		}
+		score, isMatched := matchPath(strings.Split(strings.TrimSuffix(pattern, "/"), "/"), segments)
+		if isMatched && score > bestScore {
+			found = operation
+			bestScore = score
+		}
+	}
+	return found, found != nil
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func matchPath(pattern, segments []string) (int, bool) {
+	if len(pattern) != len(segments) {
+		return 0, false
+	}
+	score := 0
+	for i := range pattern {
+		switch {
+		case pattern[i] == segments[i]:
+			score++
+		case isParam(pattern[i]) && segments[i] != "":
+		default:
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+func (d *Document) resolve(schema *Schema) (*Schema, error) {
+	for schema != nil && schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		resolved, ok := d.Components.Schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown schema %s", schema.Ref)
+		}
+		schema = resolved
+	}
+	return schema, nil
+}
+
+// Validate проверяет значение, полученное json.Decoder с UseNumber, по схеме
+func (d *Document) Validate(schema *Schema, value any) error {
+	return d.validate(schema, value, "body")
+}
+
+func (d *Document) validate(schema *Schema, value any, place string) error {
+	schema, err := d.resolve(schema)
+	if err != nil || schema == nil {
+		return err
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		return fmt.Errorf("%s: value is not allowed", place)
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: object expected", place)
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s.%s: field is required", place, name)
+			}
+		}
+		for name, property := range schema.Properties {
+			if fieldValue, ok := object[name]; ok {
+				if property.ReadOnly {
+					return fmt.Errorf("%s.%s: field is read only", place, name)
+				}
+				err = d.validate(property, fieldValue, place+"."+name)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: array expected", place)
+		}
+		if schema.MinItems != nil && len(array) < *schema.MinItems {
+			return fmt.Errorf("%s: at least %d items expected", place, *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(array) > *schema.MaxItems {
+			return fmt.Errorf("%s: at most %d items expected", place, *schema.MaxItems)
+		}
+		for i, item := range array {
+			err = d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", place, i))
+			if err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: string expected", place)
+		}
+		return validateString(schema, str, place)
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: number expected", place)
+		}
+		return validateNumber(schema, number, place)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: boolean expected", place)
+		}
+	}
+	return nil
+}
+
+func validateString(schema *Schema, str, place string) error {
+	if schema.MinLength != nil && len(str) < *schema.MinLength {
+		return fmt.Errorf("%s: at least %d characters expected", place, *schema.MinLength)
+	}
+	if schema.MaxLength != nil && len(str) > *schema.MaxLength {
+		return fmt.Errorf("%s: at most %d characters expected", place, *schema.MaxLength)
+	}
+	if schema.Format == "uri" {
+		parsed, err := url.ParseRequestURI(str)
+		if err != nil || parsed.Scheme == "" {
+			return fmt.Errorf("%s: uri expected", place)
+		}
+	}
+	if schema.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			return fmt.Errorf("%s: date-time expected", place)
+		}
+	}
+	return nil
+}
+
+func validateNumber(schema *Schema, number json.Number, place string) error {
+	if schema.Type == "integer" {
+		if _, err := number.Int64(); err != nil {
+			return fmt.Errorf("%s: integer expected", place)
+		}
+	}
+	value, err := number.Float64()
+	if err != nil {
+		return fmt.Errorf("%s: number expected", place)
+	}
+	if schema.Minimum != nil && value < *schema.Minimum {
+		return fmt.Errorf("%s: must be at least %v", place, *schema.Minimum)
+	}
+	if schema.Maximum != nil && value > *schema.Maximum {
+		return fmt.Errorf("%s: must be at most %v", place, *schema.Maximum)
+	}
+	return nil
+}
+
+func inEnum(enum []any, value any) bool {
+	for _, v := range enum {
+		if fmt.Sprint(v) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validator проверяет json тела запросов по документу. Тело читается не больше чем
+// на maxBytes байт, тело больше отдается как 413 до того, как попадет в память целиком
+func Validator(maxBytes func() int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if specErr != nil {
+				logger.PrintLog(logger.ERROR, "Can't parse openapi document: "+specErr.Error())
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			operation, ok := spec.FindOperation(req.Method, req.URL.Path)
+			if !ok || operation.RequestBody == nil {
+				next.ServeHTTP(res, req)
+				return
+			}
+			media, ok := operation.RequestBody.Content["application/json"]
+			if !ok || !isJSONRequest(req) {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			contentBody, err := io.ReadAll(http.MaxBytesReader(res, req.Body, maxBytes()))
+			_ = req.Body.Close()
+			if err != nil {
+				httpResp.ProblemJSON(res, httpResp.ReadBodyError(err))
+				return
+			}
+			req.Body = io.NopCloser(bytes.NewReader(contentBody))
+
+			err = spec.validateBody(media.Schema, contentBody, operation.RequestBody.Required)
+			if err != nil {
+				logger.PrintLog(logger.WARN, "Request validation: "+err.Error())
+				httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, err.Error(), nil))
+				return
+			}
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// isJSONRequest сообщает, что тело надо проверить здесь. Тела других типов, например
+// ndjson, и запросы с потоковым ответом обработчик читает по частям и проверяет сам,
+// читать их здесь целиком нельзя
+func isJSONRequest(req *http.Request) bool {
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err == nil && mediaType != "application/json" {
+			return false
+		}
+	}
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accept))
+		if mediaType == "application/x-ndjson" {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Document) validateBody(schema *Schema, contentBody []byte, isRequired bool) error {
+	if len(bytes.TrimSpace(contentBody)) == 0 {
+		if isRequired {
+			return fmt.Errorf("body is required")
+		}
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(contentBody))
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	if err != nil {
+		return fmt.Errorf("body: invalid json: %w", err)
+	}
+	return d.Validate(schema, value)
+}
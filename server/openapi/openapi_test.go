@@ -0,0 +1,194 @@
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func jsonKind(fieldType reflect.Type) string {
+	if fieldType.Kind() == reflect.Pointer {
+		fieldType = fieldType.Elem()
+	}
+	// time.Time json пишет строкой, json.RawMessage - готовым объектом
+	if fieldType == reflect.TypeOf(time.Time{}) {
+		return "string"
+	}
+	if fieldType == reflect.TypeOf(json.RawMessage{}) {
+		return "object"
+	}
+	switch fieldType.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func TestTypesMatchSpec(t *testing.T) {
+	doc, err := Spec()
+	require.NoError(t, err)
+
+	tests := []struct {
+		schema string
+		value  any
+	}{
+		{schema: "ShortenRequest", value: api.ShortenRequest{}},
+		{schema: "ShortenResponse", value: api.ShortenResponse{}},
+		{schema: "BatchRequestItem", value: api.BatchRequestItem{}},
+		{schema: "BatchResponseItem", value: api.BatchResponseItem{}},
+		{schema: "UserURL", value: api.UserURL{}},
+		{schema: "Metadata", value: model.Metadata{}},
+		{schema: "Health", value: model.Health{}},
+		{schema: "HealthReportItem", value: api.HealthReportItem{}},
+		{schema: "Webhook", value: model.Webhook{}},
+		{schema: "Delivery", value: model.Delivery{}},
+		{schema: "WebhookEvent", value: api.WebhookEvent{}},
+		{schema: "WebhookLink", value: api.WebhookLink{}},
+		{schema: "ImportItem", value: api.ImportItem{}},
+		{schema: "ImportRow", value: api.ImportRow{}},
+		{schema: "ImportResponse", value: api.ImportResponse{}},
+		{schema: "ExportItem", value: api.ExportItem{}},
+		{schema: "Stats", value: model.Stats{}},
+		{schema: "LinkInfo", value: model.LinkInfo{}},
+		{schema: "Template", value: model.Template{}},
+		{schema: "Rule", value: model.Rule{}},
+		{schema: "Variant", value: model.Variant{}},
+		{schema: "VariantsRequest", value: api.VariantsRequest{}},
+		{schema: "VariantsResponse", value: api.VariantsResponse{}},
+		{schema: "LinkPatchRequest", value: api.LinkPatchRequest{}},
+		{schema: "RollbackRequest", value: api.RollbackRequest{}},
+		{schema: "LinkVersion", value: model.LinkVersion{}},
+		{schema: "Workspace", value: model.Workspace{}},
+		{schema: "Member", value: model.Member{}},
+		{schema: "WorkspaceRequest", value: api.WorkspaceRequest{}},
+		{schema: "MemberRequest", value: api.MemberRequest{}},
+		{schema: "WorkspaceStatsResponse", value: api.WorkspaceStatsResponse{}},
+		{schema: "Problem", value: httpResp.Problem{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			schema, ok := doc.Components.Schemas[tt.schema]
+			require.True(t, ok, "schema is not described")
+
+			fields := make(map[string]string)
+			// Поля встроенных структур json разворачивает в родительский объект
+			for _, field := range reflect.VisibleFields(reflect.TypeOf(tt.value)) {
+				name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+				if field.Anonymous || name == "" || name == "-" {
+					continue
+				}
+				fields[name] = jsonKind(field.Type)
+			}
+
+			for name, property := range schema.Properties {
+				property, err = doc.resolve(property)
+				require.NoError(t, err)
+				kind, ok := fields[name]
+				if assert.True(t, ok, "field %s is not in go type", name) {
+					assert.Equal(t, property.Type, kind, "field %s", name)
+				}
+			}
+			for name := range fields {
+				assert.Contains(t, schema.Properties, name, "field %s is not in schema", name)
+			}
+			for _, name := range schema.Required {
+				assert.Contains(t, schema.Properties, name)
+			}
+		})
+	}
+}
+
+func TestFindOperation(t *testing.T) {
+	doc, err := Spec()
+	require.NoError(t, err)
+
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{method: http.MethodGet, path: "/ping", want: "Check storage connection"},
+		{method: http.MethodGet, path: "/abcdef", want: "Redirect to original url"},
+		{method: http.MethodPost, path: "/api/shorten", want: "Shorten url"},
+		{method: http.MethodGet, path: "/api/internal/links/abc", want: "Look up any link"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			operation, ok := doc.FindOperation(tt.method, tt.path)
+			require.True(t, ok)
+			assert.Equal(t, tt.want, operation.Summary)
+		})
+	}
+
+	_, ok := doc.FindOperation(http.MethodPut, "/api/shorten")
+	assert.False(t, ok)
+}
+
+func TestValidator(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		accept      string
+		body        string
+		status      int
+	}{
+		{name: "Valid shorten", path: "/api/shorten", body: `{"url":"https://ya.ru"}`, status: http.StatusOK},
+		{name: "Shorten without url", path: "/api/shorten", body: `{"link":"https://ya.ru"}`, status: http.StatusBadRequest},
+		{name: "Shorten not uri", path: "/api/shorten", body: `{"url":"ya"}`, status: http.StatusBadRequest},
+		{name: "Invalid json", path: "/api/shorten", body: `{"url":`, status: http.StatusBadRequest},
+		{name: "Empty body", path: "/api/shorten", body: ``, status: http.StatusBadRequest},
+		{name: "Valid batch", path: "/api/shorten/batch", body: `[{"correlation_id":"1","original_url":"https://ya.ru"}]`, status: http.StatusOK},
+		{name: "Batch not array", path: "/api/shorten/batch", body: `{"correlation_id":"1"}`, status: http.StatusBadRequest},
+		{name: "Batch wrong type", path: "/api/shorten/batch", body: `[{"correlation_id":1,"original_url":"https://ya.ru"}]`, status: http.StatusBadRequest},
+		{name: "Read only field", path: "/api/shorten", body: `{"url":"https://ya.ru","raw_url":"https://ya.ru"}`, status: http.StatusBadRequest},
+		{name: "Expiry not date-time", path: "/api/shorten", body: `{"url":"https://ya.ru","expires_at":"tomorrow"}`, status: http.StatusBadRequest},
+		{name: "Too many tags", path: "/api/shorten", body: `{"url":"https://ya.ru","tags":["t"` + strings.Repeat(`,"t"`, 20) + `]}`, status: http.StatusBadRequest},
+		{name: "Plain text is not validated", path: "/", body: `ya`, status: http.StatusOK},
+		{name: "Json content type", path: "/api/shorten/batch", contentType: "application/json; charset=utf-8", body: `{"correlation_id":"1"}`, status: http.StatusBadRequest},
+		{name: "Ndjson batch is not validated", path: "/api/shorten/batch", contentType: "application/x-ndjson", body: `{"correlation_id":"1"}`, status: http.StatusOK},
+		{name: "Streamed batch is not validated", path: "/api/shorten/batch", accept: "application/x-ndjson", body: `[{"correlation_id":1}]`, status: http.StatusOK},
+		{name: "Too large batch", path: "/api/shorten/batch", body: `[` + strings.Repeat(`{"correlation_id":"1","original_url":"https://ya.ru"},`, 100) + `]`, status: http.StatusRequestEntityTooLarge},
+	}
+	handler := Validator(func() int64 { return 1024 })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				request.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.accept != "" {
+				request.Header.Set("Accept", tt.accept)
+			}
+			handler.ServeHTTP(w, request)
+			result := w.Result()
+			_ = result.Body.Close()
+			assert.Equal(t, tt.status, result.StatusCode)
+			if tt.status != http.StatusOK {
+				assert.Equal(t, "application/problem+json", result.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"github.com/go-chi/chi/v5"
+	"net"
+	"net/http"
+)
+
+const adminTokenHeader = "X-Admin-Token"
+
+// isTrusted проверяет, что запрос пришел из доверенной подсети или с токеном администратора
+func isTrusted(req *http.Request) bool {
+	token := confModule.Config.Final.AdminToken
+	if token != "" && subtle.ConstantTimeCompare([]byte(req.Header.Get(adminTokenHeader)), []byte(token)) == 1 {
+		return true
+	}
+
+	subnet := confModule.Config.Final.TrustedSubnet
+	if subnet == "" {
+		return false
+	}
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't parse trusted subnet: "+err.Error())
+		return false
+	}
+	ip := net.ParseIP(req.Header.Get("X-Real-IP"))
+	return ip != nil && ipNet.Contains(ip)
+}
+
+func TrustedOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if !isTrusted(req) {
+			logger.PrintLog(logger.WARN, "Untrusted access to internal api")
+			httpResp.ProblemJSON(res, model.NewError(model.CodeForbidden, "untrusted client", nil))
+			return
+		}
+		next.ServeHTTP(res, req)
+	})
+}
+
+func (s *Server) HandleStats(res http.ResponseWriter, req *http.Request) {
+
+	stats, err := s.Storage.Stats()
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can not get stats: "+err.Error())
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+
+	writeJSON(res, stats)
+}
+
+func (s *Server) HandleAdminLink(res http.ResponseWriter, req *http.Request) {
+
+	info, err := s.Storage.Lookup(chi.URLParam(req, "id"))
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+
+	writeJSON(res, info)
+}
+
+func (s *Server) HandleAdminDisable(res http.ResponseWriter, req *http.Request) {
+
+	id := chi.URLParam(req, "id")
+	info, err := s.Storage.Lookup(id)
+	if err == nil {
+		err = s.Storage.Disable(id)
+	}
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	if !info.Disabled {
+		s.emitLink(model.EventLinkDeleted, info, "")
+	}
+
+	httpResp.NoContent(res)
+}
+
+func (s *Server) HandleAdminPurge(res http.ResponseWriter, req *http.Request) {
+
+	id := chi.URLParam(req, "id")
+	info, err := s.Storage.Lookup(id)
+	if err == nil {
+		err = s.Storage.Purge(id)
+	}
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	if !info.Disabled {
+		s.emitLink(model.EventLinkDeleted, info, "")
+	}
+
+	httpResp.NoContent(res)
+}
+
+func handleAdminError(res http.ResponseWriter, err error) {
+	if model.CodeOf(err) != model.CodeNotFound && model.CodeOf(err) != model.CodeForbidden {
+		logger.PrintLog(logger.ERROR, "Internal api error: "+err.Error())
+	}
+	httpResp.ProblemJSON(res, err)
+}
+
+func writeJSON(res http.ResponseWriter, data any) {
+	JSONResp, err := json.Marshal(data)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	additional := httpResp.Additional{
+		Place:     httpResp.PlaceBody,
+		InnerData: string(JSONResp),
+	}
+	httpResp.OkJSON(res, additional)
+}
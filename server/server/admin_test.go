@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTrustedOnly(t *testing.T) {
+	confModule.Config.Final.TrustedSubnet = "192.168.1.0/24"
+	confModule.Config.Final.AdminToken = "secret"
+
+	tests := []struct {
+		name    string
+		realIP  string
+		token   string
+		wantErr bool
+	}{
+		{name: "Trusted subnet", realIP: "192.168.1.10"},
+		{name: "Admin token", realIP: "10.0.0.1", token: "secret"},
+		{name: "Untrusted", realIP: "10.0.0.1", wantErr: true},
+		{name: "Wrong token", token: "wrong", wantErr: true},
+	}
+	handler := TrustedOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+			request.Header.Set("X-Real-IP", tt.realIP)
+			if tt.token != "" {
+				request.Header.Set(adminTokenHeader, tt.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, request)
+			result := w.Result()
+			_ = result.Body.Close()
+			if tt.wantErr {
+				assert.Equal(t, http.StatusForbidden, result.StatusCode)
+			} else {
+				assert.Equal(t, http.StatusOK, result.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHandleStats(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Post(`/`, serve.HandlePOST)
+	router.Get(`/stats`, serve.HandleStats)
+	router.Post(`/links/{id}/disable`, serve.HandleAdminDisable)
+	router.Get(`/{query}`, serve.HandleGET)
+
+	for _, user := range []string{"first", "second"} {
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://"+user+".ru"))
+		request = request.WithContext(auth.WithUserID(request.Context(), user))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		_ = w.Result().Body.Close()
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	result := w.Result()
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	_ = result.Body.Close()
+
+	var stats model.Stats
+	require.NoError(t, json.Unmarshal(body, &stats))
+	assert.Equal(t, model.Stats{URLs: 2, Users: 2}, stats)
+
+	storage := serve.Storage.(*memory.MemStorage)
+	id := storage.Storage.Get()[0].ID
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/links/"+id+"/disable", nil))
+	assert.Equal(t, http.StatusNoContent, w.Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+id, nil))
+	assert.NotEqual(t, http.StatusTemporaryRedirect, w.Result().StatusCode)
+}
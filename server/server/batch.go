@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultBatchChunk    = 1000
+	defaultMaxBatchBytes = 64 << 20
+)
+
+// BatchChunk число ссылок, сохраняемых в хранилище за раз при потоковой пачке
+func BatchChunk() int {
+	chunk, err := strconv.Atoi(confModule.Config.Final.BatchChunk)
+	if err != nil || chunk <= 0 {
+		return defaultBatchChunk
+	}
+	return chunk
+}
+
+// MaxBatchBytes наибольший размер тела запроса пачки
+func MaxBatchBytes() int64 {
+	size, err := strconv.ParseInt(confModule.Config.Final.MaxBatchBytes, 10, 64)
+	if err != nil || size <= 0 {
+		return defaultMaxBatchBytes
+	}
+	return size
+}
+
+// isJSONLines сообщает, что тип содержимого - json по объекту на строку
+func isJSONLines(mediaType string) bool {
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return true
+	}
+	return false
+}
+
+// isBatchStream сообщает, что пачку надо читать и отдавать потоком: пришел ndjson
+// или клиент согласен принять ndjson в ответ
+func isBatchStream(req *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if isJSONLines(mediaType) {
+		return true
+	}
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, _, _ = mime.ParseMediaType(strings.TrimSpace(accept))
+		if mediaType == "application/x-ndjson" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAtomic читает параметр atomic пачки
+func parseAtomic(req *http.Request) (bool, error) {
+	value := req.URL.Query().Get("atomic")
+	if value == "" {
+		return false, nil
+	}
+	atomic, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, model.NewError(model.CodeInvalid, "atomic must be true or false", err)
+	}
+	return atomic, nil
+}
+
+// batchReader читает элементы пачки по одному из json массива или ndjson
+type batchReader struct {
+	decoder *json.Decoder
+	array   bool
+	started bool
+}
+
+func newBatchReader(body io.Reader, array bool) *batchReader {
+	return &batchReader{decoder: json.NewDecoder(body), array: array}
+}
+
+// Next возвращает следующий элемент пачки, io.EOF - элементы кончились
+func (r *batchReader) Next() (api.BatchRequestItem, error) {
+	var item api.BatchRequestItem
+	if r.array && !r.started {
+		r.started = true
+		token, err := r.decoder.Token()
+		if err != nil {
+			return item, r.wrap(err)
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return item, model.NewError(model.CodeInvalid, "batch must be a json array", nil)
+		}
+	}
+	if r.array && !r.decoder.More() {
+		_, err := r.decoder.Token()
+		if err != nil {
+			return item, r.wrap(err)
+		}
+		return item, io.EOF
+	}
+
+	err := r.decoder.Decode(&item)
+	if err == io.EOF && !r.array {
+		return item, io.EOF
+	}
+	if err != nil {
+		return item, r.wrap(err)
+	}
+	return item, nil
+}
+
+func (r *batchReader) wrap(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return httpResp.ReadBodyError(err)
+	}
+	return model.NewError(model.CodeInvalid, "invalid batch", err)
+}
+
+// StreamBatch читает элементы через next и сохраняет их частями по chunk штук.
+// Результат каждой сохраненной части передается в emit, статусы элементов как у
+// BatchShorten. При ошибке чтения или хранилища обработка прекращается, а
+// недочитанная часть не сохраняется
+func (s *Server) StreamBatch(ctx context.Context, next func() (api.BatchRequestItem, error), chunk int,
+	emit func(saved []api.BatchResponseItem) error) error {
+
+	items := make([]api.BatchRequestItem, 0, chunk)
+	flush := func() error {
+		if len(items) == 0 {
+			return nil
+		}
+		batch, err := json.Marshal(items)
+		if err != nil {
+			return err
+		}
+		resp, err := s.BatchShorten(ctx, string(batch), false)
+		if err != nil && !IsConflict(err) {
+			return err
+		}
+		var saved []api.BatchResponseItem
+		err = json.Unmarshal(resp, &saved)
+		if err != nil {
+			return err
+		}
+		items = items[:0]
+		return emit(saved)
+	}
+
+	for {
+		item, err := next()
+		if err == io.EOF {
+			return flush()
+		}
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+		if len(items) >= chunk {
+			err = flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// streamBatch отдает результат пачки построчно в ndjson по мере сохранения частей.
+// Статус отправляется с первой частью, ошибка после этого пишется последней строкой
+// в формате RFC 7807
+func (s *Server) streamBatch(res http.ResponseWriter, req *http.Request) {
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	reader := newBatchReader(req.Body, !isJSONLines(mediaType))
+
+	// Ответ пишется, пока тело еще читается
+	_ = http.NewResponseController(res).EnableFullDuplex()
+	flusher, _ := res.(http.Flusher)
+	encoder := json.NewEncoder(res)
+	started := false
+	start := func() {
+		started = true
+		res.Header().Set("Content-Type", "application/x-ndjson")
+		res.WriteHeader(http.StatusCreated)
+	}
+
+	err := s.StreamBatch(req.Context(), reader.Next, BatchChunk(), func(saved []api.BatchResponseItem) error {
+		if !started {
+			start()
+		}
+		for _, v := range saved {
+			err := encoder.Encode(v)
+			if err != nil {
+				return err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		if !started {
+			start()
+		}
+		return
+	}
+
+	logger.PrintLog(logger.ERROR, "Can not set batch data: "+err.Error())
+	if !started {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	_ = encoder.Encode(httpResp.NewProblem(err))
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStreamBatch(t *testing.T) {
+	chunk, maxBytes := confModule.Config.Final.BatchChunk, confModule.Config.Final.MaxBatchBytes
+	confModule.Config.Final.BatchChunk = "2"
+	confModule.Config.Final.MaxBatchBytes = "1024"
+	t.Cleanup(func() {
+		confModule.Config.Final.BatchChunk, confModule.Config.Final.MaxBatchBytes = chunk, maxBytes
+	})
+
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	ts := httptest.NewServer(http.HandlerFunc(serve.HandleAPIBatch))
+	defer ts.Close()
+
+	item := func(i int) string {
+		return `{"correlation_id":"stream` + strconv.Itoa(i) + `","original_url":"https://example.com/` + strconv.Itoa(i) + `"}`
+	}
+	lines := func(from, to int) string {
+		var items []string
+		for i := from; i <= to; i++ {
+			items = append(items, item(i))
+		}
+		return strings.Join(items, "\n")
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		accept      string
+		body        string
+		status      int
+		saved       int
+		problem     string
+	}{
+		{name: "Ndjson", contentType: "application/x-ndjson", body: lines(1, 5), status: http.StatusCreated, saved: 5},
+		{name: "Array", contentType: "application/json", accept: "application/x-ndjson", body: "[" + strings.ReplaceAll(lines(6, 8), "\n", ",") + "]", status: http.StatusCreated, saved: 3},
+		{name: "Empty", contentType: "application/x-ndjson", body: "", status: http.StatusCreated},
+		{name: "Not array", contentType: "application/json", accept: "application/x-ndjson", body: `{"correlation_id":"x"}`, status: http.StatusBadRequest},
+		{name: "Broken after chunk", contentType: "application/x-ndjson", body: lines(9, 11) + "\n{", status: http.StatusCreated, saved: 2, problem: "invalid_request"},
+		{name: "Too large", contentType: "application/x-ndjson", body: lines(12, 40), status: http.StatusCreated, saved: 14, problem: "too_large"},
+		{name: "Too large without stream", contentType: "application/json", body: "[" + strings.ReplaceAll(lines(12, 40), "\n", ",") + "]", status: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", tt.contentType)
+			if tt.accept != "" {
+				request.Header.Set("Accept", tt.accept)
+			}
+			result, err := http.DefaultClient.Do(request)
+			require.NoError(t, err)
+			defer result.Body.Close()
+			require.Equal(t, tt.status, result.StatusCode)
+			if tt.status != http.StatusCreated {
+				return
+			}
+
+			saved, problem := 0, ""
+			scanner := bufio.NewScanner(result.Body)
+			for scanner.Scan() {
+				var line map[string]any
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+				if code, ok := line["code"]; ok {
+					problem = code.(string)
+					continue
+				}
+				require.Empty(t, problem, "result after error")
+				var v api.BatchResponseItem
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &v))
+				assert.True(t, strings.HasSuffix(v.ShortURL, "/"+v.CorrelationID))
+				saved++
+			}
+			assert.Equal(t, tt.saved, saved)
+			assert.Equal(t, tt.problem, problem)
+		})
+	}
+}
+
+func TestBatchStatuses(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	existing, err := serve.Shorten(context.Background(), "https://example.com/saved", model.LinkOptions{})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		query    string
+		body     string
+		status   int
+		statuses []string
+		saved    string
+	}{
+		{
+			name:     "Atomic with invalid item",
+			query:    "?atomic=true",
+			body:     `[{"correlation_id":"a1","original_url":"https://example.com/a1"},{"correlation_id":"a2","original_url":""}]`,
+			status:   http.StatusBadRequest,
+			statuses: []string{model.BatchSkipped, model.BatchInvalid},
+		},
+		{
+			name:     "Atomic with existing url",
+			query:    "?atomic=true",
+			body:     `[{"correlation_id":"a3","original_url":"https://example.com/a3"},{"correlation_id":"a4","original_url":"https://example.com/saved"}]`,
+			status:   http.StatusConflict,
+			statuses: []string{model.BatchSkipped, model.BatchExists},
+		},
+		{
+			name: "Mixed",
+			body: `[{"correlation_id":"m1","original_url":"https://example.com/m1"},` +
+				`{"correlation_id":"m2","original_url":"https://example.com/saved"},` +
+				`{"correlation_id":"m3","original_url":"https://example.com/m1"},` +
+				`{"correlation_id":"m1","original_url":"https://example.com/m4"},` +
+				`{"correlation_id":"m5","original_url":"https://example.com/m5","tags":["` + strings.Repeat("x", 51) + `"]}]`,
+			status:   http.StatusConflict,
+			statuses: []string{model.BatchCreated, model.BatchExists, model.BatchExists, model.BatchInvalid, model.BatchInvalid},
+			saved:    "https://example.com/m1",
+		},
+		{
+			name:     "Created",
+			query:    "?atomic=true",
+			body:     `[{"correlation_id":"c1","original_url":"https://example.com/c1"}]`,
+			status:   http.StatusCreated,
+			statuses: []string{model.BatchCreated},
+			saved:    "https://example.com/c1",
+		},
+		{
+			name:     "Taken id",
+			body:     `[{"correlation_id":"c1","original_url":"https://example.com/other"},{"correlation_id":"t2","original_url":"https://example.com/t2"}]`,
+			status:   http.StatusCreated,
+			statuses: []string{model.BatchInvalid, model.BatchCreated},
+			saved:    "https://example.com/c1",
+		},
+		{
+			name:     "Atomic with taken id",
+			query:    "?atomic=true",
+			body:     `[{"correlation_id":"t3","original_url":"https://example.com/t3"},{"correlation_id":"c1","original_url":"https://example.com/other"}]`,
+			status:   http.StatusBadRequest,
+			statuses: []string{model.BatchSkipped, model.BatchInvalid},
+		},
+		{name: "Bad atomic", query: "?atomic=maybe", body: `[]`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/shorten/batch"+tt.query, strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			serve.HandleAPIBatch(w, request)
+			result := w.Result()
+			defer result.Body.Close()
+			require.Equal(t, tt.status, result.StatusCode)
+			if tt.statuses == nil {
+				return
+			}
+
+			var items []api.BatchResponseItem
+			require.NoError(t, json.NewDecoder(result.Body).Decode(&items))
+			require.Len(t, items, len(tt.statuses))
+			for i, status := range tt.statuses {
+				assert.Equal(t, status, items[i].Status, items[i].CorrelationID)
+				assert.Equal(t, status == model.BatchInvalid, items[i].Error != "")
+			}
+			if tt.name == "Mixed" {
+				assert.Equal(t, existing, items[1].ShortURL)
+				assert.Equal(t, items[0].ShortURL, items[2].ShortURL)
+			}
+
+			// Ссылки, не созданные пачкой, не сохраняются
+			for i, status := range tt.statuses {
+				if status != model.BatchSkipped {
+					continue
+				}
+				_, err := serve.Storage.Lookup(items[i].CorrelationID)
+				assert.Error(t, err)
+			}
+			if tt.saved != "" {
+				info, err := serve.Storage.Lookup(items[0].CorrelationID)
+				require.NoError(t, err)
+				assert.Equal(t, tt.saved, info.OriginalURL)
+			}
+		})
+	}
+}
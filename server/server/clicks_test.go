@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMaxClicks(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Get(`/{query}`, serve.HandleGET)
+	router.Head(`/{query}`, serve.HandleGET)
+
+	_, err := serve.Shorten(context.Background(), "https://example.com/negative", model.LinkOptions{MaxClicks: -1})
+	assert.Equal(t, model.CodeInvalid, model.CodeOf(err))
+
+	shortLink, err := serve.Shorten(context.Background(), "https://example.com/limited", model.LinkOptions{MaxClicks: 3})
+	require.NoError(t, err)
+	id := shortLink[strings.LastIndex(shortLink, "/")+1:]
+	otherLink, err := serve.Shorten(context.Background(), "https://example.com/unlimited", model.LinkOptions{})
+	require.NoError(t, err)
+	otherID := otherLink[strings.LastIndex(otherLink, "/")+1:]
+
+	request := func(method, id string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/"+id, nil))
+		return w.Result().StatusCode
+	}
+	get := func(method string) int {
+		return request(method, id)
+	}
+
+	// HEAD не расходует переходы
+	assert.Equal(t, http.StatusTemporaryRedirect, get(http.MethodHead))
+
+	assert.Equal(t, http.StatusTemporaryRedirect, get(http.MethodGet))
+
+	// Оставшиеся переходы расходуются конкурентно вперемешку с переходами по другой ссылке,
+	// засчитаться должны ровно два, а переходы по другой ссылке - не уйти в эту
+	var consumed, gone, other atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			switch get(http.MethodGet) {
+			case http.StatusTemporaryRedirect:
+				consumed.Add(1)
+			case http.StatusGone:
+				gone.Add(1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if request(http.MethodGet, otherID) == http.StatusTemporaryRedirect {
+				other.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), consumed.Load())
+	assert.Equal(t, int32(8), gone.Load())
+	assert.Equal(t, int32(10), other.Load())
+	info, err := serve.Storage.Lookup(otherID)
+	require.NoError(t, err)
+	assert.Equal(t, 10, info.Clicks)
+
+	assert.Equal(t, http.StatusGone, get(http.MethodGet))
+	assert.Equal(t, http.StatusGone, get(http.MethodHead))
+	_, err = serve.Resolve(context.Background(), id)
+	assert.ErrorIs(t, err, model.ErrDisabled)
+}
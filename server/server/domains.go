@@ -0,0 +1,27 @@
+package server
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
+	"strings"
+)
+
+// normalizeDomain заменяет домен ссылки его именем, у домена по умолчанию имя пустое
+func normalizeDomain(options *model.LinkOptions) error {
+	domain, err := domains.Find(options.Domain)
+	if err != nil {
+		return err
+	}
+	options.Domain = domain.Name
+	return nil
+}
+
+// resolveHost возвращает ссылку с ид id на домене domain. Ключ с доменом вместо ид
+// не принимается, иначе через один домен открывались бы ссылки другого
+func (s *Server) resolveHost(ctx context.Context, domain domains.Domain, id string) (model.LinkInfo, error) {
+	if strings.Contains(id, domains.Separator) {
+		return model.LinkInfo{}, model.ErrNotFound
+	}
+	return s.Resolve(ctx, domains.Key(domain.Name, id))
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDomains(t *testing.T) {
+	confModule.Config.Final.ShortURLAddr = "http://localhost:8080"
+	confModule.Config.Final.Domains = "go.example=https://example.com/missing,s.example"
+	defer func() { confModule.Config.Final.ShortURLAddr, confModule.Config.Final.Domains = "", "" }()
+
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Get(`/{query}`, serve.HandleGET)
+	ctx := context.Background()
+
+	// Один адрес сокращается на каждом домене отдельно
+	defaultLink, err := serve.Shorten(ctx, "https://example.com/page", model.LinkOptions{})
+	require.NoError(t, err)
+	goLink, err := serve.Shorten(ctx, "https://example.com/page", model.LinkOptions{Domain: "GO.example"})
+	require.NoError(t, err)
+	id := defaultLink[strings.LastIndex(defaultLink, "/")+1:]
+	assert.Equal(t, "http://localhost:8080/"+id, defaultLink)
+	assert.Equal(t, "https://go.example/"+id, goLink)
+	_, err = serve.Shorten(ctx, "https://example.com/page", model.LinkOptions{Domain: "go.example"})
+	assert.True(t, IsConflict(err))
+
+	// Алиас занят только на своем домене
+	_, err = serve.ShortenAlias(ctx, "https://example.com/default", "promo", model.LinkOptions{})
+	require.NoError(t, err)
+	sLink, err := serve.ShortenAlias(ctx, "https://example.com/s", "promo", model.LinkOptions{Domain: "s.example"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://s.example/promo", sLink)
+	_, err = serve.Shorten(ctx, "https://example.com", model.LinkOptions{Domain: "unknown.example"})
+	assert.Equal(t, model.CodeInvalid, model.CodeOf(err))
+
+	resp, err := serve.BatchShorten(ctx, `[{"correlation_id":"promo","original_url":"https://example.com/go","domain":"go.example"},
+		{"correlation_id":"go.example~x","original_url":"https://example.com/x"}]`, false)
+	require.NoError(t, err)
+	var items []api.BatchResponseItem
+	require.NoError(t, json.Unmarshal(resp, &items))
+	assert.Equal(t, api.BatchResponseItem{CorrelationID: "promo", ShortURL: "https://go.example/promo", Status: model.BatchCreated}, items[0])
+	assert.Equal(t, model.BatchInvalid, items[1].Status)
+
+	tests := []struct {
+		name     string
+		host     string
+		path     string
+		status   int
+		location string
+	}{
+		{name: "Default domain", host: "localhost:8080", path: "/promo", status: http.StatusTemporaryRedirect, location: "https://example.com/default"},
+		{name: "Domain by host", host: "s.example", path: "/promo", status: http.StatusTemporaryRedirect, location: "https://example.com/s"},
+		{name: "Batch link", host: "go.example", path: "/promo", status: http.StatusTemporaryRedirect, location: "https://example.com/go"},
+		{name: "Fallback", host: "go.example", path: "/missing", status: http.StatusFound, location: "https://example.com/missing"},
+		{name: "No fallback", host: "s.example", path: "/missing", status: http.StatusNotFound},
+		{name: "Key of another domain", host: "localhost:8080", path: "/s.example~promo", status: http.StatusNotFound},
+		{name: "Unknown host", host: "other.example", path: "/promo", status: http.StatusTemporaryRedirect, location: "https://example.com/default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			request.Host = tt.host
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+		})
+	}
+
+	// Ссылки других доменов доступны по ключу с доменом
+	info, err := serve.Resolve(ctx, "s.example~promo")
+	require.NoError(t, err)
+	assert.Equal(t, "s.example", info.Domain)
+	assert.Equal(t, "https://s.example/promo", info.ShortURL)
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFlushEvery строк между отправками данных клиенту
+const exportFlushEvery = 100
+
+var exportHeader = []string{"id", "short_url", "url", "expires_at", "tags", "clicks", "created_at", "folder", "domain"}
+
+// linkWriter пишет ссылки в тело ответа в одном из форматов экспорта
+type linkWriter interface {
+	Header() error
+	Write(item api.ExportItem) error
+	Flush() error
+}
+
+type csvLinkWriter struct {
+	writer *csv.Writer
+}
+
+func (w csvLinkWriter) Header() error {
+	return w.writer.Write(exportHeader)
+}
+
+func (w csvLinkWriter) Write(item api.ExportItem) error {
+	return w.writer.Write([]string{
+		item.ID,
+		item.ShortURL,
+		item.URL,
+		formatTime(item.ExpiresAt),
+		strings.Join(item.Tags, ","),
+		strconv.Itoa(item.Clicks),
+		formatTime(item.CreatedAt),
+		item.Folder,
+		item.Domain,
+	})
+}
+
+func (w csvLinkWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type jsonlLinkWriter struct {
+	encoder *json.Encoder
+}
+
+func (w jsonlLinkWriter) Header() error {
+	return nil
+}
+
+func (w jsonlLinkWriter) Write(item api.ExportItem) error {
+	return w.encoder.Encode(item)
+}
+
+func (w jsonlLinkWriter) Flush() error {
+	return nil
+}
+
+func newLinkWriter(format string, out io.Writer) linkWriter {
+	if format == FormatJSONL {
+		return jsonlLinkWriter{encoder: json.NewEncoder(out)}
+	}
+	return csvLinkWriter{writer: csv.NewWriter(out)}
+}
+
+func formatTime(moment *time.Time) string {
+	if moment == nil {
+		return ""
+	}
+	return moment.UTC().Format(time.RFC3339)
+}
+
+// HandleExport отдает все ссылки пользователя в csv или jsonl. Ссылки читаются из
+// хранилища по одной и сразу пишутся в ответ, поэтому статус и заголовки
+// отправляются с первой строкой, а ошибка посреди выгрузки только обрывает ответ
+func (s *Server) HandleExport(res http.ResponseWriter, req *http.Request) {
+
+	format := req.URL.Query().Get("format")
+	contentType := "text/csv; charset=utf-8"
+	switch format {
+	case "", FormatCSV:
+		format = FormatCSV
+	case FormatJSONL:
+		contentType = "application/x-ndjson"
+	default:
+		httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "unsupported export format, use csv or jsonl", nil))
+		return
+	}
+
+	writer := newLinkWriter(format, res)
+	flusher, _ := res.(http.Flusher)
+	started := false
+	start := func() error {
+		started = true
+		res.Header().Set("Content-Type", contentType)
+		res.Header().Set("Content-Disposition", `attachment; filename="links.`+format+`"`)
+		res.Header().Set("Cache-Control", "no-store")
+		res.WriteHeader(http.StatusOK)
+		return writer.Header()
+	}
+
+	rows := 0
+	err := s.Storage.ScanUserLinks(auth.GetUserID(req.Context()), func(info model.LinkInfo) error {
+		if !started {
+			err := start()
+			if err != nil {
+				return err
+			}
+		}
+		// Ид выгружается без домена, чтобы экспорт можно было загрузить обратно
+		_, id := domains.Split(info.ID)
+		err := writer.Write(api.ExportItem{
+			ID:        id,
+			ShortURL:  info.ShortURL,
+			URL:       info.OriginalURL,
+			ExpiresAt: info.ExpiresAt,
+			Tags:      info.Tags,
+			Clicks:    info.Clicks,
+			CreatedAt: info.CreatedAt,
+			Folder:    info.Folder,
+			Domain:    info.Domain,
+		})
+		if err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushEvery == 0 {
+			err = writer.Flush()
+			if err == nil && flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return err
+	})
+	if err != nil && !started {
+		logger.PrintLog(logger.ERROR, "Can not export links: "+err.Error())
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Export interrupted after "+strconv.Itoa(rows)+" links: "+err.Error())
+		return
+	}
+	if !started {
+		err = start()
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can not export links: "+err.Error())
+	}
+}
@@ -4,50 +4,134 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
 	"github.com/MaximMNsk/go-url-shortener/internal/models/database"
 	"github.com/MaximMNsk/go-url-shortener/internal/models/files"
 	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
-	"github.com/MaximMNsk/go-url-shortener/internal/storage/db"
 	memoryStorage "github.com/MaximMNsk/go-url-shortener/internal/storage/memory"
-	"github.com/MaximMNsk/go-url-shortener/internal/util/hash/sha1hash"
 	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
-	"github.com/MaximMNsk/go-url-shortener/internal/util/shorter"
 	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
 	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 func (s *Server) HandleGET(res http.ResponseWriter, req *http.Request) {
 
-	// Пришел ид
-	requestID := req.URL.Path[1:]
+	// Пришел ид, возможно с подпутем
+	requestID, subPath, _ := strings.Cut(req.URL.Path[1:], "/")
+	query := req.URL.Query()
+	isPreview := strings.HasSuffix(requestID, "+") || query.Get("preview") == "1"
+	if isPreview {
+		requestID = strings.TrimSuffix(requestID, "+")
+		query.Del("preview")
+	}
 
-	s.Storage.Init(``, ``, requestID, req.Context())
-	saved, err := s.Storage.Get()
+	// Ид ищется на домене, на который пришел запрос
+	domain := domains.ByHost(req.Host)
+	saved, err := s.ResolveVisit(req.Context(), domain, requestID)
+	if err == nil && subPath != "" && !saved.PassPath {
+		err = model.ErrNotFound
+	}
+	if errors.Is(err, model.ErrNotFound) && domain.Fallback != "" {
+		logger.PrintLog(logger.INFO, "Fallback for unknown id "+requestID)
+		httpResp.Redirect(res, http.StatusFound, httpResp.Additional{
+			Place:     httpResp.PlaceHeader,
+			OuterData: "Location",
+			InnerData: domain.Fallback,
+		})
+		return
+	}
 	if err != nil {
 		logger.PrintLog(logger.WARN, "Get exception: "+err.Error())
-		httpResp.BadRequest(res)
+		httpResp.ErrorText(res, err)
+		return
+	}
+
+	if saved.PasswordHash != "" {
+		if !isUnlocked(req, saved.ID) {
+			renderUnlockForm(res, http.StatusOK, requestID, req.URL.RequestURI(), "")
+			return
+		}
+		res.Header().Set("Cache-Control", "no-store")
+	}
+
+	// Предпросмотр показывает адрес без правил и вариантов и не засчитывает переход
+	if isPreview {
+		renderPage(res, "preview.html", pageData{
+			ShortURL:    saved.ShortURL,
+			Destination: Destination(saved, subPath, query),
+			CreatedAt:   saved.CreatedAt,
+			Clicks:      saved.Clicks,
+		})
 		return
 	}
 
-	if saved != "" {
+	// Переход засчитывается атомарно, чтобы не превысить лимит, HEAD не засчитывается
+	if req.Method == http.MethodGet {
+		saved, err = s.ConsumeVisit(saved)
+		if err != nil {
+			logger.PrintLog(logger.WARN, "Consume exception: "+err.Error())
+			httpResp.ErrorText(res, err)
+			return
+		}
+	}
+	if saved.MaxClicks > 0 {
+		res.Header().Set("Cache-Control", "no-store")
+	}
+
+	if saved.OriginalURL != "" {
+		info := saved
+		saved.OriginalURL = s.redirectTarget(res, req, saved)
+		destination := Destination(saved, subPath, query)
+		if req.Method == http.MethodGet {
+			s.EmitVisit(info, destination)
+		}
+		flagged := IsBlocked(destination)
+		if needsInterstitial(saved, flagged) {
+			logger.PrintLog(logger.INFO, "Interstitial for "+saved.ID)
+			renderPage(res, "interstitial.html", pageData{
+				ShortURL:    saved.ShortURL,
+				Destination: destination,
+				Flagged:     flagged,
+			})
+			return
+		}
+
+		// Цель ссылки с правилами, вариантами или сроком зависит от посетителя и времени,
+		// такой редирект нельзя кэшировать даже с постоянным статусом
+		if !isCacheable(saved) && res.Header().Get("Cache-Control") == "" {
+			res.Header().Set("Cache-Control", "private, no-cache")
+		}
 		additional := httpResp.Additional{
-			Place:     "header",
+			Place:     httpResp.PlaceHeader,
 			OuterData: "Location",
-			InnerData: saved,
+			InnerData: destination,
 		}
-		// Если есть, отдаем 307 редирект
+		// Если есть, отдаем редирект с типом ссылки
 		logger.PrintLog(logger.INFO, "Success")
-		httpResp.TempRedirect(res, additional)
+		httpResp.Redirect(res, RedirectStatus(saved), additional)
 		return
 	}
 
-	// Если нет, отдаем BadRequest
+	// Если нет, отдаем NotFound
 	logger.PrintLog(logger.WARN, "Not success")
-	httpResp.BadRequest(res)
+	httpResp.ErrorText(res, model.ErrNotFound)
+}
+
+// HandleNotFound отдает редирект для коротких ссылок с подпутем,
+// такие пути не описать в роутере, не перекрыв /api/...
+func (s *Server) HandleNotFound(res http.ResponseWriter, req *http.Request) {
+	isRead := req.Method == http.MethodGet || req.Method == http.MethodHead
+	if isRead && strings.Count(req.URL.Path, "/") > 1 {
+		s.HandleGET(res, req)
+		return
+	}
+	httpResp.ErrorText(res, errNotFound)
 }
 
 /**
@@ -63,31 +147,22 @@ func (s *Server) HandlePOST(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// Пришел урл
-	linkID := sha1hash.Create(string(contentBody), 8)
-	shortLink := shorter.GetShortURL(confModule.Config.Final.ShortURLAddr, linkID)
+	shortLink, err := s.Shorten(req.Context(), string(contentBody), model.LinkOptions{})
 
 	additional := httpResp.Additional{
-		Place:     "body",
+		Place:     httpResp.PlaceBody,
 		InnerData: shortLink,
 	}
 
-	s.Storage.Init(string(contentBody), shortLink, linkID, req.Context())
-	err := s.Storage.Set()
-
-	var pgErr *pgconn.PgError
-	errors.As(err, &pgErr)
-
-	if pgErr != nil {
-		if pgErr.SQLState() == `23505` {
-			logger.PrintLog(logger.ERROR, "Can not set link data: "+err.Error())
-			httpResp.Conflict(res, additional)
-			return
-		}
+	if IsConflict(err) {
+		logger.PrintLog(logger.ERROR, "Can not set link data: "+err.Error())
+		httpResp.Conflict(res, additional)
+		return
 	}
 
 	if err != nil {
 		logger.PrintLog(logger.ERROR, "Can not set link data: "+err.Error())
-		httpResp.InternalError(res)
+		httpResp.ErrorText(res, err)
 		return
 	}
 
@@ -95,121 +170,96 @@ func (s *Server) HandlePOST(res http.ResponseWriter, req *http.Request) {
 	httpResp.Created(res, additional)
 }
 
-type controllers map[string]bool
-
-func (s *Server) HandleAPI(res http.ResponseWriter, req *http.Request) {
-
-	ctrl := chi.URLParam(req, "query")
-
-	availableCurls := make(controllers)
-	availableCurls["shorten"] = true
-	availableCurls["batch"] = true
-
-	if !availableCurls[ctrl] {
-		httpResp.BadRequest(res)
-		return
-	}
+func (s *Server) HandleAPIBatch(res http.ResponseWriter, req *http.Request) {
 
-	if ctrl == "shorten" {
-		HandleAPIShorten(res, req, s)
+	req.Body = http.MaxBytesReader(res, req.Body, MaxBatchBytes())
+	defer req.Body.Close()
+	atomic, err := parseAtomic(req)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
 		return
 	}
-
-	if ctrl == "batch" {
-		HandleAPIBatch(res, req, s)
+	if isBatchStream(req) {
+		if atomic {
+			httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "streaming batch can't be atomic", nil))
+			return
+		}
+		s.streamBatch(res, req)
 		return
 	}
-}
-
-func HandleAPIBatch(res http.ResponseWriter, req *http.Request, s *Server) {
 
 	contentBody, errBody := io.ReadAll(req.Body)
-	defer req.Body.Close()
 	if errBody != nil {
-		httpResp.BadRequest(res)
+		httpResp.ProblemJSON(res, httpResp.ReadBodyError(errBody))
 		return
 	}
 
-	s.Storage.Init(string(contentBody), ``, ``, req.Context())
-	resData, err := s.Storage.BatchSet()
-
-	var batchErr *pgconn.PgError
-	errors.As(err, &batchErr)
+	resData, err := s.BatchShorten(req.Context(), string(contentBody), atomic)
 
 	additional := httpResp.Additional{
-		Place:     "body",
+		Place:     httpResp.PlaceBody,
 		InnerData: string(resData),
 	}
 
-	if batchErr != nil {
-		if batchErr.SQLState() == `23505` {
-			httpResp.ConflictJSON(res, additional)
-			return
-		} else {
-			httpResp.BadRequest(res)
-			return
-		}
+	// Статус каждого элемента есть в теле. 409 - часть адресов уже сокращена,
+	// 400 - atomic пачка не сохранена из-за ошибок в элементах
+	if IsConflict(err) {
+		httpResp.ConflictJSON(res, additional)
+		return
+	}
+	if resData != nil && model.CodeOf(err) == model.CodeInvalid {
+		httpResp.BadRequestJSON(res, additional)
+		return
+	}
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can not set batch data: "+err.Error())
+		httpResp.ProblemJSON(res, err)
+		return
 	}
 
 	httpResp.CreatedJSON(res, additional)
 }
 
-type input struct {
-	URL string `json:"url"`
-}
-
-type output struct {
-	Result string `json:"result"`
-}
-
-func HandleAPIShorten(res http.ResponseWriter, req *http.Request, s *Server) {
+func (s *Server) HandleAPIShorten(res http.ResponseWriter, req *http.Request) {
 
 	contentBody, errBody := io.ReadAll(req.Body)
 	defer req.Body.Close()
 	if errBody != nil {
-		httpResp.BadRequest(res)
+		httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "can't read body", errBody))
 		return
 	}
 
 	// Пришел урл, парсим его
-	var apiData input
+	var apiData api.ShortenRequest
 	err := json.Unmarshal(contentBody, &apiData)
 	if err != nil {
-		httpResp.InternalError(res)
+		httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "invalid json", err))
 		return
 	}
-	linkID := sha1hash.Create(apiData.URL, 8)
-	shortLink := shorter.GetShortURL(confModule.Config.Final.ShortURLAddr, linkID)
+	shortLink, errSet := s.Shorten(req.Context(), apiData.URL, apiData.LinkOptions)
 
-	var resp output
+	var resp api.ShortenResponse
 	resp.Result = shortLink
 	var JSONResp []byte
 	JSONResp, err = json.Marshal(resp)
 	if err != nil {
-		httpResp.InternalError(res)
+		httpResp.ProblemJSON(res, err)
 		return
 	}
 	additional := httpResp.Additional{
-		Place:     "body",
+		Place:     httpResp.PlaceBody,
 		InnerData: string(JSONResp),
 	}
 
-	s.Storage.Init(apiData.URL, shorter.GetShortURL(confModule.Config.Final.ShortURLAddr, linkID), linkID, req.Context())
-	err = s.Storage.Set()
-
-	var pgErr *pgconn.PgError
-	errors.As(err, &pgErr)
-
-	if pgErr != nil {
-		if pgErr.SQLState() == `23505` {
-			logger.PrintLog(logger.ERROR, "Can not set link data: "+err.Error())
-			httpResp.ConflictJSON(res, additional)
-			return
-		}
+	if IsConflict(errSet) {
+		logger.PrintLog(logger.ERROR, "Can not set link data: "+errSet.Error())
+		httpResp.ConflictJSON(res, additional)
+		return
 	}
 
-	if err != nil {
-		httpResp.InternalError(res)
+	if errSet != nil {
+		logger.PrintLog(logger.ERROR, "Can not set link data: "+errSet.Error())
+		httpResp.ProblemJSON(res, errSet)
 		return
 	}
 
@@ -219,28 +269,82 @@ func HandleAPIShorten(res http.ResponseWriter, req *http.Request, s *Server) {
 
 func (s *Server) HandlePing(res http.ResponseWriter, req *http.Request) {
 
-	if db.GetDB() == nil {
-		err := db.Connect()
-		defer func() {
-			_ = db.Close()
-		}()
-		if err != nil {
-			logger.PrintLog(logger.ERROR, err.Error())
-			httpResp.InternalError(res)
-			return
-		}
+	err := Ping()
+	if err != nil {
+		logger.PrintLog(logger.ERROR, err.Error())
+		httpResp.InternalError(res)
+		return
 	}
 	httpResp.Ok(res)
 }
 
-func HandleOther(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-		if req.Method == "GET" || req.Method == "POST" {
-			next.ServeHTTP(res, req)
-		} else {
-			httpResp.BadRequest(res)
+// HandleUserURLs отдает страницу ссылок пользователя с отбором по метке, папке и словам.
+// Адрес следующей страницы передается в заголовке Link
+func (s *Server) HandleUserURLs(res http.ResponseWriter, req *http.Request) {
+
+	params := req.URL.Query()
+	query := model.LinkQuery{
+		Workspace: params.Get("workspace"),
+		Tag:       params.Get("tag"),
+		Folder:    params.Get("folder"),
+		Q:         params.Get("q"),
+		Sort:      params.Get("sort"),
+		Cursor:    params.Get("cursor"),
+	}
+	if limit := params.Get("limit"); limit != "" {
+		var err error
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit <= 0 {
+			httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "limit must be a positive number", nil))
+			return
 		}
-	})
+	}
+
+	page, err := s.SearchUserURLs(req.Context(), query)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can not get user links: "+err.Error())
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	if page.NextCursor != "" {
+		params.Set("cursor", page.NextCursor)
+		res.Header().Set("Link", "<"+req.URL.Path+"?"+params.Encode()+`>; rel="next"`)
+	}
+	if len(page.Links) == 0 {
+		httpResp.NoContent(res)
+		return
+	}
+
+	var resp []api.UserURL
+	for _, v := range page.Links {
+		resp = append(resp, api.UserURL{ShortURL: v.ShortURL, OriginalURL: v.OriginalURL, Metadata: v.Metadata, Tags: v.Tags, Folder: v.Folder})
+	}
+	writeJSON(res, resp)
+}
+
+func (s *Server) HandleDeleteUserURLs(res http.ResponseWriter, req *http.Request) {
+
+	contentBody, errBody := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if errBody != nil {
+		httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "can't read body", errBody))
+		return
+	}
+
+	var ids []string
+	err := json.Unmarshal(contentBody, &ids)
+	if err != nil {
+		httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "invalid json", err))
+		return
+	}
+
+	err = s.DeleteUserURLs(req.Context(), ids)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can not delete user links: "+err.Error())
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	httpResp.Accepted(res)
 }
 
 /**
@@ -271,8 +375,13 @@ type Server struct {
 	Storage model.Storable
 	Routers chi.Router
 	Config  confModule.OuterConfig
+	// Metadata фоновая загрузка данных страниц, nil - выключена
+	Metadata *Enricher
+	// Webhooks очередь вебхуков, nil - выключены
+	Webhooks *Dispatcher
+	attempts *attemptLimiter
 }
 
 func NewServ(c confModule.OuterConfig, s model.Storable) Server {
-	return Server{Storage: s, Config: c}
+	return Server{Storage: s, Config: c, attempts: newAttemptLimiter(maxUnlockAttempts, unlockAttemptsWindow)}
 }
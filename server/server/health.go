@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/probe"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	HealthWorkers = 8
+	// brokenAfterFailures неудачных проверок подряд, после которых ссылка считается битой
+	brokenAfterFailures = 3
+	// maxHealthBackoff ограничивает рост интервала: не больше interval * 2^maxHealthBackoff
+	maxHealthBackoff = 5
+)
+
+// HealthChecker периодически проверяет адреса назначения ссылок
+type HealthChecker struct {
+	storage  model.Storable
+	prober   *probe.Prober
+	interval time.Duration
+	workers  int
+}
+
+func NewHealthChecker(storage model.Storable, prober *probe.Prober, interval time.Duration, workers int) *HealthChecker {
+	return &HealthChecker{storage: storage, prober: prober, interval: interval, workers: workers}
+}
+
+// Run проверяет ссылки раз в interval, пока не отменен ctx
+func (h *HealthChecker) Run(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		for {
+			err := h.CheckDue(ctx, time.Now())
+			if err != nil {
+				logger.PrintLog(logger.ERROR, "Can't check links: "+err.Error())
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// CheckDue проверяет ссылки, которым подошло время проверки, не больше workers одновременно
+func (h *HealthChecker) CheckDue(ctx context.Context, now time.Time) error {
+	links, err := h.storage.ActiveLinks()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, h.workers)
+	for _, info := range links {
+		if !h.isDue(info, now) {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case slots <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(info model.LinkInfo) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			h.check(ctx, info, now)
+		}(info)
+	}
+	wg.Wait()
+	return nil
+}
+
+// isDue сообщает, что ссылку пора проверить. С каждой неудачей подряд интервал
+// удваивается, чтобы не долбить лежащий сайт
+func (h *HealthChecker) isDue(info model.LinkInfo, now time.Time) bool {
+	if info.Health == nil || info.Health.CheckedAt == nil {
+		return true
+	}
+	backoff := info.Health.Failures
+	if backoff > maxHealthBackoff {
+		backoff = maxHealthBackoff
+	}
+	return !now.Before(info.Health.CheckedAt.Add(h.interval << backoff))
+}
+
+func (h *HealthChecker) check(ctx context.Context, info model.LinkInfo, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, 2*probe.DefaultTimeout)
+	defer cancel()
+	status, err := h.prober.Check(ctx, info.OriginalURL)
+
+	health := model.Health{Status: status, CheckedAt: &now}
+	if err != nil || status >= http.StatusBadRequest {
+		health.Failures = 1
+		if info.Health != nil {
+			health.Failures += info.Health.Failures
+		}
+		health.Error = http.StatusText(status)
+		if err != nil {
+			health.Error = err.Error()
+		}
+		health.Broken = health.Failures >= brokenAfterFailures
+		if health.Broken && (info.Health == nil || !info.Health.Broken) {
+			logger.PrintLog(logger.WARN, "Link "+info.ID+" is broken: "+health.Error)
+		}
+	}
+
+	err = h.storage.SetHealth(info.ID, health)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't save health of "+info.ID+": "+err.Error())
+	}
+}
+
+// HandleHealthReport отдает результаты проверок, сначала битые ссылки.
+// С broken=1 отдаются только битые
+func (s *Server) HandleHealthReport(res http.ResponseWriter, req *http.Request) {
+
+	links, err := s.Storage.ActiveLinks()
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+
+	onlyBroken := req.URL.Query().Get("broken") == "1"
+	report := make([]api.HealthReportItem, 0, len(links))
+	for _, v := range links {
+		if onlyBroken && (v.Health == nil || !v.Health.Broken) {
+			continue
+		}
+		report = append(report, api.HealthReportItem{ID: v.ID, ShortURL: v.ShortURL, OriginalURL: v.OriginalURL, Health: v.Health})
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		a, b := report[i].Health, report[j].Health
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		if a.Broken != b.Broken {
+			return a.Broken
+		}
+		return a.Failures > b.Failures
+	})
+
+	if len(report) == 0 {
+		httpResp.NoContent(res)
+		return
+	}
+	writeJSON(res, report)
+}
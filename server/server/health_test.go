@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/probe"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthChecker(t *testing.T) {
+	var goneHits atomic.Int32
+	var restored atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			goneHits.Add(1)
+		}
+		if !restored.Load() {
+			http.NotFound(w, r)
+		}
+	})
+	destination := httptest.NewServer(mux)
+	defer destination.Close()
+
+	storage := &memory.MemStorage{}
+	serve := NewServ(confModule.Config, storage)
+	owner := auth.WithUserID(context.Background(), "owner")
+	_, err := serve.Shorten(owner, destination.URL+"/ok", model.LinkOptions{})
+	require.NoError(t, err)
+	_, err = serve.Shorten(owner, destination.URL+"/gone", model.LinkOptions{})
+	require.NoError(t, err)
+
+	interval := time.Hour
+	checker := NewHealthChecker(storage, probe.NewProber(destination.Client()), interval, 2)
+	start := time.Now()
+
+	report := func(query string) []api.HealthReportItem {
+		w := httptest.NewRecorder()
+		serve.HandleHealthReport(w, httptest.NewRequest(http.MethodGet, "/api/internal/health"+query, nil))
+		var items []api.HealthReportItem
+		_ = json.NewDecoder(w.Result().Body).Decode(&items)
+		return items
+	}
+
+	// Интервал для битой ссылки удваивается: проверки в 0, 2 и 6 интервалов
+	tests := []struct {
+		name      string
+		after     int
+		goneHits  int32
+		failures  int
+		broken    bool
+		restored  bool
+		reportLen int
+	}{
+		{name: "First check", after: 0, goneHits: 1, failures: 1},
+		{name: "Backoff", after: 1, goneHits: 1, failures: 1},
+		{name: "Second failure", after: 2, goneHits: 2, failures: 2},
+		{name: "Still backoff", after: 5, goneHits: 2, failures: 2},
+		{name: "Broken", after: 6, goneHits: 3, failures: 3, broken: true, reportLen: 1},
+		{name: "Restored", after: 14, goneHits: 4, restored: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored.Store(tt.restored)
+			err := checker.CheckDue(context.Background(), start.Add(time.Duration(tt.after)*interval))
+			require.NoError(t, err)
+			assert.Equal(t, tt.goneHits, goneHits.Load())
+
+			items := report("")
+			require.Len(t, items, 2)
+			if tt.broken {
+				assert.Equal(t, destination.URL+"/gone", items[0].OriginalURL, "broken links go first")
+			}
+			gone, ok := items[0], items[1]
+			if gone.OriginalURL != destination.URL+"/gone" {
+				gone, ok = ok, gone
+			}
+			assert.Equal(t, tt.failures, gone.Health.Failures)
+			assert.Equal(t, tt.broken, gone.Health.Broken)
+			assert.Zero(t, ok.Health.Failures)
+			assert.Equal(t, http.StatusOK, ok.Health.Status)
+			assert.Len(t, report("?broken=1"), tt.reportLen)
+		})
+	}
+}
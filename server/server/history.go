@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"io"
+	"net/http"
+)
+
+// linkVersions возвращает историю ссылки, последняя версия - текущая
+func (s *Server) linkVersions(info model.LinkInfo) ([]model.LinkVersion, error) {
+	versions, err := s.Storage.History(info.ID)
+	if err != nil {
+		return nil, err
+	}
+	return append(versions, info.Version(len(versions)+1)), nil
+}
+
+// editLink сохраняет новую версию ссылки и отдает ее в ответе
+func (s *Server) editLink(res http.ResponseWriter, req *http.Request, info model.LinkInfo) {
+	err := s.Storage.Edit(info.ID, info.OriginalURL, info.LinkOptions)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	s.enqueueMetadata(info.ID, info.OriginalURL)
+
+	versions, err := s.linkVersions(info)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	writeJSON(res, versions[len(versions)-1])
+}
+
+func readJSON(req *http.Request, data any) error {
+	contentBody, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		return model.NewError(model.CodeInvalid, "can't read body", err)
+	}
+	err = json.Unmarshal(contentBody, data)
+	if err != nil {
+		return model.NewError(model.CodeInvalid, "invalid json", err)
+	}
+	return nil
+}
+
+func (s *Server) HandlePatchLink(res http.ResponseWriter, req *http.Request) {
+
+	var patch api.LinkPatchRequest
+	err := readJSON(req, &patch)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+
+	info, err := s.ownLink(req, model.RoleEditor)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	if patch.URL != nil {
+		info.OriginalURL, err = s.tagLink(*patch.URL, &info.LinkOptions)
+		if err != nil {
+			httpResp.ProblemJSON(res, err)
+			return
+		}
+	}
+	if patch.RedirectType != nil {
+		info.RedirectType = *patch.RedirectType
+	}
+	if patch.ExpiresAt != nil {
+		info.ExpiresAt = patch.ExpiresAt
+	}
+	if patch.NoExpiry {
+		info.ExpiresAt = nil
+	}
+	if patch.Tags != nil {
+		info.Tags = *patch.Tags
+	}
+	if patch.Folder != nil {
+		info.Folder = *patch.Folder
+	}
+	normalizeGroups(&info.LinkOptions)
+	err = ValidateOptions(info.LinkOptions)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	s.editLink(res, req, info)
+}
+
+func (s *Server) HandleLinkHistory(res http.ResponseWriter, req *http.Request) {
+
+	info, err := s.ownLink(req, model.RoleViewer)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	versions, err := s.linkVersions(info)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	writeJSON(res, versions)
+}
+
+// HandleRollback возвращает ссылке одну из прежних версий, откат тоже попадает в историю
+func (s *Server) HandleRollback(res http.ResponseWriter, req *http.Request) {
+
+	var rollback api.RollbackRequest
+	err := readJSON(req, &rollback)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+
+	info, err := s.ownLink(req, model.RoleEditor)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	versions, err := s.linkVersions(info)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	current := versions[len(versions)-1]
+	if rollback.Version == current.Version {
+		writeJSON(res, current)
+		return
+	}
+	index := -1
+	for i, v := range versions {
+		if v.Version == rollback.Version {
+			index = i
+		}
+	}
+	if index < 0 {
+		httpResp.ProblemJSON(res, model.NewError(model.CodeNotFound, "version not found", nil))
+		return
+	}
+
+	version := versions[index]
+	info.OriginalURL = version.URL
+	info.RawURL = version.RawURL
+	info.RedirectType = version.RedirectType
+	info.ExpiresAt = version.ExpiresAt
+	s.editLink(res, req, info)
+}
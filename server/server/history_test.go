@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLinkHistory(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Patch(`/api/links/{id}`, serve.HandlePatchLink)
+	router.Get(`/api/links/{id}/history`, serve.HandleLinkHistory)
+	router.Post(`/api/links/{id}/rollback`, serve.HandleRollback)
+	router.Get(`/{query}`, serve.HandleGET)
+
+	owner := auth.WithUserID(context.Background(), "owner")
+	shortLink, err := serve.Shorten(owner, "https://example.com/old", model.LinkOptions{})
+	require.NoError(t, err)
+	id := shortLink[strings.LastIndex(shortLink, "/")+1:]
+	_, err = serve.Shorten(owner, "https://example.com/taken", model.LinkOptions{})
+	require.NoError(t, err)
+
+	call := func(method, path, userID, body string) *http.Response {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request = request.WithContext(auth.WithUserID(request.Context(), userID))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		userID   string
+		body     string
+		status   int
+		location string
+	}{
+		{name: "Other user", method: http.MethodPatch, path: "/api/links/" + id, userID: "other", body: `{"url":"https://example.com/new"}`, status: http.StatusNotFound, location: "https://example.com/old"},
+		{name: "Taken url", method: http.MethodPatch, path: "/api/links/" + id, userID: "owner", body: `{"url":"https://example.com/taken"}`, status: http.StatusConflict, location: "https://example.com/old"},
+		{name: "Wrong redirect type", method: http.MethodPatch, path: "/api/links/" + id, userID: "owner", body: `{"redirect_type":303}`, status: http.StatusBadRequest, location: "https://example.com/old"},
+		{name: "New url", method: http.MethodPatch, path: "/api/links/" + id, userID: "owner", body: `{"url":"https://example.com/new","redirect_type":302}`, status: http.StatusOK, location: "https://example.com/new"},
+		{name: "Unknown version", method: http.MethodPost, path: "/api/links/" + id + "/rollback", userID: "owner", body: `{"version":5}`, status: http.StatusNotFound, location: "https://example.com/new"},
+		{name: "Rollback", method: http.MethodPost, path: "/api/links/" + id + "/rollback", userID: "owner", body: `{"version":1}`, status: http.StatusOK, location: "https://example.com/old"},
+		{name: "Expired", method: http.MethodPatch, path: "/api/links/" + id, userID: "owner", body: `{"expires_at":"2000-01-01T00:00:00Z"}`, status: http.StatusOK},
+		{name: "No expiry", method: http.MethodPatch, path: "/api/links/" + id, userID: "owner", body: `{"no_expiry":true}`, status: http.StatusOK, location: "https://example.com/old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := call(tt.method, tt.path, tt.userID, tt.body)
+			assert.Equal(t, tt.status, result.StatusCode)
+
+			result = call(http.MethodGet, "/"+id, "", "")
+			assert.Equal(t, tt.location, result.Header.Get("Location"))
+		})
+	}
+
+	result := call(http.MethodGet, "/api/links/"+id+"/history", "owner", "")
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	var versions []model.LinkVersion
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&versions))
+	require.Len(t, versions, 5)
+	assert.Equal(t, "https://example.com/old", versions[0].URL)
+	assert.Equal(t, "https://example.com/new", versions[1].URL)
+	assert.Equal(t, http.StatusFound, versions[1].RedirectType)
+	assert.NotNil(t, versions[3].ExpiresAt)
+	assert.Equal(t, 5, versions[4].Version)
+	assert.Nil(t, versions[4].ReplacedAt)
+	assert.Nil(t, versions[4].ExpiresAt)
+
+	// Ид, посчитанный по прежнему адресу, занят, новая ссылка на этот адрес получает другой
+	result = call(http.MethodPatch, "/api/links/"+id, "owner", `{"url":"https://example.com/new"}`)
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	reused, err := serve.Shorten(owner, "https://example.com/old", model.LinkOptions{})
+	require.NoError(t, err)
+	assert.NotEqual(t, shortLink, reused)
+}
+
+func TestConcurrentEdits(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Patch(`/api/links/{id}`, serve.HandlePatchLink)
+
+	owner := auth.WithUserID(context.Background(), "owner")
+	ids := make([]string, 2)
+	for i := range ids {
+		shortLink, err := serve.Shorten(owner, "https://example.com/"+strconv.Itoa(i), model.LinkOptions{})
+		require.NoError(t, err)
+		ids[i] = shortLink[strings.LastIndex(shortLink, "/")+1:]
+	}
+
+	// Правка одной ссылки не должна попасть в другую
+	var wg sync.WaitGroup
+	for n := 0; n < 20; n++ {
+		for i, id := range ids {
+			wg.Add(1)
+			go func(i int, id string, n int) {
+				defer wg.Done()
+				body := `{"url":"https://example.com/` + strconv.Itoa(i) + `/` + strconv.Itoa(n) + `"}`
+				request := httptest.NewRequest(http.MethodPatch, "/api/links/"+id, strings.NewReader(body))
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, request.WithContext(owner))
+				assert.Equal(t, http.StatusOK, w.Code)
+			}(i, id, n)
+		}
+	}
+	wg.Wait()
+
+	for i, id := range ids {
+		prefix := "https://example.com/" + strconv.Itoa(i)
+		info, err := serve.Storage.Lookup(id)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(info.OriginalURL, prefix+"/"), info.OriginalURL)
+		versions, err := serve.Storage.History(id)
+		require.NoError(t, err)
+		for _, v := range versions {
+			assert.True(t, strings.HasPrefix(v.URL, prefix), v.URL)
+		}
+	}
+}
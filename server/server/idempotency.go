@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	IdempotencyHeader = "Idempotency-Key"
+	// ReplayedHeader отмечает ответ, отданный из сохраненного
+	ReplayedHeader = "Idempotent-Replayed"
+
+	defaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyLease сколько ключ занят выполняющимся запросом. Если процесс упал, не
+	// сохранив ответ, ключ освобождается через это время, а не через IdempotencyTTL
+	idempotencyLease  = time.Minute
+	maxIdempotencyKey = 255
+)
+
+// IdempotencyTTL сколько хранится ответ на запрос с ключом
+func IdempotencyTTL() time.Duration {
+	ttl, err := time.ParseDuration(confModule.Config.Final.IdempotencyTTL)
+	if err != nil || ttl <= 0 {
+		return defaultIdempotencyTTL
+	}
+	return ttl
+}
+
+// idempotencyWriter передает ответ клиенту и запоминает его для повторов
+type idempotencyWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *idempotencyWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// requestHash хэш метода, пути с параметрами и тела запроса
+func requestHash(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method + " " + req.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Idempotent выполняет запрос с заголовком Idempotency-Key один раз. Ключ действует
+// в пределах пользователя IdempotencyTTL, повтор с тем же телом получает сохраненный
+// ответ, с другим телом - 422. Пока запрос выполняется, повтор получает 409, ключ при этом
+// занят на idempotencyLease. Ответы 5xx не сохраняются, запрос можно повторить.
+// Запрос без куки получает новый ид, и его повтор тоже, поэтому ключи таких запросов
+// общие для всех анонимных клиентов и различаются вместе с хэшем запроса
+func (s *Server) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(IdempotencyHeader)
+		if key == "" {
+			next.ServeHTTP(res, req)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "idempotency key is longer than 255 characters", nil))
+			return
+		}
+		if isBatchStream(req) {
+			httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "streaming batch can't have idempotency key", nil))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(res, req.Body, MaxBatchBytes()))
+		_ = req.Body.Close()
+		if err != nil {
+			httpResp.ProblemJSON(res, httpResp.ReadBodyError(err))
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := model.Idempotency{
+			Key:       key,
+			UserID:    auth.GetUserID(req.Context()),
+			Hash:      requestHash(req, body),
+			ExpiresAt: time.Now().Add(idempotencyLease),
+		}
+		if auth.IsNewUser(req.Context()) {
+			record.Key = key + "|" + record.Hash
+			record.UserID = ""
+		}
+		saved, err := s.Storage.ReserveIdempotency(record)
+		switch {
+		case IsConflict(err) && saved.Hash != record.Hash:
+			httpResp.ProblemJSON(res, model.NewError(model.CodeUnprocessable, "idempotency key is used with another request", nil))
+			return
+		case IsConflict(err) && saved.Status == 0:
+			httpResp.ProblemJSON(res, model.NewError(model.CodeConflict, "request with this idempotency key is in progress", nil))
+			return
+		case IsConflict(err):
+			if saved.ContentType != "" {
+				res.Header().Set("Content-Type", saved.ContentType)
+			}
+			res.Header().Set(ReplayedHeader, "true")
+			res.WriteHeader(saved.Status)
+			_, _ = res.Write(saved.Body)
+			return
+		case err != nil:
+			logger.PrintLog(logger.ERROR, "Can not reserve idempotency key: "+err.Error())
+			httpResp.ProblemJSON(res, err)
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: res}
+		next.ServeHTTP(writer, req)
+
+		if writer.status == 0 || writer.status >= http.StatusInternalServerError {
+			err = s.Storage.DeleteIdempotency(record.UserID, record.Key)
+		} else {
+			record.Status = writer.status
+			record.ContentType = res.Header().Get("Content-Type")
+			record.Body = writer.body.Bytes()
+			record.ExpiresAt = time.Now().Add(IdempotencyTTL())
+			err = s.Storage.SaveIdempotency(record)
+		}
+		if err != nil {
+			logger.PrintLog(logger.ERROR, "Can not save idempotency key: "+err.Error())
+		}
+	})
+}
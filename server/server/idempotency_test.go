@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotent(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	failures := 1
+	router := chi.NewRouter()
+	router.With(serve.Idempotent).Post(`/api/shorten`, serve.HandleAPIShorten)
+	router.With(serve.Idempotent).Post(`/api/shorten/batch`, serve.HandleAPIBatch)
+	router.With(serve.Idempotent).Post(`/flaky`, func(res http.ResponseWriter, req *http.Request) {
+		if failures > 0 {
+			failures--
+			res.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		res.WriteHeader(http.StatusNoContent)
+	})
+
+	type want struct {
+		status   int
+		body     string
+		replayed bool
+	}
+	tests := []struct {
+		name   string
+		user   string
+		path   string
+		key    string
+		accept string
+		body   string
+		want   want
+	}{
+		{name: "First", user: "one", path: "/api/shorten", key: "k1", body: `{"url":"https://idempotent.example"}`,
+			want: want{status: http.StatusCreated, body: `{"result":"` + confModule.Config.Final.ShortURLAddr + `/`}},
+		{name: "Retry", user: "one", path: "/api/shorten", key: "k1", body: `{"url":"https://idempotent.example"}`,
+			want: want{status: http.StatusCreated, body: `{"result":"` + confModule.Config.Final.ShortURLAddr + `/`, replayed: true}},
+		{name: "Another body", user: "one", path: "/api/shorten", key: "k1", body: `{"url":"https://other.example"}`,
+			want: want{status: http.StatusUnprocessableEntity, body: `"code":"unprocessable"`}},
+		{name: "Another path", user: "one", path: "/api/shorten/batch", key: "k1", body: `{"url":"https://idempotent.example"}`,
+			want: want{status: http.StatusUnprocessableEntity}},
+		{name: "Without key", user: "one", path: "/api/shorten", body: `{"url":"https://idempotent.example"}`,
+			want: want{status: http.StatusConflict}},
+		{name: "Another user", user: "two", path: "/api/shorten", key: "k1", body: `{"url":"https://idempotent.example"}`,
+			want: want{status: http.StatusConflict}},
+		{name: "Batch", user: "one", path: "/api/shorten/batch", key: "b1", body: `[{"correlation_id":"idem1","original_url":"https://idempotent.example/1"}]`,
+			want: want{status: http.StatusCreated, body: `"status":"created"`}},
+		{name: "Batch retry", user: "one", path: "/api/shorten/batch", key: "b1", body: `[{"correlation_id":"idem1","original_url":"https://idempotent.example/1"}]`,
+			want: want{status: http.StatusCreated, body: `"status":"created"`, replayed: true}},
+		{name: "Streamed batch", user: "one", path: "/api/shorten/batch", key: "b2", accept: "application/x-ndjson", body: `[]`,
+			want: want{status: http.StatusBadRequest}},
+		{name: "Long key", user: "one", path: "/api/shorten", key: strings.Repeat("k", 256), body: `{"url":"https://long.example"}`,
+			want: want{status: http.StatusBadRequest}},
+		{name: "Server error", user: "one", path: "/flaky", key: "f1", want: want{status: http.StatusServiceUnavailable}},
+		{name: "Retry after server error", user: "one", path: "/flaky", key: "f1", want: want{status: http.StatusNoContent}},
+		{name: "Replay after server error", user: "one", path: "/flaky", key: "f1", want: want{status: http.StatusNoContent, replayed: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", "application/json")
+			if tt.key != "" {
+				request.Header.Set(IdempotencyHeader, tt.key)
+			}
+			if tt.accept != "" {
+				request.Header.Set("Accept", tt.accept)
+			}
+			request = request.WithContext(auth.WithUserID(request.Context(), tt.user))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.want.status, result.StatusCode)
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			assert.Contains(t, string(body), tt.want.body)
+			assert.Equal(t, tt.want.replayed, result.Header.Get(ReplayedHeader) == "true")
+		})
+	}
+
+	// Пока запрос выполняется, повтор с тем же ключом получает 409
+	request := httptest.NewRequest(http.MethodPost, "/flaky", nil)
+	request.Header.Set(IdempotencyHeader, "p1")
+	request = request.WithContext(auth.WithUserID(context.Background(), "one"))
+	_, err := serve.Storage.ReserveIdempotency(model.Idempotency{
+		Key:       "p1",
+		UserID:    "one",
+		Hash:      requestHash(request, nil),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Брошенная резервация держит ключ только idempotencyLease, сохраненный ответ - IdempotencyTTL
+	_, err = serve.Storage.ReserveIdempotency(model.Idempotency{
+		Key:       "p2",
+		UserID:    "one",
+		Hash:      requestHash(request, nil),
+		ExpiresAt: time.Now().Add(-time.Second),
+	})
+	require.NoError(t, err)
+	request.Header.Set(IdempotencyHeader, "p2")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	saved, err := serve.Storage.ReserveIdempotency(model.Idempotency{Key: "p2", UserID: "one"})
+	require.Error(t, err)
+	assert.WithinDuration(t, time.Now().Add(IdempotencyTTL()), saved.ExpiresAt, time.Minute)
+}
+
+func TestIdempotentWithoutCookie(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Use(auth.Handler)
+	router.With(serve.Idempotent).Post(`/api/shorten`, serve.HandleAPIShorten)
+
+	post := func(body string) *http.Response {
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(IdempotencyHeader, "anonymous")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	// Повтор без куки получает новый ид пользователя, но не создает ссылку повторно
+	first := post(`{"url":"https://anonymous.example"}`)
+	require.Equal(t, http.StatusCreated, first.StatusCode)
+	retry := post(`{"url":"https://anonymous.example"}`)
+	require.Equal(t, http.StatusCreated, retry.StatusCode)
+	assert.Equal(t, "true", retry.Header.Get(ReplayedHeader))
+	firstBody, err := io.ReadAll(first.Body)
+	require.NoError(t, err)
+	retryBody, err := io.ReadAll(retry.Body)
+	require.NoError(t, err)
+	assert.Equal(t, string(firstBody), string(retryBody))
+
+	// Тот же ключ другого анонимного клиента с другим запросом не мешает ему
+	other := post(`{"url":"https://anonymous-other.example"}`)
+	assert.Equal(t, http.StatusCreated, other.StatusCode)
+	assert.Empty(t, other.Header.Get(ReplayedHeader))
+
+	stats, err := serve.Storage.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.URLs)
+}
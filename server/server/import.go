@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Результаты импорта строки
+const (
+	ImportCreated = "created"
+	ImportExists  = "exists"
+	ImportFailed  = "error"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	// maxImportLine ограничивает длину строки jsonl
+	maxImportLine = 1 << 20
+)
+
+// csvColumns синонимы колонок csv, заголовок обязателен, порядок колонок любой
+var csvColumns = map[string]string{
+	"url":          "url",
+	"original_url": "url",
+	"alias":        "alias",
+	"id":           "alias",
+	"expires_at":   "expires_at",
+	"tags":         "tags",
+	"folder":       "folder",
+	"domain":       "domain",
+}
+
+// HandleImport сохраняет ссылки из csv или jsonl и отдает результат по каждой строке.
+// Тело читается потоком, формат задается параметром format или Content-Type
+func (s *Server) HandleImport(res http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	format := importFormat(req)
+	if format == "" {
+		httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "unsupported import format, use csv or jsonl", nil))
+		return
+	}
+
+	resp := api.ImportResponse{Rows: []api.ImportRow{}}
+	add := func(row api.ImportRow) {
+		switch row.Status {
+		case ImportCreated:
+			resp.Created++
+		case ImportExists:
+			resp.Exists++
+		default:
+			resp.Failed++
+		}
+		resp.Rows = append(resp.Rows, row)
+	}
+
+	var err error
+	if format == FormatCSV {
+		err = s.importCSV(req.Context(), req.Body, add)
+	} else {
+		err = s.importJSONL(req.Context(), req.Body, add)
+	}
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can not import links: "+err.Error())
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	writeJSON(res, resp)
+}
+
+func importFormat(req *http.Request) string {
+	switch req.URL.Query().Get("format") {
+	case FormatCSV:
+		return FormatCSV
+	case FormatJSONL:
+		return FormatJSONL
+	case "":
+	default:
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		return FormatCSV
+	}
+	if isJSONLines(mediaType) {
+		return FormatJSONL
+	}
+	return ""
+}
+
+// importCSV читает записи csv по одной. Ошибка разбора записи попадает в результат
+// строки, ошибка чтения тела прерывает импорт
+func (s *Server) importCSV(ctx context.Context, body io.Reader, add func(row api.ImportRow)) error {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return model.NewError(model.CodeInvalid, "csv header is missing", nil)
+	}
+	if err != nil {
+		return model.NewError(model.CodeInvalid, "invalid csv header", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		if column, ok := csvColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			if _, seen := columns[column]; !seen {
+				columns[column] = i
+			}
+		}
+	}
+	if _, ok := columns["url"]; !ok {
+		return model.NewError(model.CodeInvalid, "csv header has no url column", nil)
+	}
+	field := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			add(api.ImportRow{Row: row, Status: ImportFailed, Error: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		item := api.ImportItem{
+			URL:    field(record, "url"),
+			Alias:  field(record, "alias"),
+			Tags:   SplitTags(field(record, "tags")),
+			Folder: field(record, "folder"),
+			Domain: field(record, "domain"),
+		}
+		if expiresAt := field(record, "expires_at"); expiresAt != "" {
+			moment, err := time.Parse(time.RFC3339, expiresAt)
+			if err != nil {
+				add(api.ImportRow{Row: row, Status: ImportFailed, Error: "expires_at must be in RFC 3339 format"})
+				continue
+			}
+			item.ExpiresAt = &moment
+		}
+		add(s.importItem(ctx, row, item))
+	}
+}
+
+// importJSONL читает по одному json объекту на строку, пустые строки пропускаются
+func (s *Server) importJSONL(ctx context.Context, body io.Reader, add func(row api.ImportRow)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxImportLine)
+
+	row := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		row++
+		var item api.ImportItem
+		err := json.Unmarshal([]byte(line), &item)
+		if err != nil {
+			add(api.ImportRow{Row: row, Status: ImportFailed, Error: "invalid json"})
+			continue
+		}
+		add(s.importItem(ctx, row, item))
+	}
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return model.NewError(model.CodeInvalid, "jsonl line is too long", scanner.Err())
+	}
+	return scanner.Err()
+}
+
+// importItem сохраняет одну ссылку. Уже сокращенный адрес не считается ошибкой
+func (s *Server) importItem(ctx context.Context, row int, item api.ImportItem) api.ImportRow {
+	result := api.ImportRow{Row: row}
+	target, err := url.ParseRequestURI(item.URL)
+	if err != nil || target.Scheme != "http" && target.Scheme != "https" || target.Host == "" {
+		result.Status = ImportFailed
+		result.Error = "url must be absolute http or https url"
+		return result
+	}
+	alias := item.Alias
+	if alias == "" {
+		alias = item.ID
+	}
+	domain, err := domains.Find(item.Domain)
+	if err != nil {
+		result.Status = ImportFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	// Адрес мог быть сокращен раньше под ид, посчитанным по адресу
+	linkID := s.freeID(ctx, domain.Name, item.URL)
+	info, err := s.Storage.Lookup(linkID)
+	if err == nil && info.OriginalURL == item.URL {
+		result.Status = ImportExists
+		result.ShortURL = info.ShortURL
+		return result
+	}
+
+	shortLink, err := s.ShortenAlias(ctx, item.URL, alias, model.LinkOptions{ExpiresAt: item.ExpiresAt, Tags: item.Tags, Folder: item.Folder, Domain: domain.Name})
+	switch {
+	case err == nil:
+		result.Status = ImportCreated
+		result.ShortURL = shortLink
+	case IsConflict(err) && shortLink != "":
+		result.Status = ImportExists
+		result.ShortURL = shortLink
+	default:
+		result.Status = ImportFailed
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestImportExport(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Post(`/api/import`, serve.HandleImport)
+	router.Get(`/api/export`, serve.HandleExport)
+
+	owner := auth.WithUserID(context.Background(), "owner")
+	existing, err := serve.Shorten(owner, "https://example.com/existing", model.LinkOptions{})
+	require.NoError(t, err)
+
+	call := func(method, path, contentType, body string) *http.Response {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", contentType)
+		request = request.WithContext(auth.WithUserID(request.Context(), "owner"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		status      int
+		rows        []api.ImportRow
+	}{
+		{name: "Unknown format", path: "/api/import", contentType: "text/plain", body: "https://example.com", status: http.StatusBadRequest},
+		{name: "No url column", path: "/api/import", contentType: "text/csv", body: "link,alias\nhttps://example.com,abc\n", status: http.StatusBadRequest},
+		{
+			name:        "Csv",
+			path:        "/api/import",
+			contentType: "text/csv",
+			body: "alias,URL,expires_at,tags\n" +
+				"docs,https://example.com/docs,2100-01-01T00:00:00Z,\"Docs, Help\"\n" +
+				",https://example.com/existing,,\n" +
+				"docs,https://example.com/other,,\n" +
+				"a!,https://example.com/bad-alias,,\n" +
+				"api,https://example.com/reserved,,\n" +
+				",ftp://example.com,,\n" +
+				",https://example.com/expiry,tomorrow,\n" +
+				",https://example.com/plain,,news|news\n",
+			status: http.StatusOK,
+			rows: []api.ImportRow{
+				{Row: 1, Status: ImportCreated, ShortURL: confModule.Config.Final.ShortURLAddr + "/docs"},
+				{Row: 2, Status: ImportExists, ShortURL: existing},
+				{Row: 3, Status: ImportFailed, Error: "alias is taken"},
+				{Row: 4, Status: ImportFailed, Error: "alias must be 3-64 letters, digits, _ or -"},
+				{Row: 5, Status: ImportFailed, Error: "alias api is reserved"},
+				{Row: 6, Status: ImportFailed, Error: "url must be absolute http or https url"},
+				{Row: 7, Status: ImportFailed, Error: "expires_at must be in RFC 3339 format"},
+				{Row: 8, Status: ImportCreated},
+			},
+		},
+		{
+			name: "Jsonl",
+			path: "/api/import?format=jsonl",
+			body: `{"url":"https://example.com/docs","alias":"docs"}` + "\n\n" +
+				`{"url":"https://example.com/json","id":"json-link","tags":["x"]}` + "\n" +
+				`{"url":` + "\n",
+			status: http.StatusOK,
+			rows: []api.ImportRow{
+				{Row: 1, Status: ImportExists, ShortURL: confModule.Config.Final.ShortURLAddr + "/docs"},
+				{Row: 2, Status: ImportCreated, ShortURL: confModule.Config.Final.ShortURLAddr + "/json-link"},
+				{Row: 3, Status: ImportFailed, Error: "invalid json"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := call(http.MethodPost, tt.path, tt.contentType, tt.body)
+			defer result.Body.Close()
+			require.Equal(t, tt.status, result.StatusCode)
+			if tt.rows == nil {
+				return
+			}
+			var resp api.ImportResponse
+			require.NoError(t, json.NewDecoder(result.Body).Decode(&resp))
+			require.Len(t, resp.Rows, len(tt.rows))
+			for i, row := range tt.rows {
+				if row.ShortURL == "" && row.Status == ImportCreated {
+					row.ShortURL = resp.Rows[i].ShortURL
+				}
+				assert.Equal(t, row, resp.Rows[i])
+			}
+		})
+	}
+
+	result := call(http.MethodGet, "/api/export?format=xml", "", "")
+	assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+
+	result = call(http.MethodGet, "/api/export", "", "")
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, `attachment; filename="links.csv"`, result.Header.Get("Content-Disposition"))
+	records, err := csv.NewReader(result.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 5)
+	assert.Equal(t, exportHeader, records[0])
+	assert.Equal(t, []string{"docs", confModule.Config.Final.ShortURLAddr + "/docs", "https://example.com/docs", "2100-01-01T00:00:00Z", "docs,help", "0"}, records[2][:6])
+
+	result = call(http.MethodGet, "/api/export?format=jsonl", "", "")
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	var exported []api.ExportItem
+	scanner := bufio.NewScanner(result.Body)
+	for scanner.Scan() {
+		var item api.ExportItem
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &item))
+		exported = append(exported, item)
+	}
+	require.Len(t, exported, 4)
+	assert.Equal(t, []string{"x"}, exported[3].Tags)
+
+	// Выгрузку можно загрузить обратно, все ссылки уже есть
+	result = call(http.MethodGet, "/api/export", "", "")
+	export := new(strings.Builder)
+	_, err = bufio.NewReader(result.Body).WriteTo(export)
+	require.NoError(t, err)
+	result = call(http.MethodPost, "/api/import", "text/csv", export.String())
+	var resp api.ImportResponse
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&resp))
+	assert.Equal(t, api.ImportResponse{Exists: 4, Rows: resp.Rows}, resp)
+}
+
+func TestExportConcurrentUsers(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Get(`/api/export`, serve.HandleExport)
+
+	users := []string{"first", "second"}
+	for _, user := range users {
+		_, err := serve.Shorten(auth.WithUserID(context.Background(), user), "https://example.com/"+user, model.LinkOptions{})
+		require.NoError(t, err)
+	}
+
+	// Выгрузка одного пользователя не должна попадать к другому, даже если запросы идут параллельно
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		for _, user := range users {
+			wg.Add(1)
+			go func(user string) {
+				defer wg.Done()
+				request := httptest.NewRequest(http.MethodGet, "/api/export?format=jsonl", nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, request.WithContext(auth.WithUserID(request.Context(), user)))
+				var item api.ExportItem
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &item))
+				assert.Equal(t, "https://example.com/"+user, item.URL)
+			}(user)
+		}
+	}
+	wg.Wait()
+}
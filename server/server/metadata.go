@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/metadata"
+	"time"
+)
+
+const (
+	metadataQueueSize = 1024
+	MetadataWorkers   = 4
+)
+
+type metadataTask struct {
+	id   string
+	link string
+}
+
+// Enricher в фоне загружает заголовок и Open Graph теги новых ссылок
+type Enricher struct {
+	storage model.Storable
+	fetcher *metadata.Fetcher
+	queue   chan metadataTask
+}
+
+func NewEnricher(storage model.Storable, fetcher *metadata.Fetcher) *Enricher {
+	return &Enricher{storage: storage, fetcher: fetcher, queue: make(chan metadataTask, metadataQueueSize)}
+}
+
+// Run запускает обработчики очереди, они работают до отмены ctx
+func (e *Enricher) Run(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case task := <-e.queue:
+					err := e.Enrich(ctx, task.id, task.link)
+					if err != nil {
+						logger.PrintLog(logger.WARN, "Can't fetch metadata of "+task.link+": "+err.Error())
+					}
+				}
+			}
+		}()
+	}
+}
+
+// Enqueue ставит ссылку в очередь, при переполненной очереди ссылка пропускается
+func (e *Enricher) Enqueue(id, link string) {
+	select {
+	case e.queue <- metadataTask{id: id, link: link}:
+	default:
+		logger.PrintLog(logger.WARN, "Metadata queue is full, skip "+id)
+	}
+}
+
+// Enrich загружает страницу link и сохраняет ее данные у ссылки id
+func (e *Enricher) Enrich(ctx context.Context, id, link string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*metadata.DefaultTimeout)
+	defer cancel()
+	page, err := e.fetcher.Fetch(ctx, link)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return e.storage.SetMetadata(id, model.Metadata{
+		Title:       page.Title,
+		Description: page.Description,
+		Image:       page.Image,
+		FetchedAt:   &now,
+	})
+}
+
+// enqueueMetadata ставит ссылку в очередь, если фоновая загрузка включена
+func (s *Server) enqueueMetadata(id, link string) {
+	if s.Metadata != nil {
+		s.Metadata.Enqueue(id, link)
+	}
+}
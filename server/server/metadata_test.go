@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/metadata"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetadataEnrichment(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<head><title>` + strings.Trim(r.URL.Path, "/") + `</title>
+			<meta property="og:image" content="/cover.png"></head>`))
+	}))
+	defer destination.Close()
+
+	storage := &memory.MemStorage{}
+	serve := NewServ(confModule.Config, storage)
+	serve.Metadata = NewEnricher(storage, metadata.NewFetcher(destination.Client()))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serve.Metadata.Run(ctx, 1)
+
+	owner := auth.WithUserID(context.Background(), "owner")
+	_, err := serve.Shorten(owner, destination.URL+"/single", model.LinkOptions{})
+	require.NoError(t, err)
+	_, err = serve.BatchShorten(owner, `[{"correlation_id":"batch1","original_url":"`+destination.URL+`/batch"}]`, false)
+	require.NoError(t, err)
+
+	userURLs := func() []api.UserURL {
+		request := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		request = request.WithContext(owner)
+		w := httptest.NewRecorder()
+		serve.HandleUserURLs(w, request)
+		var urls []api.UserURL
+		_ = json.NewDecoder(w.Result().Body).Decode(&urls)
+		return urls
+	}
+
+	require.Eventually(t, func() bool {
+		urls := userURLs()
+		for _, v := range urls {
+			if v.Metadata == nil {
+				return false
+			}
+		}
+		return len(urls) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for _, v := range userURLs() {
+		assert.Equal(t, strings.TrimPrefix(v.OriginalURL, destination.URL+"/"), v.Metadata.Title)
+		assert.Equal(t, destination.URL+"/cover.png", v.Metadata.Image)
+		assert.NotNil(t, v.Metadata.FetchedAt)
+	}
+
+	// Недоступная страница не ломает ссылку, метаданные остаются пустыми
+	err = serve.Metadata.Enrich(context.Background(), "missing", "http://127.0.0.1:1/")
+	assert.Error(t, err)
+}
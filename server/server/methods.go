@@ -0,0 +1,105 @@
+package server
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strings"
+)
+
+var knownMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+const corsMaxAge = "600"
+
+var errNotFound = model.NewError(model.CodeNotFound, "route not found", nil)
+var errForbidden = model.NewError(model.CodeForbidden, "origin is not allowed", nil)
+
+// AllowedMethods возвращает методы, для которых у пути есть обработчик
+func AllowedMethods(routes chi.Routes, path string) []string {
+	var allowed []string
+	for _, method := range knownMethods {
+		if routes.Match(chi.NewRouteContext(), method, path) {
+			allowed = append(allowed, method)
+		}
+	}
+	if len(allowed) > 0 {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	return allowed
+}
+
+// HandleMethodNotAllowed отдает 405 со списком доступных методов в заголовке Allow
+func HandleMethodNotAllowed(routes chi.Routes) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		httpResp.MethodNotAllowed(res, AllowedMethods(routes, req.URL.Path))
+	}
+}
+
+// originAccess сообщает, разрешен ли origin настройками и указан ли он в них явно.
+// По * разрешен любой origin, но без cookie: credentials получают только явно указанные
+func originAccess(origin string) (isAllowed, isListed bool) {
+	for _, allowed := range strings.Split(confModule.Config.Final.CORSOrigins, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if strings.EqualFold(allowed, origin) {
+			return true, true
+		}
+		isAllowed = isAllowed || allowed == "*"
+	}
+	return isAllowed, false
+}
+
+// CORS разрешает кросс-доменные запросы для origin из настроек и отвечает на OPTIONS
+func CORS(routes chi.Routes) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			origin := req.Header.Get("Origin")
+			isAllowed, isListed := false, false
+			if origin != "" {
+				isAllowed, isListed = originAccess(origin)
+				res.Header().Add("Vary", "Origin")
+			}
+			if isListed {
+				res.Header().Set("Access-Control-Allow-Origin", origin)
+				res.Header().Set("Access-Control-Allow-Credentials", "true")
+			} else if isAllowed {
+				res.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+
+			if req.Method != http.MethodOptions {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			allowed := AllowedMethods(routes, req.URL.Path)
+			if len(allowed) == 0 {
+				httpResp.ErrorText(res, errNotFound)
+				return
+			}
+
+			// preflight
+			if origin != "" && req.Header.Get("Access-Control-Request-Method") != "" {
+				if !isAllowed {
+					httpResp.ErrorText(res, errForbidden)
+					return
+				}
+				res.Header().Set("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+				if headers := req.Header.Get("Access-Control-Request-Headers"); headers != "" {
+					res.Header().Set("Access-Control-Allow-Headers", headers)
+				}
+				res.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			}
+
+			res.Header().Set("Allow", strings.Join(allowed, ", "))
+			httpResp.NoContent(res)
+		})
+	}
+}
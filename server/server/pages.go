@@ -0,0 +1,70 @@
+package server
+
+import (
+	"embed"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//go:embed pages/*.html
+var pagesFS embed.FS
+
+var pages = template.Must(template.ParseFS(pagesFS, "pages/*.html"))
+
+// Режимы страницы с предупреждением, задаются в конфиге
+const (
+	InterstitialOff     = "off"     // только для ссылок с настройкой interstitial
+	InterstitialFlagged = "flagged" // еще и для адресов из блоклиста
+	InterstitialAll     = "all"     // для всех ссылок
+)
+
+type pageData struct {
+	ShortURL    string
+	Destination string
+	CreatedAt   *time.Time
+	Clicks      int
+	Flagged     bool
+}
+
+func renderPage(res http.ResponseWriter, name string, data pageData) {
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(http.StatusOK)
+	err := pages.ExecuteTemplate(res, name, data)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't render "+name+": "+err.Error())
+	}
+}
+
+// IsBlocked сообщает, что домен адреса или его родительский домен есть в блоклисте
+func IsBlocked(link string) bool {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, domain := range strings.Split(confModule.Config.Final.Blocklist, ",") {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// needsInterstitial решает, показать ли предупреждение вместо редиректа
+func needsInterstitial(info model.LinkInfo, flagged bool) bool {
+	switch confModule.Config.Final.Interstitial {
+	case InterstitialAll:
+		return true
+	case InterstitialOff:
+		return info.Interstitial
+	}
+	return info.Interstitial || flagged
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsBlocked(t *testing.T) {
+	confModule.Config.Final.Blocklist = "bad.example, Evil.example"
+	defer func() { confModule.Config.Final.Blocklist = "" }()
+
+	tests := []struct {
+		link string
+		want bool
+	}{
+		{link: "https://bad.example/path", want: true},
+		{link: "https://www.evil.example", want: true},
+		{link: "https://notbad.example", want: false},
+		{link: "https://good.example/?to=bad.example", want: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, IsBlocked(tt.link), tt.link)
+	}
+}
+
+func TestPreviewAndInterstitial(t *testing.T) {
+	confModule.Config.Final.Blocklist = "bad.example"
+	defer func() { confModule.Config.Final.Blocklist = "" }()
+
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Get(`/{query}`, serve.HandleGET)
+
+	shorten := func(link string, options model.LinkOptions) string {
+		shortLink, err := serve.Shorten(context.Background(), link, options)
+		require.NoError(t, err)
+		return shortLink[strings.LastIndex(shortLink, "/"):]
+	}
+	plain := shorten("https://example.com/preview", model.LinkOptions{})
+	warned := shorten("https://example.com/warned", model.LinkOptions{Interstitial: true})
+	blocked := shorten("https://bad.example/page", model.LinkOptions{})
+
+	tests := []struct {
+		name     string
+		path     string
+		mode     string
+		status   int
+		contains string
+	}{
+		{name: "Redirect", path: plain, status: http.StatusTemporaryRedirect},
+		{name: "Preview with plus", path: plain + "+", status: http.StatusOK, contains: "Clicks</dt><dd>1</dd>"},
+		{name: "Preview with flag", path: plain + "?preview=1", status: http.StatusOK, contains: "https://example.com/preview"},
+		{name: "Per-link interstitial", path: warned, status: http.StatusOK, contains: "The owner of this link"},
+		{name: "Blocklisted", path: blocked, status: http.StatusOK, contains: "blocklist"},
+		{name: "Blocklist off", path: blocked, mode: InterstitialOff, status: http.StatusTemporaryRedirect},
+		{name: "Interstitial for all", path: plain, mode: InterstitialAll, status: http.StatusOK, contains: "Continue"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			confModule.Config.Final.Interstitial = tt.mode
+			defer func() { confModule.Config.Final.Interstitial = "" }()
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			result := w.Result()
+			defer result.Body.Close()
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.status, result.StatusCode)
+			assert.Contains(t, string(body), tt.contains)
+			if tt.status == http.StatusOK {
+				assert.Empty(t, result.Header.Get("Location"))
+				assert.Equal(t, "no-store", result.Header.Get("Cache-Control"))
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"net/url"
+	"path"
+)
+
+// Destination собирает url для редиректа: дописывает к оригинальному url
+// подпуть и параметры запроса, если ссылка это разрешает
+func Destination(info model.LinkInfo, subPath string, query url.Values) string {
+	if (subPath == "" || !info.PassPath) && (len(query) == 0 || info.Passthrough == model.PassthroughNone) {
+		return info.OriginalURL
+	}
+
+	target, err := url.Parse(info.OriginalURL)
+	if err != nil {
+		logger.PrintLog(logger.WARN, "Can't parse original url: "+err.Error())
+		return info.OriginalURL
+	}
+
+	if info.PassPath && subPath != "" {
+		// Подпуть не должен подниматься выше пути оригинального url
+		target = target.JoinPath(path.Clean("/" + subPath))
+	}
+
+	if info.Passthrough != model.PassthroughNone && len(query) > 0 {
+		values := target.Query()
+		for key, incoming := range query {
+			switch {
+			case !values.Has(key) || info.Passthrough == model.PassthroughOverride:
+				values[key] = incoming
+			case info.Passthrough == model.PassthroughAppend:
+				values[key] = append(values[key], incoming...)
+			}
+		}
+		target.RawQuery = values.Encode()
+	}
+
+	return target.String()
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestDestination(t *testing.T) {
+	const original = "https://example.com/landing?utm_source=site"
+
+	tests := []struct {
+		name    string
+		options model.LinkOptions
+		subPath string
+		query   string
+		want    string
+	}{
+		{
+			name:  "Passthrough disabled",
+			query: "utm_source=x",
+			want:  original,
+		},
+		{
+			name:    "Keep destination value",
+			options: model.LinkOptions{Passthrough: model.PassthroughKeep},
+			query:   "utm_source=x&ref=mail",
+			want:    "https://example.com/landing?ref=mail&utm_source=site",
+		},
+		{
+			name:    "Override destination value",
+			options: model.LinkOptions{Passthrough: model.PassthroughOverride},
+			query:   "utm_source=x",
+			want:    "https://example.com/landing?utm_source=x",
+		},
+		{
+			name:    "Append value",
+			options: model.LinkOptions{Passthrough: model.PassthroughAppend},
+			query:   "utm_source=x",
+			want:    "https://example.com/landing?utm_source=site&utm_source=x",
+		},
+		{
+			name:    "Sub-path",
+			options: model.LinkOptions{PassPath: true},
+			subPath: "extra/path",
+			query:   "utm_source=x",
+			want:    "https://example.com/landing/extra/path?utm_source=site",
+		},
+		{
+			name:    "Sub-path can't leave destination",
+			options: model.LinkOptions{PassPath: true},
+			subPath: "../../admin",
+			want:    "https://example.com/landing/admin?utm_source=site",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			assert.NoError(t, err)
+			info := model.LinkInfo{OriginalURL: original, LinkOptions: tt.options}
+			assert.Equal(t, tt.want, Destination(info, tt.subPath, query))
+		})
+	}
+}
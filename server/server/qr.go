@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/hash/sha1hash"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/qrcode"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	qrDefaultSize = 256
+	qrMinSize     = 32
+	qrMaxSize     = 2048
+	qrMaxMargin   = 16
+)
+
+type qrParams struct {
+	format string
+	level  qrcode.Level
+	style  qrcode.Style
+}
+
+// parseQRParams разбирает параметры картинки, незаданные берутся по умолчанию
+func parseQRParams(query url.Values) (qrParams, error) {
+	params := qrParams{format: "png", level: qrcode.Medium}
+	params.style = qrcode.Style{Size: qrDefaultSize, Margin: 4}
+	params.style.Foreground, _ = qrcode.ParseColor("000000")
+	params.style.Background, _ = qrcode.ParseColor("ffffff")
+
+	if format := query.Get("format"); format != "" {
+		if format != "png" && format != "svg" {
+			return params, model.NewError(model.CodeInvalid, "format must be png or svg", nil)
+		}
+		params.format = format
+	}
+	if level := query.Get("level"); level != "" {
+		var ok bool
+		if params.level, ok = qrcode.ParseLevel(level); !ok {
+			return params, model.NewError(model.CodeInvalid, "level must be L, M, Q or H", nil)
+		}
+	}
+
+	var err error
+	if size := query.Get("size"); size != "" {
+		params.style.Size, err = strconv.Atoi(size)
+		if err != nil || params.style.Size < qrMinSize || params.style.Size > qrMaxSize {
+			return params, model.NewError(model.CodeInvalid, "size must be from 32 to 2048", nil)
+		}
+	}
+	if margin := query.Get("margin"); margin != "" {
+		params.style.Margin, err = strconv.Atoi(margin)
+		if err != nil || params.style.Margin < 0 || params.style.Margin > qrMaxMargin {
+			return params, model.NewError(model.CodeInvalid, "margin must be from 0 to 16", nil)
+		}
+	}
+
+	var ok bool
+	if fg := query.Get("fg"); fg != "" {
+		if params.style.Foreground, ok = qrcode.ParseColor(fg); !ok {
+			return params, model.NewError(model.CodeInvalid, "fg must be a hex color", nil)
+		}
+	}
+	if bg := query.Get("bg"); bg != "" {
+		if params.style.Background, ok = qrcode.ParseColor(bg); !ok {
+			return params, model.NewError(model.CodeInvalid, "bg must be a hex color", nil)
+		}
+	}
+	return params, nil
+}
+
+// etag зависит только от короткого url и параметров, картинка для них всегда одна
+func (p qrParams) etag(shortURL string) string {
+	key := fmt.Sprintf("%s|%s|%d|%d|%d|%v|%v", shortURL, p.format, p.level,
+		p.style.Size, p.style.Margin, p.style.Foreground, p.style.Background)
+	return `"` + sha1hash.Create(key, 16) + `"`
+}
+
+func matchesETag(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == etag || v == "W/"+etag || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleQR отдает QR-код короткой ссылки в png или svg
+func (s *Server) HandleQR(res http.ResponseWriter, req *http.Request) {
+
+	id := chi.URLParam(req, "id")
+	params, err := parseQRParams(req.URL.Query())
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	_, err = s.Resolve(req.Context(), id)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+
+	shortURL := domains.ShortURL(id)
+	etag := params.etag(shortURL)
+	res.Header().Set("ETag", etag)
+	res.Header().Set("Cache-Control", "public, max-age=86400")
+	if matchesETag(req.Header.Get("If-None-Match"), etag) {
+		res.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	code, err := qrcode.Encode([]byte(shortURL), params.level)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't encode qr: "+err.Error())
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+
+	contentType := "image/png"
+	var image []byte
+	if params.format == "svg" {
+		contentType = "image/svg+xml"
+		image = code.SVG(params.style)
+	} else {
+		image, err = code.PNG(params.style)
+	}
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't render qr: "+err.Error())
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	res.Header().Set("Content-Type", contentType)
+	res.WriteHeader(http.StatusOK)
+	_, _ = res.Write(image)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleQR(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Get(`/api/qr/{id}`, serve.HandleQR)
+
+	shortLink, err := serve.Shorten(context.Background(), "https://example.com/poster", model.LinkOptions{})
+	require.NoError(t, err)
+	id := shortLink[strings.LastIndex(shortLink, "/")+1:]
+
+	tests := []struct {
+		name        string
+		path        string
+		status      int
+		contentType string
+	}{
+		{name: "Default png", path: "/api/qr/" + id, status: http.StatusOK, contentType: "image/png"},
+		{name: "Svg with colors", path: "/api/qr/" + id + "?format=svg&level=H&margin=2&fg=%23ff0000&bg=00ff00", status: http.StatusOK, contentType: "image/svg+xml"},
+		{name: "Unknown format", path: "/api/qr/" + id + "?format=gif", status: http.StatusBadRequest},
+		{name: "Too large", path: "/api/qr/" + id + "?size=5000", status: http.StatusBadRequest},
+		{name: "Wrong color", path: "/api/qr/" + id + "?fg=red", status: http.StatusBadRequest},
+		{name: "Unknown link", path: "/api/qr/unknown", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.status, result.StatusCode)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, tt.contentType, result.Header.Get("Content-Type"))
+				assert.NotEmpty(t, result.Header.Get("ETag"))
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/qr/"+id+"?size=300", nil))
+	img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 300, img.Bounds().Dx())
+
+	request := httptest.NewRequest(http.MethodGet, "/api/qr/"+id+"?size=300", nil)
+	request.Header.Set("If-None-Match", w.Result().Header.Get("ETag"))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusNotModified, w.Result().StatusCode)
+	assert.Empty(t, w.Body.Bytes())
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const ruleTimeLayout = "15:04"
+
+// DeviceOf определяет класс устройства по User-Agent
+func DeviceOf(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "bot") || strings.Contains(ua, "crawler") || strings.Contains(ua, "spider"):
+		return model.DeviceBot
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad") || strings.Contains(ua, "ipod"):
+		return model.DeviceIOS
+	case strings.Contains(ua, "android"):
+		return model.DeviceAndroid
+	case strings.Contains(ua, "mobile"):
+		return model.DeviceMobile
+	}
+	return model.DeviceDesktop
+}
+
+func matchDevice(rule, device string) bool {
+	if rule == model.DeviceMobile {
+		return device == model.DeviceMobile || device == model.DeviceIOS || device == model.DeviceAndroid
+	}
+	return rule == device
+}
+
+// matchLanguage ищет язык правила среди языков Accept-Language, ru подходит и для ru-RU
+func matchLanguage(rule, acceptLanguage string) bool {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(tag, rule) || strings.HasPrefix(strings.ToLower(tag), strings.ToLower(rule)+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTime проверяет окно времени, окно может переходить через полночь
+func matchTime(from, to string, now time.Time) bool {
+	current := now.UTC().Format(ruleTimeLayout)
+	if from == "" {
+		from = "00:00"
+	}
+	if to == "" {
+		to = "24:00"
+	}
+	if from <= to {
+		return current >= from && current < to
+	}
+	return current >= from || current < to
+}
+
+func matchRule(rule model.Rule, req *http.Request, now time.Time) bool {
+	if rule.Device != "" && !matchDevice(rule.Device, DeviceOf(req.UserAgent())) {
+		return false
+	}
+	if rule.Language != "" && !matchLanguage(rule.Language, req.Header.Get("Accept-Language")) {
+		return false
+	}
+	if rule.Country != "" && !strings.EqualFold(rule.Country, req.Header.Get(confModule.Config.Final.CountryHeader)) {
+		return false
+	}
+	if (rule.From != "" || rule.To != "") && !matchTime(rule.From, rule.To, now) {
+		return false
+	}
+	return true
+}
+
+// SelectTarget возвращает цель первого подходящего правила или оригинальный url,
+// если ни одно правило не подошло
+func SelectTarget(info model.LinkInfo, req *http.Request, now time.Time) (string, bool) {
+	for _, rule := range info.Rules {
+		if matchRule(rule, req, now) {
+			return rule.Target, true
+		}
+	}
+	return info.OriginalURL, false
+}
+
+func validateRules(rules []model.Rule) error {
+	for _, rule := range rules {
+		target, err := url.ParseRequestURI(rule.Target)
+		if err != nil || target.Scheme == "" {
+			return model.NewError(model.CodeInvalid, "rule target must be absolute url", err)
+		}
+		switch rule.Device {
+		case "", model.DeviceIOS, model.DeviceAndroid, model.DeviceMobile, model.DeviceDesktop, model.DeviceBot:
+		default:
+			return model.NewError(model.CodeInvalid, "unsupported rule device "+rule.Device, nil)
+		}
+		for _, moment := range []string{rule.From, rule.To} {
+			if _, err = time.Parse(ruleTimeLayout, moment); moment != "" && err != nil {
+				return model.NewError(model.CodeInvalid, "rule time must be in 15:04 format", err)
+			}
+		}
+		// Окно с одинаковыми началом и концом пустое, и правило никогда бы не сработало
+		from := rule.From
+		if from == "" {
+			from = "00:00"
+		}
+		if rule.To != "" && from == rule.To {
+			return model.NewError(model.CodeInvalid, "rule time window is empty, from and to must differ", nil)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSelectTarget(t *testing.T) {
+	confModule.Config.Final.CountryHeader = "X-Country-Code"
+	info := model.LinkInfo{
+		OriginalURL: "https://example.com",
+		LinkOptions: model.LinkOptions{Rules: []model.Rule{
+			{Device: model.DeviceIOS, Target: "https://apps.apple.com/app"},
+			{Device: model.DeviceAndroid, Target: "https://play.google.com/app"},
+			{Language: "de", Country: "AT", Target: "https://example.at"},
+			{From: "22:00", To: "06:00", Target: "https://example.com/night"},
+		}},
+	}
+	noon := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		now     time.Time
+		want    string
+	}{
+		{
+			name:    "iPhone",
+			headers: map[string]string{"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)"},
+			now:     noon,
+			want:    "https://apps.apple.com/app",
+		},
+		{
+			name:    "Android",
+			headers: map[string]string{"User-Agent": "Mozilla/5.0 (Linux; Android 14; Pixel 8) Mobile"},
+			now:     noon,
+			want:    "https://play.google.com/app",
+		},
+		{
+			name:    "Language and country",
+			headers: map[string]string{"Accept-Language": "de-AT,de;q=0.9", "X-Country-Code": "at"},
+			now:     noon,
+			want:    "https://example.at",
+		},
+		{
+			name:    "Language without country",
+			headers: map[string]string{"Accept-Language": "de-DE"},
+			now:     noon,
+			want:    "https://example.com",
+		},
+		{
+			name: "Night window across midnight",
+			now:  time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC),
+			want: "https://example.com/night",
+		},
+		{
+			name: "Fallback",
+			now:  noon,
+			want: "https://example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/id", nil)
+			for k, v := range tt.headers {
+				request.Header.Set(k, v)
+			}
+			target, _ := SelectTarget(info, request, tt.now)
+			assert.Equal(t, tt.want, target)
+		})
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    model.Rule
+		wantErr bool
+	}{
+		{name: "Valid", rule: model.Rule{Device: model.DeviceMobile, From: "08:00", Target: "https://m.example.com"}},
+		{name: "Relative target", rule: model.Rule{Target: "/path"}, wantErr: true},
+		{name: "Unknown device", rule: model.Rule{Device: "tv", Target: "https://example.com"}, wantErr: true},
+		{name: "Wrong time", rule: model.Rule{To: "25:00", Target: "https://example.com"}, wantErr: true},
+		{name: "Empty window", rule: model.Rule{From: "09:00", To: "09:00", Target: "https://example.com"}, wantErr: true},
+		{name: "Empty window from midnight", rule: model.Rule{To: "00:00", Target: "https://example.com"}, wantErr: true},
+		{name: "Window to midnight", rule: model.Rule{From: "22:00", To: "00:00", Target: "https://example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateOptions(model.LinkOptions{Rules: []model.Rule{tt.rule}})
+			if tt.wantErr {
+				assert.Equal(t, model.CodeInvalid, model.CodeOf(err))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,439 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/storage/db"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/hash/sha1hash"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * Общая логика для HTTP и gRPC обработчиков
+ */
+
+// Shorten сохраняет ссылку с настройками и возвращает короткий url
+func (s *Server) Shorten(ctx context.Context, link string, options model.LinkOptions) (string, error) {
+	return s.ShortenAlias(ctx, link, "", options)
+}
+
+// ShortenAlias сохраняет ссылку под ид alias, при пустом alias ид считается по адресу.
+// Если под alias уже сохранен этот же адрес, возвращается его короткий url и конфликт
+func (s *Server) ShortenAlias(ctx context.Context, link, alias string, options model.LinkOptions) (string, error) {
+	normalizeGroups(&options)
+	err := s.applyWorkspace(ctx, &options)
+	if err != nil {
+		return "", err
+	}
+	err = normalizeDomain(&options)
+	if err != nil {
+		return "", err
+	}
+	err = ValidateOptions(options)
+	if err != nil {
+		return "", err
+	}
+	link, err = s.tagLink(link, &options)
+	if err != nil {
+		return "", err
+	}
+	err = hashPassword(&options)
+	if err != nil {
+		return "", err
+	}
+
+	linkID := s.freeID(ctx, options.Domain, link)
+	if alias != "" {
+		err = ValidateAlias(alias)
+		if err != nil {
+			return "", err
+		}
+		alias = domains.Key(options.Domain, alias)
+		info, err := s.Storage.Lookup(alias)
+		if err == nil && info.OriginalURL == link {
+			return info.ShortURL, model.ErrConflict
+		}
+		if err == nil {
+			return "", errAliasTaken
+		}
+		linkID = alias
+	}
+	shortLink := domains.ShortURL(linkID)
+
+	info := model.LinkInfo{ID: linkID, ShortURL: shortLink, OriginalURL: link, UserID: auth.GetUserID(ctx), LinkOptions: options}
+	err = s.Storage.Set(info)
+	if alias != "" && errors.Is(err, model.ErrIDTaken) {
+		// alias успели занять параллельно
+		return "", errAliasTaken
+	}
+	if err == nil {
+		s.enqueueMetadata(linkID, link)
+		s.emitLink(model.EventLinkCreated, model.LinkInfo{ID: linkID, ShortURL: shortLink, OriginalURL: link}, "")
+	}
+	return shortLink, err
+}
+
+// freeID возвращает ключ ссылки на домене domain. Ид, посчитанный по адресу, может быть
+// занят ссылкой, у которой потом сменили адрес, тогда берется следующий хеш
+func (s *Server) freeID(ctx context.Context, domain, link string) string {
+	seed := link
+	for {
+		linkID := domains.Key(domain, sha1hash.Create(seed, 8))
+		info, err := s.Storage.Lookup(linkID)
+		if err != nil || info.OriginalURL == link {
+			return linkID
+		}
+		seed += "#"
+	}
+}
+
+// BatchShorten сохраняет пачку ссылок, принимает и отдает json. Элемент с ошибкой
+// получает статус invalid, остальные сохраняются. С atomic пачка сохраняется целиком
+// или никак: при ошибке в любом элементе она возвращается вместе с результатом, где
+// остальные элементы помечены пропущенными
+func (s *Server) BatchShorten(ctx context.Context, batch string, atomic bool) ([]byte, error) {
+	var items []api.BatchRequestItem
+	err := json.Unmarshal([]byte(batch), &items)
+	if err != nil {
+		return nil, model.NewError(model.CodeInvalid, "invalid batch", err)
+	}
+
+	results := make([]api.BatchResponseItem, len(items))
+	valid := make([]api.BatchRequestItem, 0, len(items))
+	ids := make(map[string]bool, len(items))
+	var invalidErr error
+	for i := range items {
+		err = s.prepareBatchItem(ctx, &items[i], ids)
+		if model.CodeOf(err) == model.CodeInvalid {
+			results[i] = api.BatchResponseItem{CorrelationID: items[i].CorrelationID, Status: model.BatchInvalid, Error: err.Error()}
+			if invalidErr == nil {
+				invalidErr = err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		valid = append(valid, items[i])
+	}
+
+	var saved []api.BatchResponseItem
+	var batchErr error
+	if atomic && invalidErr != nil {
+		for _, v := range valid {
+			saved = append(saved, api.BatchResponseItem{CorrelationID: v.CorrelationID, Status: model.BatchSkipped})
+		}
+		batchErr = invalidErr
+	} else if len(valid) > 0 {
+		saved, batchErr = s.saveBatch(ctx, valid, atomic)
+		if batchErr != nil && !isItemError(batchErr) {
+			return nil, batchErr
+		}
+	}
+
+	// Результаты хранилища идут в порядке valid, ими заполняются места без ошибок
+	next := 0
+	for i := range results {
+		if results[i].Status != "" {
+			continue
+		}
+		results[i] = saved[next]
+		if results[i].Status == model.BatchCreated {
+			link := valid[next].OriginalURL
+			s.enqueueMetadata(results[i].CorrelationID, link)
+			s.emitLink(model.EventLinkCreated, model.LinkInfo{ID: results[i].CorrelationID, ShortURL: results[i].ShortURL, OriginalURL: link}, "")
+		}
+		next++
+	}
+	resp, err := json.Marshal(results)
+	if err != nil {
+		return nil, err
+	}
+	return resp, batchErr
+}
+
+// saveBatch сохраняет подготовленные элементы, ошибка конфликта приходит вместе с результатом
+func (s *Server) saveBatch(ctx context.Context, items []api.BatchRequestItem, atomic bool) ([]api.BatchResponseItem, error) {
+	tagged, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	resp, batchErr := s.Storage.BatchSet(auth.GetUserID(ctx), tagged, atomic)
+	if batchErr != nil && !isItemError(batchErr) {
+		return nil, batchErr
+	}
+	var saved []api.BatchResponseItem
+	err = json.Unmarshal(resp, &saved)
+	if err != nil {
+		return nil, err
+	}
+	return saved, batchErr
+}
+
+// prepareBatchItem проверяет элемент пачки, применяет шаблон и хэширует пароль.
+// ids - уже встреченные в пачке ид
+func (s *Server) prepareBatchItem(ctx context.Context, item *api.BatchRequestItem, ids map[string]bool) error {
+	if item.CorrelationID == "" {
+		return model.NewError(model.CodeInvalid, "correlation_id is empty", nil)
+	}
+	if strings.Contains(item.CorrelationID, domains.Separator) {
+		return model.NewError(model.CodeInvalid, "correlation_id can't contain "+domains.Separator, nil)
+	}
+	if ids[item.CorrelationID] {
+		return model.NewError(model.CodeInvalid, "correlation_id is repeated", nil)
+	}
+	ids[item.CorrelationID] = true
+	if item.OriginalURL == "" {
+		return model.NewError(model.CodeInvalid, "original_url is empty", nil)
+	}
+
+	normalizeGroups(&item.LinkOptions)
+	err := s.applyWorkspace(ctx, &item.LinkOptions)
+	switch model.CodeOf(err) {
+	case model.CodeNotFound, model.CodeForbidden:
+		// Недоступное пространство - ошибка элемента, остальные элементы сохраняются
+		return model.NewError(model.CodeInvalid, err.Error(), nil)
+	}
+	if err != nil {
+		return err
+	}
+	err = normalizeDomain(&item.LinkOptions)
+	if err != nil {
+		return err
+	}
+	err = ValidateOptions(item.LinkOptions)
+	if err != nil {
+		return err
+	}
+	item.OriginalURL, err = s.tagLink(item.OriginalURL, &item.LinkOptions)
+	if err != nil {
+		return err
+	}
+	err = hashPassword(&item.LinkOptions)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Resolve возвращает ссылку по ид, отключенные ссылки считаются удаленными
+func (s *Server) Resolve(ctx context.Context, id string) (model.LinkInfo, error) {
+	info, err := s.Storage.Lookup(id)
+	if err != nil {
+		return info, err
+	}
+	if info.Disabled || info.IsExhausted() || info.IsExpired(time.Now()) {
+		return info, model.ErrDisabled
+	}
+	return info, nil
+}
+
+// ResolveVisit ищет ссылку id на домене domain для перехода по ней. Если ссылка
+// истекла или исчерпала лимит, а не удалена, отправляется link.expired
+func (s *Server) ResolveVisit(ctx context.Context, domain domains.Domain, id string) (model.LinkInfo, error) {
+	info, err := s.resolveHost(ctx, domain, id)
+	if errors.Is(err, model.ErrDisabled) && !info.Disabled {
+		s.emitExpired(info)
+	}
+	return info, err
+}
+
+// ConsumeVisit засчитывает переход атомарно, чтобы не превысить лимит ссылки
+func (s *Server) ConsumeVisit(info model.LinkInfo) (model.LinkInfo, error) {
+	err := s.Storage.Consume(info.ID)
+	if err != nil {
+		return info, err
+	}
+	info.Clicks++
+	return info, nil
+}
+
+// EmitVisit отправляет link.clicked с адресом перехода destination, а если переход
+// исчерпал лимит ссылки, то и link.expired
+func (s *Server) EmitVisit(info model.LinkInfo, destination string) {
+	s.emitLink(model.EventLinkClicked, info, destination)
+	if info.IsExhausted() {
+		s.emitExpired(info)
+	}
+}
+
+// ValidateOptions проверяет настройки ссылки
+func ValidateOptions(options model.LinkOptions) error {
+	if options.RedirectType != 0 && !IsRedirectType(options.RedirectType) {
+		return model.NewError(model.CodeInvalid, "unsupported redirect type", nil)
+	}
+	switch options.Passthrough {
+	case model.PassthroughNone, model.PassthroughKeep, model.PassthroughOverride, model.PassthroughAppend:
+	default:
+		return model.NewError(model.CodeInvalid, "unsupported passthrough mode", nil)
+	}
+	if options.MaxClicks < 0 {
+		return model.NewError(model.CodeInvalid, "max clicks can't be negative", nil)
+	}
+	if len(options.Password) > 72 {
+		return model.NewError(model.CodeInvalid, "password is longer than 72 bytes", nil)
+	}
+	err := validateRules(options.Rules)
+	if err != nil {
+		return err
+	}
+	err = validateTags(options.Tags)
+	if err != nil {
+		return err
+	}
+	err = validateFolder(options.Folder)
+	if err != nil {
+		return err
+	}
+	return validateVariants(options.Variants, options.Sticky)
+}
+
+// IsRedirectType сообщает, что статус подходит для редиректа по короткой ссылке
+func IsRedirectType(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// RedirectStatus возвращает статус редиректа ссылки или статус по умолчанию из конфига
+func RedirectStatus(info model.LinkInfo) int {
+	if IsRedirectType(info.RedirectType) {
+		return info.RedirectType
+	}
+	status, err := strconv.Atoi(confModule.Config.Final.RedirectType)
+	if err != nil || !IsRedirectType(status) {
+		return http.StatusTemporaryRedirect
+	}
+	return status
+}
+
+// isCacheable сообщает, что редирект ссылки всегда ведет на один адрес и его можно кэшировать
+func isCacheable(info model.LinkInfo) bool {
+	return len(info.Rules) == 0 && len(info.Variants) == 0 && info.ExpiresAt == nil
+}
+
+// Размер страницы ссылок пользователя
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// SearchUserURLs возвращает страницу ссылок пользователя из контекста,
+// а с query.Workspace - ссылок пространства, где он участвует
+func (s *Server) SearchUserURLs(ctx context.Context, query model.LinkQuery) (model.LinkPage, error) {
+	if query.Workspace != "" {
+		_, err := s.workspace(ctx, query.Workspace, model.RoleViewer)
+		if err != nil {
+			return model.LinkPage{}, err
+		}
+	}
+	query.Tag = strings.ToLower(strings.TrimSpace(query.Tag))
+	query.Folder = strings.TrimSpace(query.Folder)
+	if query.Limit <= 0 {
+		query.Limit = DefaultPageSize
+	}
+	if query.Limit > MaxPageSize {
+		query.Limit = MaxPageSize
+	}
+	return s.Storage.SearchUserLinks(auth.GetUserID(ctx), query)
+}
+
+// DeleteUserURLs помечает удаленными ссылки пользователя из контекста и ссылки
+// пространств, где он редактор или владелец. Остальные ид пропускаются
+func (s *Server) DeleteUserURLs(ctx context.Context, ids []string) error {
+	// Для вебхуков запоминаем, какие ссылки действительно удалятся
+	var deleted []model.LinkInfo
+	var own []string
+	userID := auth.GetUserID(ctx)
+	for _, id := range ids {
+		info, err := s.Storage.Lookup(id)
+		if errors.Is(err, model.ErrNotFound) || err == nil && info.Disabled {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if info.Workspace == "" {
+			if info.UserID == userID {
+				own = append(own, id)
+				deleted = append(deleted, info)
+			}
+			continue
+		}
+		_, err = s.workspace(ctx, info.Workspace, model.RoleEditor)
+		if model.CodeOf(err) == model.CodeNotFound || model.CodeOf(err) == model.CodeForbidden {
+			continue
+		}
+		if err == nil {
+			err = s.Storage.Disable(id)
+		}
+		if err != nil {
+			return err
+		}
+		deleted = append(deleted, info)
+	}
+
+	if len(own) > 0 {
+		err := s.Storage.DeleteUserLinks(userID, own)
+		if err != nil {
+			return err
+		}
+	}
+	for _, info := range deleted {
+		s.emitLink(model.EventLinkDeleted, info, "")
+	}
+	return nil
+}
+
+// Ping проверяет соединение с БД
+func Ping() error {
+	if db.GetDB() == nil {
+		err := db.Connect()
+		if err != nil {
+			return err
+		}
+		return db.Close()
+	}
+	return nil
+}
+
+// IsConflict сообщает, что ссылка уже сохранена
+func IsConflict(err error) bool {
+	return err != nil && model.CodeOf(err) == model.CodeConflict
+}
+
+// isItemError ошибка хранилища из-за элементов пачки, она приходит вместе с результатом
+func isItemError(err error) bool {
+	return IsConflict(err) || model.CodeOf(err) == model.CodeInvalid
+}
+
+// aliasPattern допустимый ид, задаваемый пользователем
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,64}$`)
+
+// reservedAliases ид, которые перекрыли бы пути сервиса
+var reservedAliases = map[string]bool{"api": true, "ping": true}
+
+var errAliasTaken = model.NewError(model.CodeConflict, "alias is taken", nil)
+
+// ValidateAlias проверяет ид, задаваемый пользователем
+func ValidateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return model.NewError(model.CodeInvalid, "alias must be 3-64 letters, digits, _ or -", nil)
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return model.NewError(model.CodeInvalid, "alias "+alias+" is reserved", nil)
+	}
+	return nil
+}
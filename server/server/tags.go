@@ -0,0 +1,72 @@
+package server
+
+import (
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxTags         = 20
+	maxTagLength    = 50
+	maxFolderLength = 100
+	// tagSeparators разделяют метки в одной строке, например в колонке csv
+	tagSeparators = ",;|"
+)
+
+// NormalizeTags приводит метки к нижнему регистру, убирает пустые и повторы
+func NormalizeTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// normalizeGroups приводит к общему виду метки и папку ссылки
+func normalizeGroups(options *model.LinkOptions) {
+	options.Tags = NormalizeTags(options.Tags)
+	options.Folder = strings.TrimSpace(options.Folder)
+}
+
+// SplitTags разбирает метки, записанные одной строкой через запятую, ; или |
+func SplitTags(line string) []string {
+	return NormalizeTags(strings.FieldsFunc(line, func(r rune) bool {
+		return strings.ContainsRune(tagSeparators, r)
+	}))
+}
+
+func validateTags(tags []string) error {
+	if len(tags) > maxTags {
+		return model.NewError(model.CodeInvalid, "too many tags", nil)
+	}
+	for _, tag := range tags {
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return model.NewError(model.CodeInvalid, "tag "+tag+" is too long", nil)
+		}
+		if strings.ContainsAny(tag, tagSeparators) {
+			return model.NewError(model.CodeInvalid, "tag "+tag+" contains a separator", nil)
+		}
+	}
+	return nil
+}
+
+func validateFolder(folder string) error {
+	if utf8.RuneCountInString(folder) > maxFolderLength {
+		return model.NewError(model.CodeInvalid, "folder is too long", nil)
+	}
+	if strings.IndexFunc(folder, unicode.IsControl) >= 0 {
+		return model.NewError(model.CodeInvalid, "folder contains control characters", nil)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSearchUserURLs(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Get(`/api/user/urls`, serve.HandleUserURLs)
+	router.Patch(`/api/links/{id}`, serve.HandlePatchLink)
+
+	owner := auth.WithUserID(context.Background(), "owner")
+	links := []struct {
+		url     string
+		options model.LinkOptions
+	}{
+		{url: "https://docs.example.com/start", options: model.LinkOptions{Tags: []string{"Docs"}, Folder: " work "}},
+		{url: "https://blog.example.org/release", options: model.LinkOptions{Tags: []string{"news"}}},
+		{url: "https://example.net/pricing", options: model.LinkOptions{Folder: "work"}},
+	}
+	for _, v := range links {
+		_, err := serve.Shorten(owner, v.url, v.options)
+		require.NoError(t, err)
+	}
+	_, err := serve.Shorten(auth.WithUserID(context.Background(), "other"), "https://docs.example.com/other", model.LinkOptions{})
+	require.NoError(t, err)
+	_, err = serve.Shorten(owner, "https://example.com", model.LinkOptions{Folder: "a\nb"})
+	assert.Equal(t, model.CodeInvalid, model.CodeOf(err))
+
+	// Заголовок страницы тоже участвует в поиске
+	s := serve.Storage
+	page, err := s.SearchUserLinks(auth.GetUserID(owner), model.LinkQuery{Q: "pricing"})
+	require.NoError(t, err)
+	require.Len(t, page.Links, 1)
+	require.NoError(t, s.SetMetadata(page.Links[0].ID, model.Metadata{Title: "Plans and Prices"}))
+
+	call := func(method, target, body string) *http.Response {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request.WithContext(owner))
+		return w.Result()
+	}
+	list := func(target string) ([]string, string, int) {
+		result := call(http.MethodGet, target, "")
+		defer result.Body.Close()
+		var urls []api.UserURL
+		_ = json.NewDecoder(result.Body).Decode(&urls)
+		var found []string
+		for _, v := range urls {
+			found = append(found, v.OriginalURL)
+		}
+		next := regexp.MustCompile(`^<(.+)>; rel="next"$`).FindStringSubmatch(result.Header.Get("Link"))
+		if next == nil {
+			return found, "", result.StatusCode
+		}
+		return found, next[1], result.StatusCode
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   []string
+		status int
+	}{
+		{name: "Tag", target: "/api/user/urls?tag=DOCS", want: []string{"https://docs.example.com/start"}, status: http.StatusOK},
+		{name: "Folder", target: "/api/user/urls?folder=work&sort=url", want: []string{"https://docs.example.com/start", "https://example.net/pricing"}, status: http.StatusOK},
+		{name: "Words", target: "/api/user/urls?q=example+RELEASE", want: []string{"https://blog.example.org/release"}, status: http.StatusOK},
+		{name: "Title", target: "/api/user/urls?q=prices", want: []string{"https://example.net/pricing"}, status: http.StatusOK},
+		{name: "Other user links", target: "/api/user/urls?q=other", status: http.StatusNoContent},
+		{name: "Bad sort", target: "/api/user/urls?sort=title", status: http.StatusBadRequest},
+		{name: "Bad limit", target: "/api/user/urls?limit=0", status: http.StatusBadRequest},
+		{name: "Bad cursor", target: "/api/user/urls?cursor=xyz", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, next, status := list(tt.target)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.want, found)
+			assert.Empty(t, next)
+		})
+	}
+
+	// Постраничный обход возвращает все ссылки по одному разу
+	var all []string
+	target := "/api/user/urls?sort=-url&limit=2"
+	for target != "" {
+		var found []string
+		found, target, _ = list(target)
+		all = append(all, found...)
+	}
+	assert.Equal(t, []string{"https://example.net/pricing", "https://docs.example.com/start", "https://blog.example.org/release"}, all)
+
+	// Метки и папку можно поменять
+	result := call(http.MethodPatch, "/api/links/"+page.Links[0].ID, `{"tags":["Sales"],"folder":""}`)
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	found, _, _ := list("/api/user/urls?tag=sales")
+	assert.Equal(t, []string{"https://example.net/pricing"}, found)
+	found, _, _ = list("/api/user/urls?folder=work")
+	assert.Equal(t, []string{"https://docs.example.com/start"}, found)
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ApplyTemplate дописывает к url параметры шаблона,
+// параметры, уже заданные в url, не перезаписываются
+func ApplyTemplate(link string, template model.Template) (string, error) {
+	target, err := url.Parse(link)
+	if err != nil {
+		return "", model.NewError(model.CodeInvalid, "invalid url", err)
+	}
+	values := target.Query()
+	for key, value := range template.Params {
+		if !values.Has(key) {
+			values.Set(key, value)
+		}
+	}
+	target.RawQuery = values.Encode()
+	return target.String(), nil
+}
+
+// tagLink применяет к url шаблон из настроек ссылки и запоминает исходный url
+func (s *Server) tagLink(link string, options *model.LinkOptions) (string, error) {
+	options.RawURL = ""
+	if options.Template == "" {
+		return link, nil
+	}
+
+	template, err := s.Storage.GetTemplate(options.Template)
+	if errors.Is(err, model.ErrNotFound) {
+		return "", model.NewError(model.CodeInvalid, "unknown template "+options.Template, nil)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	tagged, err := ApplyTemplate(link, template)
+	if err != nil {
+		return "", err
+	}
+	options.RawURL = link
+	return tagged, nil
+}
+
+func (s *Server) HandleTemplates(res http.ResponseWriter, req *http.Request) {
+
+	templates, err := s.Storage.Templates()
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can not get templates: "+err.Error())
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	if templates == nil {
+		templates = []model.Template{}
+	}
+
+	writeJSON(res, templates)
+}
+
+func (s *Server) HandleSetTemplate(res http.ResponseWriter, req *http.Request) {
+
+	contentBody, errBody := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if errBody != nil {
+		httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "can't read body", errBody))
+		return
+	}
+
+	var template model.Template
+	err := json.Unmarshal(contentBody, &template)
+	if err != nil {
+		httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "invalid json", err))
+		return
+	}
+	template.Name = chi.URLParam(req, "name")
+	for key := range template.Params {
+		if key == "" {
+			httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "empty parameter name", nil))
+			return
+		}
+	}
+
+	err = s.Storage.SetTemplate(template)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can not set template: "+err.Error())
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+
+	writeJSON(res, template)
+}
+
+func (s *Server) HandleDeleteTemplate(res http.ResponseWriter, req *http.Request) {
+
+	err := s.Storage.DeleteTemplate(chi.URLParam(req, "name"))
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+
+	httpResp.NoContent(res)
+}
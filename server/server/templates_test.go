@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestApplyTemplate(t *testing.T) {
+	template := model.Template{Name: "mail", Params: map[string]string{
+		"utm_source": "newsletter",
+		"utm_medium": "email",
+	}}
+
+	tests := []struct {
+		name string
+		link string
+		want string
+	}{
+		{
+			name: "Plain url",
+			link: "https://example.com/landing",
+			want: "https://example.com/landing?utm_medium=email&utm_source=newsletter",
+		},
+		{
+			name: "Url params are kept",
+			link: "https://example.com/landing?utm_source=site&id=1",
+			want: "https://example.com/landing?id=1&utm_medium=email&utm_source=site",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyTemplate(tt.link, template)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestShortenWithTemplate(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Put(`/api/templates/{name}`, serve.HandleSetTemplate)
+	router.Delete(`/api/templates/{name}`, serve.HandleDeleteTemplate)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/templates/spring",
+		strings.NewReader(`{"params":{"utm_campaign":"spring"}}`)))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	ctx := context.Background()
+	_, err := serve.Shorten(ctx, "https://example.com/a", model.LinkOptions{Template: "spring"})
+	require.NoError(t, err)
+
+	batch, err := json.Marshal([]api.BatchRequestItem{{
+		CorrelationID: "tagged",
+		OriginalURL:   "https://example.com/b",
+		LinkOptions:   model.LinkOptions{Template: "spring"},
+	}})
+	require.NoError(t, err)
+	_, err = serve.BatchShorten(ctx, string(batch), false)
+	require.NoError(t, err)
+
+	info, err := serve.Resolve(ctx, "tagged")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/b?utm_campaign=spring", info.OriginalURL)
+	assert.Equal(t, "https://example.com/b", info.RawURL)
+
+	_, err = serve.Shorten(ctx, "https://example.com/c", model.LinkOptions{Template: "unknown"})
+	assert.Equal(t, model.CodeInvalid, model.CodeOf(err))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/templates/spring", nil))
+	assert.Equal(t, http.StatusNoContent, w.Result().StatusCode)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/templates/spring", nil))
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+}
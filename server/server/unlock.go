@@ -0,0 +1,206 @@
+package server
+
+import (
+	"crypto/hmac"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const unlockCookiePrefix = "unlock_"
+const unlockTTL = 15 * time.Minute
+
+const maxUnlockAttempts = 5
+const unlockAttemptsWindow = 15 * time.Minute
+
+var unlockForm = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Protected link</title></head>
+<body>
+<form method="post" action="/{{.ID}}">
+<input type="hidden" name="next" value="{{.Next}}">
+<label>Password <input type="password" name="password" autofocus required></label>
+<button type="submit">Open</button>
+</form>
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+</body>
+</html>
+`))
+
+// hashPassword заменяет пароль из запроса на его bcrypt хэш
+func hashPassword(options *model.LinkOptions) error {
+	options.PasswordHash = ""
+	if options.Password == "" {
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(options.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return model.NewError(model.CodeInvalid, "can't hash password", err)
+	}
+	options.Password = ""
+	options.PasswordHash = string(hash)
+	return nil
+}
+
+// unlockCookieValue подписывает ключ ссылки, чтобы кука не подошла к ссылке с тем же ид на другом домене
+func unlockCookieValue(key string, expires time.Time) string {
+	expiry := strconv.FormatInt(expires.Unix(), 10)
+	return expiry + "." + auth.Sign(key+"|"+expiry)
+}
+
+// isUnlocked проверяет подписанную куку, выданную после ввода пароля к ссылке с ключом key
+func isUnlocked(req *http.Request, key string) bool {
+	_, id := domains.Split(key)
+	cookie, err := req.Cookie(unlockCookiePrefix + id)
+	if err != nil {
+		return false
+	}
+	expiry, signature, found := strings.Cut(cookie.Value, ".")
+	if !found {
+		return false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(auth.Sign(key+"|"+expiry)))
+}
+
+func renderUnlockForm(res http.ResponseWriter, status int, id, next, message string) {
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(status)
+	err := unlockForm.Execute(res, struct{ ID, Next, Error string }{ID: id, Next: next, Error: message})
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't render unlock form: "+err.Error())
+	}
+}
+
+// HandleUnlock проверяет пароль ссылки и выдает куку доступа
+func (s *Server) HandleUnlock(res http.ResponseWriter, req *http.Request) {
+
+	id := chi.URLParam(req, "query")
+	next := req.PostFormValue("next")
+	rest, isOwn := strings.CutPrefix(next, "/"+id)
+	if !isOwn || rest != "" && !strings.ContainsAny(rest[:1], "/?+") {
+		next = "/" + id
+	}
+
+	domain := domains.ByHost(req.Host)
+	linkKey := domains.Key(domain.Name, id)
+	// Попытки считаются по адресу клиента, общий счетчик ссылки позволил бы любому
+	// закрыть ссылку для владельца и посетителей
+	attemptKey := clientIP(req) + "|" + linkKey
+	if wait := s.attempts.blocked(attemptKey); wait > 0 {
+		res.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		renderUnlockForm(res, http.StatusTooManyRequests, id, next, "Too many attempts, try later")
+		return
+	}
+
+	saved, err := s.resolveHost(req.Context(), domain, id)
+	if err == nil && saved.PasswordHash == "" {
+		err = model.ErrNotFound
+	}
+	if err != nil {
+		httpResp.ErrorText(res, err)
+		return
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(saved.PasswordHash), []byte(req.PostFormValue("password")))
+	if err != nil {
+		logger.PrintLog(logger.WARN, "Wrong password for link "+id)
+		s.attempts.fail(attemptKey)
+		renderUnlockForm(res, http.StatusForbidden, id, next, "Wrong password")
+		return
+	}
+	s.attempts.reset(attemptKey)
+
+	// Ид уже есть в имени куки, путь "/" нужен, чтобы кука дошла и до предпросмотра /{id}+
+	expires := time.Now().Add(unlockTTL)
+	http.SetCookie(res, &http.Cookie{
+		Name:     unlockCookiePrefix + id,
+		Value:    unlockCookieValue(saved.ID, expires),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(res, req, next, http.StatusSeeOther)
+}
+
+// attemptLimiter считает неудачные попытки ввода пароля в скользящем окне. Раз в окно
+// из failures убираются ключи без попыток внутри окна, чтобы карта не росла без предела
+type attemptLimiter struct {
+	mx       sync.Mutex
+	limit    int
+	window   time.Duration
+	failures map[string][]time.Time
+	sweptAt  time.Time
+}
+
+func newAttemptLimiter(limit int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{limit: limit, window: window, failures: make(map[string][]time.Time)}
+}
+
+// recent оставляет попытки внутри окна, вызывается под блокировкой
+func (l *attemptLimiter) recent(key string, now time.Time) []time.Time {
+	var kept []time.Time
+	for _, v := range l.failures[key] {
+		if now.Sub(v) < l.window {
+			kept = append(kept, v)
+		}
+	}
+	if kept == nil {
+		delete(l.failures, key)
+	} else {
+		l.failures[key] = kept
+	}
+	return kept
+}
+
+// blocked возвращает, сколько ждать до следующей попытки
+func (l *attemptLimiter) blocked(key string) time.Duration {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	now := time.Now()
+	failures := l.recent(key, now)
+	if len(failures) < l.limit {
+		return 0
+	}
+	return l.window - now.Sub(failures[0])
+}
+
+func (l *attemptLimiter) fail(key string) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	now := time.Now()
+	l.sweep(now)
+	l.failures[key] = append(l.recent(key, now), now)
+}
+
+// sweep убирает устаревшие ключи не чаще раза в окно, вызывается под блокировкой
+func (l *attemptLimiter) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < l.window {
+		return
+	}
+	l.sweptAt = now
+	for key := range l.failures {
+		l.recent(key, now)
+	}
+}
+
+func (l *attemptLimiter) reset(key string) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	delete(l.failures, key)
+}
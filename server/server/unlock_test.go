@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleUnlock(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Get(`/{query}`, serve.HandleGET)
+	router.Post(`/{query}`, serve.HandleUnlock)
+
+	shortLink, err := serve.Shorten(context.Background(), "https://example.com/secret", model.LinkOptions{Password: "open"})
+	require.NoError(t, err)
+	id := shortLink[strings.LastIndex(shortLink, "/")+1:]
+
+	info, err := serve.Resolve(context.Background(), id)
+	require.NoError(t, err)
+	assert.Empty(t, info.Password)
+	assert.NotEqual(t, "open", info.PasswordHash)
+
+	unlock := func(password, ip string) *http.Response {
+		form := url.Values{"password": {password}, "next": {"/" + id}}
+		request := httptest.NewRequest(http.MethodPost, "/"+id, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+id, nil))
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Contains(t, w.Body.String(), "<form")
+	assert.Empty(t, w.Result().Header.Get("Location"))
+
+	result := unlock("wrong", "10.0.0.1")
+	assert.Equal(t, http.StatusForbidden, result.StatusCode)
+
+	result = unlock("open", "10.0.0.1")
+	require.Equal(t, http.StatusSeeOther, result.StatusCode)
+	cookies := result.Cookies()
+	require.Len(t, cookies, 1)
+
+	// Кука подходит и к странице предпросмотра /{id}+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	jar.SetCookies(&url.URL{Scheme: "http", Host: "example.com", Path: "/" + id}, cookies)
+	assert.Len(t, jar.Cookies(&url.URL{Scheme: "http", Host: "example.com", Path: "/" + id + "+"}), 1)
+
+	request := httptest.NewRequest(http.MethodGet, "/"+id, nil)
+	request.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Result().StatusCode)
+	assert.Equal(t, "https://example.com/secret", w.Result().Header.Get("Location"))
+	assert.Equal(t, "no-store", w.Result().Header.Get("Cache-Control"))
+
+	for i := 0; i < maxUnlockAttempts; i++ {
+		assert.Equal(t, http.StatusForbidden, unlock("wrong", "10.0.0.2").StatusCode)
+	}
+	result = unlock("open", "10.0.0.2")
+	assert.Equal(t, http.StatusTooManyRequests, result.StatusCode)
+	assert.NotEmpty(t, result.Header.Get("Retry-After"))
+
+	// Подставленный клиентом X-Real-IP не сбрасывает счетчик
+	form := url.Values{"password": {"open"}}
+	request = httptest.NewRequest(http.MethodPost, "/"+id, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("X-Real-IP", "10.0.0.3")
+	request.RemoteAddr = "10.0.0.2:1234"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusTooManyRequests, w.Result().StatusCode)
+
+	// Ошибки с других адресов не закрывают ссылку для владельца
+	for i := 0; i < 2*maxUnlockAttempts; i++ {
+		assert.Equal(t, http.StatusForbidden, unlock("wrong", "10.0.1."+strconv.Itoa(i)).StatusCode)
+	}
+	assert.Equal(t, http.StatusSeeOther, unlock("open", "10.0.2.1").StatusCode)
+}
+
+func TestAttemptLimiterSweep(t *testing.T) {
+	limiter := newAttemptLimiter(1, time.Millisecond)
+	for i := 0; i < 10; i++ {
+		limiter.fail(strconv.Itoa(i))
+	}
+	time.Sleep(2 * time.Millisecond)
+	limiter.fail("last")
+	assert.Len(t, limiter.failures, 1)
+}
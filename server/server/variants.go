@@ -0,0 +1,239 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"github.com/go-chi/chi/v5"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const variantCookiePrefix = "variant_"
+const variantCookieAge = 30 * 24 * time.Hour
+
+// redirectTarget выбирает, куда вести посетителя: подходящее правило,
+// вариант A/B теста или оригинальный url
+func (s *Server) redirectTarget(res http.ResponseWriter, req *http.Request, info model.LinkInfo) string {
+	target, isMatched := SelectTarget(info, req, time.Now())
+	if isMatched || len(info.Variants) == 0 {
+		return target
+	}
+
+	// HEAD не засчитывает переход, поэтому не пишет попадание в вариант и не закрепляет его
+	isClick := req.Method == http.MethodGet
+	variant := chooseVariant(res, req, info, isClick)
+	if !isClick {
+		return variant.Target
+	}
+	err := s.Storage.RecordVariant(info.ID, variant.Name)
+	if err != nil {
+		logger.PrintLog(logger.WARN, "Can't record variant: "+err.Error())
+	}
+	return variant.Target
+}
+
+// chooseVariant выбирает вариант, с remember закрепляет выбранный вариант в cookie
+func chooseVariant(res http.ResponseWriter, req *http.Request, info model.LinkInfo, remember bool) model.Variant {
+	total := 0
+	for _, v := range info.Variants {
+		total += v.Weight
+	}
+
+	switch info.Sticky {
+	case model.StickyCookie:
+		// Браузер видит только ид из пути, ключ ссылки другого домена содержит еще и домен
+		_, id := domains.Split(info.ID)
+		cookieName := variantCookiePrefix + id
+		if cookie, err := req.Cookie(cookieName); err == nil {
+			for _, v := range info.Variants {
+				if v.Name == cookie.Value && v.Weight > 0 {
+					return v
+				}
+			}
+		}
+		variant := variantAt(info.Variants, rand.Intn(total))
+		if !remember {
+			return variant
+		}
+		http.SetCookie(res, &http.Cookie{
+			Name:     cookieName,
+			Value:    variant.Name,
+			Path:     "/" + id,
+			MaxAge:   int(variantCookieAge.Seconds()),
+			HttpOnly: true,
+		})
+		return variant
+	case model.StickyIP:
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(info.ID + "|" + clientIP(req)))
+		return variantAt(info.Variants, int(hash.Sum32()%uint32(total)))
+	}
+	return variantAt(info.Variants, rand.Intn(total))
+}
+
+// variantAt возвращает вариант, на отрезок которого попадает point из [0, сумма весов)
+func variantAt(variants []model.Variant, point int) model.Variant {
+	for _, v := range variants {
+		if point < v.Weight {
+			return v
+		}
+		point -= v.Weight
+	}
+	return variants[len(variants)-1]
+}
+
+// clientIP адрес клиента. X-Real-IP может прислать сам клиент, поэтому заголовок берется
+// только от прокси из доверенной подсети
+func clientIP(req *http.Request) string {
+	peer, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		peer = req.RemoteAddr
+	}
+	realIP := net.ParseIP(req.Header.Get("X-Real-IP"))
+	if realIP == nil || !isTrustedPeer(peer) {
+		return peer
+	}
+	return realIP.String()
+}
+
+// isTrustedPeer проверяет, что соединение пришло из доверенной подсети
+func isTrustedPeer(peer string) bool {
+	subnet := confModule.Config.Final.TrustedSubnet
+	if subnet == "" {
+		return false
+	}
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(peer)
+	return ip != nil && ipNet.Contains(ip)
+}
+
+func validateVariants(variants []model.Variant, sticky string) error {
+	switch sticky {
+	case model.StickyNone, model.StickyCookie, model.StickyIP:
+	default:
+		return model.NewError(model.CodeInvalid, "unsupported sticky mode "+sticky, nil)
+	}
+	if len(variants) == 0 {
+		return nil
+	}
+
+	total := 0
+	names := make(map[string]bool)
+	for _, v := range variants {
+		if v.Name == "" || names[v.Name] {
+			return model.NewError(model.CodeInvalid, "variant names must be unique and not empty", nil)
+		}
+		names[v.Name] = true
+		target, err := url.ParseRequestURI(v.Target)
+		if err != nil || target.Scheme == "" {
+			return model.NewError(model.CodeInvalid, "variant target must be absolute url", err)
+		}
+		if v.Weight < 0 {
+			return model.NewError(model.CodeInvalid, "variant weight can't be negative", nil)
+		}
+		total += v.Weight
+	}
+	if total == 0 {
+		return model.NewError(model.CodeInvalid, "sum of variant weights must be positive", nil)
+	}
+	return nil
+}
+
+// ownLink возвращает ссылку текущего пользователя, чужие ссылки считаются ненайденными.
+// Ссылка пространства доступна его участникам, роль ниже required получает отказ
+func (s *Server) ownLink(req *http.Request, required string) (model.LinkInfo, error) {
+	info, err := s.Storage.Lookup(chi.URLParam(req, "id"))
+	if err != nil {
+		return info, err
+	}
+	if info.Disabled {
+		return model.LinkInfo{}, model.ErrNotFound
+	}
+	if info.Workspace != "" {
+		_, err = s.workspace(req.Context(), info.Workspace, required)
+		if model.CodeOf(err) == model.CodeNotFound {
+			return model.LinkInfo{}, model.ErrNotFound
+		}
+		return info, err
+	}
+	if info.UserID != auth.GetUserID(req.Context()) {
+		return model.LinkInfo{}, model.ErrNotFound
+	}
+	return info, nil
+}
+
+func (s *Server) variantsResponse(res http.ResponseWriter, req *http.Request, info model.LinkInfo) {
+	hits, err := s.Storage.VariantHits(info.ID)
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can not get variant hits: "+err.Error())
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+
+	resp := api.VariantsResponse{Sticky: info.Sticky, Variants: info.Variants, Hits: hits}
+	if resp.Variants == nil {
+		resp.Variants = []model.Variant{}
+	}
+	writeJSON(res, resp)
+}
+
+func (s *Server) HandleVariants(res http.ResponseWriter, req *http.Request) {
+
+	info, err := s.ownLink(req, model.RoleViewer)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	s.variantsResponse(res, req, info)
+}
+
+func (s *Server) HandleSetVariants(res http.ResponseWriter, req *http.Request) {
+
+	contentBody, errBody := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if errBody != nil {
+		httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "can't read body", errBody))
+		return
+	}
+
+	var apiData api.VariantsRequest
+	err := json.Unmarshal(contentBody, &apiData)
+	if err != nil {
+		httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "invalid json", err))
+		return
+	}
+	err = validateVariants(apiData.Variants, apiData.Sticky)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+
+	info, err := s.ownLink(req, model.RoleEditor)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	info.Variants = apiData.Variants
+	info.Sticky = apiData.Sticky
+
+	err = s.Storage.UpdateOptions(info.ID, info.LinkOptions)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	s.variantsResponse(res, req, info)
+}
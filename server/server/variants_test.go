@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVariantAt(t *testing.T) {
+	variants := []model.Variant{
+		{Name: "a", Weight: 1},
+		{Name: "off", Weight: 0},
+		{Name: "b", Weight: 3},
+	}
+	tests := []struct {
+		point int
+		want  string
+	}{
+		{point: 0, want: "a"},
+		{point: 1, want: "b"},
+		{point: 3, want: "b"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, variantAt(variants, tt.point).Name)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	confModule.Config.Final.TrustedSubnet = "192.168.0.0/24"
+	defer func() { confModule.Config.Final.TrustedSubnet = "" }()
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		want       string
+	}{
+		{name: "Without proxy", remoteAddr: "10.0.0.1:1234", want: "10.0.0.1"},
+		{name: "Spoofed header", remoteAddr: "10.0.0.1:1234", realIP: "10.0.0.9", want: "10.0.0.1"},
+		{name: "Trusted proxy", remoteAddr: "192.168.0.5:1234", realIP: "10.0.0.9", want: "10.0.0.9"},
+		{name: "Trusted proxy without header", remoteAddr: "192.168.0.5:1234", want: "192.168.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/abtest", nil)
+			request.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				request.Header.Set("X-Real-IP", tt.realIP)
+			}
+			assert.Equal(t, tt.want, clientIP(request))
+		})
+	}
+}
+
+func TestChooseVariant(t *testing.T) {
+	info := model.LinkInfo{ID: "abtest", LinkOptions: model.LinkOptions{Variants: []model.Variant{
+		{Name: "a", Target: "https://a.example", Weight: 1},
+		{Name: "b", Target: "https://b.example", Weight: 1},
+	}}}
+
+	t.Run("Sticky ip", func(t *testing.T) {
+		info.Sticky = model.StickyIP
+		request := httptest.NewRequest(http.MethodGet, "/abtest", nil)
+		request.Header.Set("X-Real-IP", "10.0.0.7")
+		first := chooseVariant(httptest.NewRecorder(), request, info, true)
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, first, chooseVariant(httptest.NewRecorder(), request, info, true))
+		}
+	})
+
+	t.Run("Sticky cookie", func(t *testing.T) {
+		info.Sticky = model.StickyCookie
+		w := httptest.NewRecorder()
+		first := chooseVariant(w, httptest.NewRequest(http.MethodGet, "/abtest", nil), info, true)
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, first.Name, cookies[0].Value)
+
+		request := httptest.NewRequest(http.MethodGet, "/abtest", nil)
+		request.AddCookie(cookies[0])
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, first, chooseVariant(httptest.NewRecorder(), request, info, true))
+		}
+	})
+
+	t.Run("Sticky cookie on other domain", func(t *testing.T) {
+		info := info
+		info.ID = domains.Key("go.example", "abtest")
+		info.Sticky = model.StickyCookie
+		w := httptest.NewRecorder()
+		first := chooseVariant(w, httptest.NewRequest(http.MethodGet, "/abtest", nil), info, true)
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, variantCookiePrefix+"abtest", cookies[0].Name)
+		assert.Equal(t, "/abtest", cookies[0].Path)
+
+		request := httptest.NewRequest(http.MethodGet, "/abtest", nil)
+		request.AddCookie(cookies[0])
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, first, chooseVariant(httptest.NewRecorder(), request, info, true))
+		}
+	})
+}
+
+func TestHandleSetVariants(t *testing.T) {
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Get(`/api/user/urls/{id}/variants`, serve.HandleVariants)
+	router.Put(`/api/user/urls/{id}/variants`, serve.HandleSetVariants)
+	router.Get(`/{query}`, serve.HandleGET)
+	router.Head(`/{query}`, serve.HandleGET)
+
+	owner := auth.WithUserID(context.Background(), "owner")
+	shortLink, err := serve.Shorten(owner, "https://example.com/ab", model.LinkOptions{})
+	require.NoError(t, err)
+	id := shortLink[strings.LastIndex(shortLink, "/")+1:]
+
+	tests := []struct {
+		name   string
+		userID string
+		body   string
+		status int
+	}{
+		{name: "Other user", userID: "other", body: `{"variants":[{"name":"a","target":"https://a.example","weight":1}]}`, status: http.StatusNotFound},
+		{name: "Zero weights", userID: "owner", body: `{"variants":[{"name":"a","target":"https://a.example","weight":0}]}`, status: http.StatusBadRequest},
+		{name: "Owner", userID: "owner", body: `{"sticky":"cookie","variants":[{"name":"a","target":"https://a.example","weight":1}]}`, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPut, "/api/user/urls/"+id+"/variants", strings.NewReader(tt.body))
+			request = request.WithContext(auth.WithUserID(request.Context(), tt.userID))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+			assert.Equal(t, tt.status, w.Result().StatusCode)
+		})
+	}
+
+	// HEAD не засчитывает переход и не закрепляет вариант
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/"+id, nil))
+	assert.Equal(t, "https://a.example", w.Result().Header.Get("Location"))
+	assert.Empty(t, w.Result().Cookies())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+id, nil))
+	assert.Equal(t, "https://a.example", w.Result().Header.Get("Location"))
+	assert.Len(t, w.Result().Cookies(), 1)
+
+	request := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+id+"/variants", nil)
+	request = request.WithContext(owner)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	var resp api.VariantsResponse
+	require.NoError(t, json.NewDecoder(w.Result().Body).Decode(&resp))
+	assert.Equal(t, model.StickyCookie, resp.Sticky)
+	assert.Equal(t, map[string]int{"a": 1}, resp.Hits)
+}
@@ -0,0 +1,537 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/hash/sha1hash"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/logger"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/rand"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	webhookMaxAttempts  = 8
+	webhookBaseBackoff  = 10 * time.Second
+	webhookMaxBackoff   = time.Hour
+	webhookPollInterval = time.Second
+	WebhookTimeout      = 10 * time.Second
+	// webhookDeliveredTTL сколько хранятся доставленные доставки и ид событий EmitOnce,
+	// чистятся раз в webhookPruneInterval
+	webhookDeliveredTTL  = 7 * 24 * time.Hour
+	webhookPruneInterval = time.Hour
+)
+
+// Заголовки запроса вебхука. Подпись - hex(HMAC-SHA256(secret, timestamp + "." + body))
+const (
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookDeliveryHeader  = "X-Webhook-Delivery"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+var webhookEvents = []string{model.EventLinkCreated, model.EventLinkDeleted, model.EventLinkExpired, model.EventLinkClicked}
+
+// Dispatcher сохраняет события в очередь доставок и отправляет их подписчикам
+// с повторами. Подписки кешируются, после изменения их нужно перечитать Reload.
+// Событие записывается в хранилище до возврата из Emit, а отправка идет в фоне:
+// у каждой подписки свой обработчик, чтобы медленный подписчик не задерживал остальных
+type Dispatcher struct {
+	storage  model.Storable
+	client   *http.Client
+	mx       sync.RWMutex
+	webhooks []model.Webhook
+	// emitted когда события EmitOnce были поставлены в очередь, старше webhookDeliveredTTL удаляются
+	emitted map[string]time.Time
+	// busy подписки, доставки которых сейчас отправляются
+	busy map[string]bool
+	wake chan struct{}
+	// prunedAt когда последний раз чистились доставленные доставки
+	prunedAt time.Time
+}
+
+func NewDispatcher(storage model.Storable, client *http.Client) (*Dispatcher, error) {
+	d := &Dispatcher{storage: storage, client: client, emitted: make(map[string]time.Time), busy: make(map[string]bool), wake: make(chan struct{}, 1)}
+	return d, d.Reload()
+}
+
+// Reload перечитывает подписки из хранилища
+func (d *Dispatcher) Reload() error {
+	webhooks, err := d.storage.Webhooks()
+	if err != nil {
+		return err
+	}
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.webhooks = webhooks
+	return nil
+}
+
+func (d *Dispatcher) webhook(name string) (model.Webhook, bool) {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+	for _, v := range d.webhooks {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return model.Webhook{}, false
+}
+
+// Emit ставит событие в очередь доставки каждой подписке, которая его ждет
+func (d *Dispatcher) Emit(event string, link api.WebhookLink) {
+	d.emit(rand.RandStringBytes(16), event, link, nil)
+}
+
+// EmitOnce ставит событие в очередь, только если событие с ид eventID еще не ставилось
+func (d *Dispatcher) EmitOnce(eventID, event string, link api.WebhookLink) {
+	now := time.Now()
+	d.mx.Lock()
+	_, seen := d.emitted[eventID]
+	d.emitted[eventID] = now
+	d.mx.Unlock()
+	if seen {
+		return
+	}
+
+	// После перезапуска о событии помнят только сохраненные доставки
+	deliveries, err := d.storage.Deliveries("")
+	if err != nil {
+		d.mx.Lock()
+		delete(d.emitted, eventID)
+		d.mx.Unlock()
+		logger.PrintLog(logger.ERROR, "Can't queue webhook delivery: "+err.Error())
+		return
+	}
+	saved := make(map[string]bool, len(deliveries))
+	for _, v := range deliveries {
+		saved[v.ID] = true
+	}
+	d.emit(eventID, event, link, saved)
+}
+
+func deliveryID(eventID, webhook string) string {
+	return sha1hash.Create(eventID+"|"+webhook, 20)
+}
+
+// emit записывает доставки события в хранилище, пропуская уже сохраненные из saved
+func (d *Dispatcher) emit(eventID, event string, link api.WebhookLink, saved map[string]bool) {
+	now := time.Now()
+	payload, err := json.Marshal(api.WebhookEvent{ID: eventID, Event: event, CreatedAt: now, Link: link})
+	if err != nil {
+		logger.PrintLog(logger.ERROR, "Can't encode webhook event: "+err.Error())
+		return
+	}
+
+	d.mx.RLock()
+	webhooks := d.webhooks
+	d.mx.RUnlock()
+
+	isQueued := false
+	for _, webhook := range webhooks {
+		id := deliveryID(eventID, webhook.Name)
+		if !webhook.Wants(event) || saved[id] {
+			continue
+		}
+		err = d.storage.SaveDelivery(model.Delivery{
+			ID:        id,
+			Webhook:   webhook.Name,
+			Event:     event,
+			Payload:   payload,
+			Status:    model.DeliveryPending,
+			NextAt:    &now,
+			CreatedAt: &now,
+		})
+		if err != nil {
+			logger.PrintLog(logger.ERROR, "Can't queue webhook delivery: "+err.Error())
+			continue
+		}
+		isQueued = true
+	}
+	if isQueued {
+		d.notify()
+	}
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run отправляет доставки, пока не отменен ctx. Новые события будят отправку сразу,
+// повторы подхватываются раз в webhookPollInterval
+func (d *Dispatcher) Run(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(webhookPollInterval)
+		defer ticker.Stop()
+		for {
+			_, err := d.startDue(ctx, time.Now())
+			if err != nil {
+				logger.PrintLog(logger.ERROR, "Can't deliver webhooks: "+err.Error())
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-d.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// DeliverDue отправляет доставки, у которых подошло время попытки, и ждет окончания
+// отправки. Заодно раз в webhookPruneInterval удаляет старые доставленные доставки
+func (d *Dispatcher) DeliverDue(ctx context.Context, now time.Time) error {
+	wg, err := d.startDue(ctx, now)
+	wg.Wait()
+	return err
+}
+
+// startDue запускает по обработчику на каждую подписку с доставками, у которых подошло
+// время попытки. Подписки, чьи прошлые доставки еще отправляются, ждут следующего раза
+func (d *Dispatcher) startDue(ctx context.Context, now time.Time) (*sync.WaitGroup, error) {
+	var wg sync.WaitGroup
+	if now.Sub(d.prunedAt) >= webhookPruneInterval {
+		err := d.prune(now.Add(-webhookDeliveredTTL))
+		if err != nil {
+			return &wg, err
+		}
+		d.prunedAt = now
+	}
+
+	pending, err := d.storage.Deliveries(model.DeliveryPending)
+	if err != nil {
+		return &wg, err
+	}
+	due := make(map[string][]model.Delivery)
+	for _, delivery := range pending {
+		if delivery.NextAt != nil && now.Before(*delivery.NextAt) {
+			continue
+		}
+		due[delivery.Webhook] = append(due[delivery.Webhook], delivery)
+	}
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	for webhook, deliveries := range due {
+		if d.busy[webhook] {
+			continue
+		}
+		d.busy[webhook] = true
+		wg.Add(1)
+		go func(webhook string, deliveries []model.Delivery) {
+			defer wg.Done()
+			d.deliverAll(ctx, deliveries, now)
+			d.mx.Lock()
+			delete(d.busy, webhook)
+			d.mx.Unlock()
+		}(webhook, deliveries)
+	}
+	return &wg, nil
+}
+
+// deliverAll по очереди отправляет доставки одной подписки
+func (d *Dispatcher) deliverAll(ctx context.Context, deliveries []model.Delivery, now time.Time) {
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		err := d.storage.SaveDelivery(d.deliver(ctx, delivery, now))
+		if err != nil {
+			logger.PrintLog(logger.ERROR, "Can't save webhook delivery: "+err.Error())
+			return
+		}
+	}
+}
+
+// prune удаляет доставленные доставки и ид событий EmitOnce старше before
+func (d *Dispatcher) prune(before time.Time) error {
+	d.mx.Lock()
+	for id, at := range d.emitted {
+		if at.Before(before) {
+			delete(d.emitted, id)
+		}
+	}
+	d.mx.Unlock()
+	return d.storage.PruneDeliveries(before)
+}
+
+// deliver делает одну попытку и возвращает доставку с ее результатом
+func (d *Dispatcher) deliver(ctx context.Context, delivery model.Delivery, now time.Time) model.Delivery {
+	delivery.Attempts++
+	delivery.LastStatus = 0
+	delivery.LastError = ""
+
+	webhook, ok := d.webhook(delivery.Webhook)
+	if !ok {
+		delivery.Status = model.DeliveryDead
+		delivery.NextAt = nil
+		delivery.LastError = "webhook is deleted"
+		return delivery
+	}
+
+	status, err := d.send(ctx, webhook, delivery, now)
+	if err == nil && status >= 200 && status <= 299 {
+		delivery.Status = model.DeliveryDelivered
+		delivery.LastStatus = status
+		delivery.NextAt = nil
+		delivery.DeliveredAt = &now
+		return delivery
+	}
+
+	delivery.LastStatus = status
+	delivery.LastError = http.StatusText(status)
+	if err != nil {
+		delivery.LastError = err.Error()
+	}
+	if delivery.Attempts >= webhookMaxAttempts {
+		logger.PrintLog(logger.WARN, "Webhook delivery "+delivery.ID+" is dead: "+delivery.LastError)
+		delivery.Status = model.DeliveryDead
+		delivery.NextAt = nil
+		return delivery
+	}
+	next := now.Add(webhookBackoff(delivery.Attempts))
+	delivery.NextAt = &next
+	return delivery
+}
+
+// webhookBackoff пауза перед следующей попыткой, удваивается с каждой неудачей
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookMaxBackoff {
+		backoff = webhookMaxBackoff
+	}
+	return backoff
+}
+
+func (d *Dispatcher) send(ctx context.Context, webhook model.Webhook, delivery model.Delivery, now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, WebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, delivery.Event)
+	req.Header.Set(webhookDeliveryHeader, delivery.ID)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	if webhook.Secret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+SignWebhook(webhook.Secret, timestamp, delivery.Payload))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.CopyN(io.Discard, resp.Body, 4<<10)
+	return resp.StatusCode, nil
+}
+
+// SignWebhook возвращает подпись тела запроса вебхука
+func SignWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Retry возвращает недоставленную доставку в очередь с новым счетчиком попыток
+func (d *Dispatcher) Retry(id string) (model.Delivery, error) {
+	dead, err := d.storage.Deliveries(model.DeliveryDead)
+	if err != nil {
+		return model.Delivery{}, err
+	}
+	for _, delivery := range dead {
+		if delivery.ID != id {
+			continue
+		}
+		now := time.Now()
+		delivery.Status = model.DeliveryPending
+		delivery.Attempts = 0
+		delivery.NextAt = &now
+		err = d.storage.SaveDelivery(delivery)
+		if err != nil {
+			return delivery, err
+		}
+		d.notify()
+		return delivery, nil
+	}
+	return model.Delivery{}, model.ErrNotFound
+}
+
+// emitLink отправляет событие о ссылке, если вебхуки включены
+func (s *Server) emitLink(event string, info model.LinkInfo, destination string) {
+	if s.Webhooks == nil {
+		return
+	}
+	s.Webhooks.Emit(event, webhookLink(info, destination))
+}
+
+// emitExpired отправляет link.expired один раз на каждое окончание срока или лимита ссылки
+func (s *Server) emitExpired(info model.LinkInfo) {
+	if s.Webhooks == nil {
+		return
+	}
+	key := info.ID + "|" + strconv.Itoa(info.MaxClicks)
+	if info.ExpiresAt != nil {
+		key += "|" + info.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+	s.Webhooks.EmitOnce(model.EventLinkExpired+"|"+key, model.EventLinkExpired, webhookLink(info, ""))
+}
+
+func webhookLink(info model.LinkInfo, destination string) api.WebhookLink {
+	shortURL := info.ShortURL
+	if shortURL == "" {
+		shortURL = domains.ShortURL(info.ID)
+	}
+	return api.WebhookLink{ID: info.ID, ShortURL: shortURL, OriginalURL: info.OriginalURL, Destination: destination}
+}
+
+// validateWebhook проверяет адрес и события подписки
+func validateWebhook(webhook model.Webhook) error {
+	target, err := url.Parse(webhook.URL)
+	if err != nil || target.Host == "" || target.Scheme != "http" && target.Scheme != "https" {
+		return model.NewError(model.CodeInvalid, "webhook url must be an absolute http(s) url", err)
+	}
+	for _, event := range webhook.Events {
+		isKnown := false
+		for _, v := range webhookEvents {
+			isKnown = isKnown || v == event
+		}
+		if !isKnown {
+			return model.NewError(model.CodeInvalid, "unknown event "+event, nil)
+		}
+	}
+	return nil
+}
+
+// webhooksDisabled отвечает на запросы к вебхукам, когда они выключены
+func (s *Server) webhooksDisabled(res http.ResponseWriter) bool {
+	if s.Webhooks != nil {
+		return false
+	}
+	httpResp.ProblemJSON(res, model.NewError(model.CodeUnavailable, "webhooks are disabled", nil))
+	return true
+}
+
+func (s *Server) HandleWebhooks(res http.ResponseWriter, req *http.Request) {
+
+	if s.webhooksDisabled(res) {
+		return
+	}
+	webhooks, err := s.Storage.Webhooks()
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	// Секрет не отдается, чтобы его нельзя было прочитать через api
+	resp := make([]model.Webhook, 0, len(webhooks))
+	for _, v := range webhooks {
+		v.Secret = ""
+		resp = append(resp, v)
+	}
+	writeJSON(res, resp)
+}
+
+func (s *Server) HandleSetWebhook(res http.ResponseWriter, req *http.Request) {
+
+	if s.webhooksDisabled(res) {
+		return
+	}
+	var webhook model.Webhook
+	err := readJSON(req, &webhook)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	webhook.Name = chi.URLParam(req, "name")
+	err = validateWebhook(webhook)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+
+	err = s.Storage.SetWebhook(webhook)
+	if err == nil {
+		err = s.Webhooks.Reload()
+	}
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	webhook.Secret = ""
+	writeJSON(res, webhook)
+}
+
+func (s *Server) HandleDeleteWebhook(res http.ResponseWriter, req *http.Request) {
+
+	if s.webhooksDisabled(res) {
+		return
+	}
+	err := s.Storage.DeleteWebhook(chi.URLParam(req, "name"))
+	if err == nil {
+		err = s.Webhooks.Reload()
+	}
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	httpResp.NoContent(res)
+}
+
+// HandleDeliveries отдает доставки, status=dead - список недоставленных
+func (s *Server) HandleDeliveries(res http.ResponseWriter, req *http.Request) {
+
+	if s.webhooksDisabled(res) {
+		return
+	}
+	status := req.URL.Query().Get("status")
+	switch status {
+	case "", model.DeliveryPending, model.DeliveryDelivered, model.DeliveryDead:
+	default:
+		httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "unknown delivery status", nil))
+		return
+	}
+	deliveries, err := s.Storage.Deliveries(status)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []model.Delivery{}
+	}
+	writeJSON(res, deliveries)
+}
+
+func (s *Server) HandleRetryDelivery(res http.ResponseWriter, req *http.Request) {
+
+	if s.webhooksDisabled(res) {
+		return
+	}
+	delivery, err := s.Webhooks.Retry(chi.URLParam(req, "id"))
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	writeJSON(res, delivery)
+}
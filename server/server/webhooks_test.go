@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	var mx sync.Mutex
+	var events []api.WebhookEvent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		signature := SignWebhook("secret", r.Header.Get(webhookTimestampHeader), body)
+		if r.Header.Get(webhookSignatureHeader) != "sha256="+signature {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event api.WebhookEvent
+		_ = json.Unmarshal(body, &event)
+		assert.Equal(t, event.Event, r.Header.Get(webhookEventHeader))
+		mx.Lock()
+		events = append(events, event)
+		mx.Unlock()
+	}))
+	defer receiver.Close()
+
+	storage := &memory.MemStorage{}
+	serve := NewServ(confModule.Config, storage)
+	var err error
+	serve.Webhooks, err = NewDispatcher(storage, receiver.Client())
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Get(`/{query}`, serve.HandleGET)
+	router.Put(`/api/internal/webhooks/{name}`, serve.HandleSetWebhook)
+	router.Get(`/api/internal/webhooks`, serve.HandleWebhooks)
+	router.Get(`/api/internal/deliveries`, serve.HandleDeliveries)
+	router.Post(`/api/internal/deliveries/{id}/retry`, serve.HandleRetryDelivery)
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	subscriptions := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "relative", body: `{"url":"/hook"}`, status: http.StatusBadRequest},
+		{name: "unknown", body: `{"url":"` + receiver.URL + `","events":["link.renamed"]}`, status: http.StatusBadRequest},
+		{name: "all", body: `{"url":"` + receiver.URL + `/all","secret":"secret"}`, status: http.StatusOK},
+		{name: "down", body: `{"url":"` + receiver.URL + `/down","events":["link.created"]}`, status: http.StatusOK},
+	}
+	for _, tt := range subscriptions {
+		assert.Equal(t, tt.status, call(http.MethodPut, "/api/internal/webhooks/"+tt.name, tt.body).Code, tt.name)
+	}
+	assert.NotContains(t, call(http.MethodGet, "/api/internal/webhooks", "").Body.String(), `"secret"`)
+
+	owner := auth.WithUserID(context.Background(), "owner")
+	shortLink, err := serve.Shorten(owner, "https://example.com/once", model.LinkOptions{MaxClicks: 1})
+	require.NoError(t, err)
+	id := shortLink[strings.LastIndex(shortLink, "/")+1:]
+	// Второй переход уже не проходит, но link.expired отправляется один раз
+	assert.Equal(t, http.StatusTemporaryRedirect, call(http.MethodGet, "/"+id, "").Code)
+	assert.NotEqual(t, http.StatusTemporaryRedirect, call(http.MethodGet, "/"+id, "").Code)
+	require.NoError(t, serve.DeleteUserURLs(owner, []string{id}))
+	require.NoError(t, serve.DeleteUserURLs(auth.WithUserID(context.Background(), "other"), []string{id}))
+	// События записываются в хранилище до ответа, а отправляются в фоне
+	saved, err := storage.Deliveries(model.DeliveryPending)
+	require.NoError(t, err)
+	assert.Len(t, saved, 5)
+
+	now := time.Now()
+	require.NoError(t, serve.Webhooks.DeliverDue(context.Background(), now))
+	var names []string
+	for _, v := range events {
+		assert.Equal(t, id, v.Link.ID)
+		names = append(names, v.Event)
+	}
+	assert.Equal(t, []string{model.EventLinkCreated, model.EventLinkClicked, model.EventLinkExpired, model.EventLinkDeleted}, names)
+	assert.Equal(t, "https://example.com/once", events[1].Link.Destination)
+
+	// Упавший подписчик получает повторы с растущей паузой, потом доставка уходит в недоставленные
+	for attempt := 1; attempt < webhookMaxAttempts; attempt++ {
+		var pending []model.Delivery
+		require.NoError(t, json.Unmarshal(call(http.MethodGet, "/api/internal/deliveries?status=pending", "").Body.Bytes(), &pending))
+		require.Len(t, pending, 1)
+		assert.Equal(t, attempt, pending[0].Attempts)
+		assert.WithinDuration(t, now.Add(webhookBackoff(attempt)), *pending[0].NextAt, 0)
+
+		require.NoError(t, serve.Webhooks.DeliverDue(context.Background(), pending[0].NextAt.Add(-time.Second)))
+		now = *pending[0].NextAt
+		require.NoError(t, serve.Webhooks.DeliverDue(context.Background(), now))
+	}
+	assert.Equal(t, 21*time.Minute+20*time.Second, webhookBackoff(8))
+	assert.Equal(t, time.Hour, webhookBackoff(20))
+
+	var dead []model.Delivery
+	require.NoError(t, json.Unmarshal(call(http.MethodGet, "/api/internal/deliveries?status=dead", "").Body.Bytes(), &dead))
+	require.Len(t, dead, 1)
+	assert.Equal(t, "down", dead[0].Webhook)
+	assert.Equal(t, http.StatusInternalServerError, dead[0].LastStatus)
+
+	assert.Equal(t, http.StatusNotFound, call(http.MethodPost, "/api/internal/deliveries/unknown/retry", "").Code)
+	result := call(http.MethodPost, "/api/internal/deliveries/"+dead[0].ID+"/retry", "")
+	require.Equal(t, http.StatusOK, result.Code)
+	assert.Contains(t, result.Body.String(), `"status":"pending"`)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodGet, "/api/internal/deliveries?status=lost", "").Code)
+
+	// Доставленные доставки удаляются через webhookDeliveredTTL, остальные остаются
+	require.NoError(t, serve.Webhooks.DeliverDue(context.Background(), now.Add(webhookDeliveredTTL+webhookPruneInterval)))
+	saved, err = storage.Deliveries("")
+	require.NoError(t, err)
+	require.Len(t, saved, 1)
+	assert.Equal(t, "down", saved[0].Webhook)
+}
+
+func TestWebhooksSlowSubscriber(t *testing.T) {
+	release := make(chan struct{})
+	fast := make(chan struct{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+			return
+		}
+		fast <- struct{}{}
+	}))
+	defer receiver.Close()
+	defer close(release)
+
+	storage := &memory.MemStorage{}
+	require.NoError(t, storage.SetWebhook(model.Webhook{Name: "slow", URL: receiver.URL + "/slow"}))
+	require.NoError(t, storage.SetWebhook(model.Webhook{Name: "fast", URL: receiver.URL + "/fast"}))
+	dispatcher, err := NewDispatcher(storage, receiver.Client())
+	require.NoError(t, err)
+
+	dispatcher.Emit(model.EventLinkCreated, api.WebhookLink{ID: "slow"})
+	dispatcher.EmitOnce("expired|slow", model.EventLinkExpired, api.WebhookLink{ID: "slow"})
+	dispatcher.EmitOnce("expired|slow", model.EventLinkExpired, api.WebhookLink{ID: "slow"})
+	saved, err := storage.Deliveries("")
+	require.NoError(t, err)
+	assert.Len(t, saved, 4)
+
+	// Пока медленный подписчик не ответил, быстрый получает свои доставки
+	wg, err := dispatcher.startDue(context.Background(), time.Now())
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-fast:
+		case <-time.After(WebhookTimeout / 2):
+			t.Fatal("fast subscriber waits for slow one")
+		}
+	}
+	release <- struct{}{}
+	release <- struct{}{}
+	wg.Wait()
+
+	// Ид событий EmitOnce забываются вместе с доставленными доставками
+	require.NoError(t, dispatcher.prune(time.Now().Add(time.Second)))
+	assert.Empty(t, dispatcher.emitted)
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/util/rand"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	"github.com/MaximMNsk/go-url-shortener/server/domains"
+	httpResp "github.com/MaximMNsk/go-url-shortener/server/http"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const workspaceIDLen = 12
+
+var errLastOwner = model.NewError(model.CodeConflict, "workspace must keep an owner", nil)
+
+// workspace возвращает пространство id, если пользователь из контекста участвует в нем с ролью
+// не ниже required. Для остальных пространство не найдено, участнику с младшей ролью отказано
+func (s *Server) workspace(ctx context.Context, id, required string) (model.Workspace, error) {
+	workspace, err := s.Storage.GetWorkspace(id)
+	if err != nil {
+		return model.Workspace{}, err
+	}
+	role := workspace.Role(auth.GetUserID(ctx))
+	if role == "" {
+		return model.Workspace{}, model.ErrWorkspaceNotFound
+	}
+	if !model.HasRole(role, required) {
+		return model.Workspace{}, model.NewError(model.CodeForbidden, "workspace role "+required+" is required", nil)
+	}
+	return workspace, nil
+}
+
+// applyWorkspace проверяет, что пользователь может добавить ссылку в пространство из настроек,
+// и дополняет настройки значениями пространства. Квоту хранилище проверяет при сохранении
+func (s *Server) applyWorkspace(ctx context.Context, options *model.LinkOptions) error {
+	if options.Workspace == "" {
+		return nil
+	}
+	workspace, err := s.workspace(ctx, options.Workspace, model.RoleEditor)
+	if err != nil {
+		return err
+	}
+	if options.RedirectType == 0 {
+		options.RedirectType = workspace.RedirectType
+	}
+	if options.Domain == "" {
+		options.Domain = workspace.Domain
+	}
+	return nil
+}
+
+// applyWorkspaceRequest переносит в пространство переданные поля и проверяет настройки
+func applyWorkspaceRequest(workspace *model.Workspace, request api.WorkspaceRequest) error {
+	if request.Name != nil {
+		workspace.Name = strings.TrimSpace(*request.Name)
+	}
+	if request.Quota != nil {
+		workspace.Quota = *request.Quota
+	}
+	if request.RedirectType != nil {
+		workspace.RedirectType = *request.RedirectType
+	}
+	if request.Domain != nil {
+		domain, err := domains.Find(*request.Domain)
+		if err != nil {
+			return err
+		}
+		workspace.Domain = domain.Name
+	}
+
+	if workspace.Name == "" {
+		return model.NewError(model.CodeInvalid, "workspace name is empty", nil)
+	}
+	if workspace.Quota < 0 {
+		return model.NewError(model.CodeInvalid, "workspace quota can't be negative", nil)
+	}
+	if workspace.RedirectType != 0 && !IsRedirectType(workspace.RedirectType) {
+		return model.NewError(model.CodeInvalid, "unsupported redirect type", nil)
+	}
+	return nil
+}
+
+// setMemberRole меняет роль участника, пустая роль исключает его. Пространство не остается без владельца
+func setMemberRole(workspace *model.Workspace, userID, role string) error {
+	members := make([]model.Member, 0, len(workspace.Members)+1)
+	owners := 0
+	isFound := false
+	for _, v := range workspace.Members {
+		if v.UserID == userID {
+			isFound = true
+			v.Role = role
+		}
+		if v.Role == "" {
+			continue
+		}
+		if v.Role == model.RoleOwner {
+			owners++
+		}
+		members = append(members, v)
+	}
+	if !isFound && role != "" {
+		members = append(members, model.Member{UserID: userID, Role: role})
+	}
+	if !isFound && role == "" {
+		return model.NewError(model.CodeNotFound, "member not found", nil)
+	}
+	if owners == 0 {
+		return errLastOwner
+	}
+	workspace.Members = members
+	return nil
+}
+
+func (s *Server) HandleCreateWorkspace(res http.ResponseWriter, req *http.Request) {
+
+	var request api.WorkspaceRequest
+	err := readJSON(req, &request)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	userID := auth.GetUserID(req.Context())
+	if userID == "" {
+		httpResp.ProblemJSON(res, model.NewError(model.CodeForbidden, "user is unknown", nil))
+		return
+	}
+
+	now := time.Now().UTC()
+	workspace := model.Workspace{
+		ID:        rand.RandStringBytes(workspaceIDLen),
+		Members:   []model.Member{{UserID: userID, Role: model.RoleOwner}},
+		CreatedAt: &now,
+	}
+	err = applyWorkspaceRequest(&workspace, request)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	err = s.Storage.SetWorkspace(workspace)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	JSONResp, err := json.Marshal(workspace)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	additional := httpResp.Additional{
+		Place:     httpResp.PlaceBody,
+		InnerData: string(JSONResp),
+	}
+	httpResp.CreatedJSON(res, additional)
+}
+
+func (s *Server) HandleWorkspaces(res http.ResponseWriter, req *http.Request) {
+
+	workspaces, err := s.Storage.Workspaces(auth.GetUserID(req.Context()))
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	if workspaces == nil {
+		workspaces = []model.Workspace{}
+	}
+	writeJSON(res, workspaces)
+}
+
+func (s *Server) HandleWorkspace(res http.ResponseWriter, req *http.Request) {
+
+	workspace, err := s.workspace(req.Context(), chi.URLParam(req, "id"), model.RoleViewer)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	writeJSON(res, workspace)
+}
+
+// HandlePatchWorkspace меняет название, квоту и настройки ссылок пространства, доступно владельцу
+func (s *Server) HandlePatchWorkspace(res http.ResponseWriter, req *http.Request) {
+
+	var request api.WorkspaceRequest
+	err := readJSON(req, &request)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	workspace, err := s.workspace(req.Context(), chi.URLParam(req, "id"), model.RoleOwner)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	err = applyWorkspaceRequest(&workspace, request)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	err = s.Storage.SetWorkspace(workspace)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	writeJSON(res, workspace)
+}
+
+// HandleDeleteWorkspace удаляет пространство, в котором не осталось активных ссылок
+func (s *Server) HandleDeleteWorkspace(res http.ResponseWriter, req *http.Request) {
+
+	workspace, err := s.workspace(req.Context(), chi.URLParam(req, "id"), model.RoleOwner)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	stats, err := s.Storage.WorkspaceStats(workspace.ID)
+	if err == nil && stats.Links > 0 {
+		err = model.NewError(model.CodeConflict, "workspace still has links", nil)
+	}
+	if err == nil {
+		err = s.Storage.DeleteWorkspace(workspace.ID)
+	}
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	httpResp.NoContent(res)
+}
+
+func (s *Server) HandleWorkspaceStats(res http.ResponseWriter, req *http.Request) {
+
+	workspace, err := s.workspace(req.Context(), chi.URLParam(req, "id"), model.RoleViewer)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	stats, err := s.Storage.WorkspaceStats(workspace.ID)
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	writeJSON(res, api.WorkspaceStatsResponse{
+		Links:   stats.Links,
+		Clicks:  stats.Clicks,
+		Members: len(workspace.Members),
+		Quota:   workspace.Quota,
+	})
+}
+
+// HandleSetMember добавляет участника или меняет его роль, доступно владельцу
+func (s *Server) HandleSetMember(res http.ResponseWriter, req *http.Request) {
+
+	var request api.MemberRequest
+	err := readJSON(req, &request)
+	if err != nil {
+		httpResp.ProblemJSON(res, err)
+		return
+	}
+	if !model.IsRole(request.Role) {
+		httpResp.ProblemJSON(res, model.NewError(model.CodeInvalid, "unknown role "+request.Role, nil))
+		return
+	}
+	workspace, err := s.workspace(req.Context(), chi.URLParam(req, "id"), model.RoleOwner)
+	if err == nil {
+		err = setMemberRole(&workspace, chi.URLParam(req, "user"), request.Role)
+	}
+	if err == nil {
+		err = s.Storage.SetWorkspace(workspace)
+	}
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	writeJSON(res, workspace)
+}
+
+// HandleDeleteMember исключает участника. Владелец исключает любого, остальные - только себя
+func (s *Server) HandleDeleteMember(res http.ResponseWriter, req *http.Request) {
+
+	userID := chi.URLParam(req, "user")
+	required := model.RoleOwner
+	if userID == auth.GetUserID(req.Context()) {
+		required = model.RoleViewer
+	}
+	workspace, err := s.workspace(req.Context(), chi.URLParam(req, "id"), required)
+	if err == nil {
+		err = setMemberRole(&workspace, userID, "")
+	}
+	if err == nil {
+		err = s.Storage.SetWorkspace(workspace)
+	}
+	if err != nil {
+		handleAdminError(res, err)
+		return
+	}
+	httpResp.NoContent(res)
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MaximMNsk/go-url-shortener/internal/interface/model"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/api"
+	"github.com/MaximMNsk/go-url-shortener/internal/models/memory"
+	"github.com/MaximMNsk/go-url-shortener/server/auth"
+	confModule "github.com/MaximMNsk/go-url-shortener/server/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWorkspaces(t *testing.T) {
+	confModule.Config.Final.ShortURLAddr = "http://localhost:8080"
+	confModule.Config.Final.Domains = "go.example"
+	defer func() { confModule.Config.Final.ShortURLAddr, confModule.Config.Final.Domains = "", "" }()
+
+	serve := NewServ(confModule.Config, &memory.MemStorage{})
+	router := chi.NewRouter()
+	router.Get(`/api/user/urls`, serve.HandleUserURLs)
+	router.Patch(`/api/links/{id}`, serve.HandlePatchLink)
+	router.Post(`/api/workspaces`, serve.HandleCreateWorkspace)
+	router.Get(`/api/workspaces`, serve.HandleWorkspaces)
+	router.Patch(`/api/workspaces/{id}`, serve.HandlePatchWorkspace)
+	router.Delete(`/api/workspaces/{id}`, serve.HandleDeleteWorkspace)
+	router.Get(`/api/workspaces/{id}/stats`, serve.HandleWorkspaceStats)
+	router.Put(`/api/workspaces/{id}/members/{user}`, serve.HandleSetMember)
+	router.Delete(`/api/workspaces/{id}/members/{user}`, serve.HandleDeleteMember)
+
+	call := func(userID, method, target, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request.WithContext(auth.WithUserID(context.Background(), userID)))
+		return w
+	}
+	user := func(userID string) context.Context {
+		return auth.WithUserID(context.Background(), userID)
+	}
+
+	w := call("alice", http.MethodPost, "/api/workspaces", `{"name":" Team ","quota":2,"redirect_type":302,"domain":"GO.example"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var workspace model.Workspace
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &workspace))
+	assert.Equal(t, "Team", workspace.Name)
+	assert.Equal(t, "go.example", workspace.Domain)
+	assert.Equal(t, []model.Member{{UserID: "alice", Role: model.RoleOwner}}, workspace.Members)
+	base := "/api/workspaces/" + workspace.ID
+
+	setup := []struct {
+		name   string
+		userID string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{name: "Empty name", userID: "alice", method: http.MethodPost, target: "/api/workspaces", body: `{"quota":1}`, status: http.StatusBadRequest},
+		{name: "Add editor", userID: "alice", method: http.MethodPut, target: base + "/members/bob", body: `{"role":"editor"}`, status: http.StatusOK},
+		{name: "Add viewer", userID: "alice", method: http.MethodPut, target: base + "/members/carol", body: `{"role":"viewer"}`, status: http.StatusOK},
+		{name: "Unknown role", userID: "alice", method: http.MethodPut, target: base + "/members/dave", body: `{"role":"admin"}`, status: http.StatusBadRequest},
+		{name: "Editor manages members", userID: "bob", method: http.MethodPut, target: base + "/members/dave", body: `{"role":"viewer"}`, status: http.StatusForbidden},
+		{name: "Outsider manages members", userID: "dave", method: http.MethodPut, target: base + "/members/dave", body: `{"role":"owner"}`, status: http.StatusNotFound},
+		{name: "Last owner leaves", userID: "alice", method: http.MethodDelete, target: base + "/members/alice", status: http.StatusConflict},
+		{name: "Last owner is demoted", userID: "alice", method: http.MethodPut, target: base + "/members/alice", body: `{"role":"editor"}`, status: http.StatusConflict},
+		{name: "Viewer changes settings", userID: "carol", method: http.MethodPatch, target: base, body: `{"quota":10}`, status: http.StatusForbidden},
+		{name: "Bad redirect type", userID: "alice", method: http.MethodPatch, target: base, body: `{"redirect_type":200}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range setup {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.status, call(tt.userID, tt.method, tt.target, tt.body).Code)
+		})
+	}
+	var workspaces []model.Workspace
+	require.NoError(t, json.Unmarshal(call("carol", http.MethodGet, "/api/workspaces", "").Body.Bytes(), &workspaces))
+	require.Len(t, workspaces, 1)
+	assert.Equal(t, model.RoleViewer, workspaces[0].Role("carol"))
+	assert.Equal(t, 2, workspaces[0].Quota)
+	assert.Equal(t, "[]", call("dave", http.MethodGet, "/api/workspaces", "").Body.String())
+
+	// Ссылки создают редакторы, ссылка получает настройки пространства
+	options := model.LinkOptions{Workspace: workspace.ID}
+	shortLink, err := serve.Shorten(user("bob"), "https://example.com/team", options)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(shortLink, "https://go.example/"))
+	id := "go.example~" + shortLink[strings.LastIndex(shortLink, "/")+1:]
+	info, err := serve.Resolve(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, info.RedirectType)
+	_, err = serve.Shorten(user("carol"), "https://example.com/viewer", options)
+	assert.Equal(t, model.CodeForbidden, model.CodeOf(err))
+	_, err = serve.Shorten(user("dave"), "https://example.com/outsider", options)
+	assert.Equal(t, model.CodeNotFound, model.CodeOf(err))
+
+	// Квота учитывает и ссылки той же пачки
+	resp, err := serve.BatchShorten(user("alice"), `[{"correlation_id":"a","original_url":"https://example.com/a","workspace":"`+workspace.ID+`"},
+		{"correlation_id":"b","original_url":"https://example.com/b","workspace":"`+workspace.ID+`"}]`, false)
+	require.NoError(t, err)
+	var items []api.BatchResponseItem
+	require.NoError(t, json.Unmarshal(resp, &items))
+	assert.Equal(t, model.BatchCreated, items[0].Status)
+	assert.Equal(t, model.BatchInvalid, items[1].Status)
+	_, err = serve.Shorten(user("bob"), "https://example.com/over", options)
+	assert.Equal(t, model.CodeForbidden, model.CodeOf(err))
+
+	access := []struct {
+		name   string
+		userID string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{name: "Viewer lists links", userID: "carol", method: http.MethodGet, target: "/api/user/urls?workspace=" + workspace.ID, status: http.StatusOK},
+		{name: "Outsider lists links", userID: "dave", method: http.MethodGet, target: "/api/user/urls?workspace=" + workspace.ID, status: http.StatusNotFound},
+		{name: "Viewer edits link", userID: "carol", method: http.MethodPatch, target: "/api/links/" + id, body: `{"folder":"team"}`, status: http.StatusForbidden},
+		{name: "Outsider edits link", userID: "dave", method: http.MethodPatch, target: "/api/links/" + id, body: `{"folder":"team"}`, status: http.StatusNotFound},
+		{name: "Editor edits link of another member", userID: "alice", method: http.MethodPatch, target: "/api/links/" + id, body: `{"folder":"team"}`, status: http.StatusOK},
+		{name: "Outsider gets stats", userID: "dave", method: http.MethodGet, target: base + "/stats", status: http.StatusNotFound},
+	}
+	for _, tt := range access {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.status, call(tt.userID, tt.method, tt.target, tt.body).Code)
+		})
+	}
+	w = call("carol", http.MethodGet, "/api/user/urls?workspace="+workspace.ID+"&sort=url", "")
+	var urls []api.UserURL
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &urls))
+	require.Len(t, urls, 2)
+	assert.Equal(t, "https://example.com/a", urls[0].OriginalURL)
+	assert.Equal(t, "team", urls[1].Folder)
+	assert.Equal(t, http.StatusNoContent, call("bob", http.MethodGet, "/api/user/urls", "").Code)
+
+	// Удаляют ссылки пространства только редакторы и владельцы
+	require.NoError(t, serve.DeleteUserURLs(user("carol"), []string{id}))
+	w = call("carol", http.MethodGet, base+"/stats", "")
+	assert.JSONEq(t, `{"links":2,"clicks":0,"members":3,"quota":2}`, w.Body.String())
+	assert.Equal(t, http.StatusConflict, call("alice", http.MethodDelete, base, "").Code)
+	require.NoError(t, serve.DeleteUserURLs(user("bob"), []string{id, "go.example~a"}))
+	w = call("carol", http.MethodGet, base+"/stats", "")
+	assert.JSONEq(t, `{"links":0,"clicks":0,"members":3,"quota":2}`, w.Body.String())
+
+	assert.Equal(t, http.StatusNoContent, call("carol", http.MethodDelete, base+"/members/carol", "").Code)
+	assert.Equal(t, http.StatusNotFound, call("carol", http.MethodGet, base+"/stats", "").Code)
+	assert.Equal(t, http.StatusForbidden, call("bob", http.MethodDelete, base, "").Code)
+	assert.Equal(t, http.StatusNoContent, call("alice", http.MethodDelete, base, "").Code)
+	assert.Equal(t, http.StatusNotFound, call("alice", http.MethodGet, base+"/stats", "").Code)
+}
+
+func TestWorkspaceQuotaConcurrent(t *testing.T) {
+	storage := &memory.MemStorage{}
+	serve := NewServ(confModule.Config, storage)
+	require.NoError(t, storage.SetWorkspace(model.Workspace{ID: "team", Name: "Team", Quota: 2,
+		Members: []model.Member{{UserID: "alice", Role: model.RoleOwner}}}))
+
+	const links = 10
+	errs := make([]error, links)
+	var wg sync.WaitGroup
+	for i := 0; i < links; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = serve.Shorten(auth.WithUserID(context.Background(), "alice"), "https://example.com/"+strconv.Itoa(i), model.LinkOptions{Workspace: "team"})
+		}(i)
+	}
+	wg.Wait()
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.ErrorIs(t, err, model.ErrQuotaExceeded)
+	}
+	assert.Equal(t, 2, created)
+}